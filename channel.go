@@ -4,11 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"go.uber.org/multierr"
 	"log"
 	"reflect"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// trySendTimeout is the maximum time that the non-blocking send methods wait for the transport write to complete.
+const trySendTimeout = 10 * time.Millisecond
+
 type MessageSender interface {
 	SendMessage(ctx context.Context, msg *Message) error
 }
@@ -68,9 +74,12 @@ type channel struct {
 	transport     Transport
 	sessionID     string
 	remoteNode    Node
+	remoteRole    DomainRole // remoteRole is the domain role of the remote node, assigned by the server authentication
 	localNode     Node
+	listenerName  string // listenerName is the name of the server listener that accepted the transport, if any
 	state         SessionState
 	stateMu       sync.RWMutex
+	stateWatchers []func(state SessionState) // stateWatchers are called on each session state transition
 	inMsgChan     chan *Message
 	inNotChan     chan *Notification
 	inReqCmdChan  chan *RequestCommand
@@ -81,10 +90,40 @@ type channel struct {
 	startRcv      sync.Once
 	stopRcv       sync.Once
 	rcvDone       chan struct{}
+	rcvErr        error   // rcvErr is the transport error that stopped the receiver goroutine, if any
+	failReason    *Reason // failReason is the reason of the session failure, set before changing the state to failed
 	client        bool
+	validateEnvs  bool // validateEnvs indicates if the envelopes addressing should be validated before sending
+	fillFrom      bool // fillFrom indicates if the local node should be set as originator of the envelopes without it
+	// correlationKey is the metadata key used for propagating the context correlation id in the envelopes, if any
+	correlationKey string
+	signer         Signer       // signer signs the sent envelopes, if defined
+	verifier       Verifier     // verifier verifies the signature of the received envelopes, if defined
+	replays        *replayCache // replays holds the nonces of the received signed envelopes, if replays are rejected
+
+	enforceFrom   bool // enforceFrom indicates if the received envelopes originator should match the remote node
+	rejectFrom    bool // rejectFrom indicates if the session should be failed when the originator doesn't match
+	dropExpired   bool // dropExpired indicates if the received expired messages and commands should be discarded
+	notifyExpired bool // notifyExpired indicates if a failed notification should be sent for discarded messages
+
+	echoWatchdog bool  // echoWatchdog indicates if the received watchdog notifications should be echoed back
+	watchdog     int32 // watchdog is set to 1 when the client watchdog starts sending notifications in the channel
+	watchdogEcho int64 // watchdogEcho is the time of the last received watchdog echo, in Unix nanoseconds
+
+	// onSession is called with the session envelopes received while established, if defined. In this case, the
+	// receiver goroutine keeps running after the session envelope, instead of stopping.
+	onSession func(ses *Session)
+
+	// trackRcvTimes indicates if the receiving time of the envelopes should be recorded, accessed atomically
+	trackRcvTimes int32
+	rcvTimes      sync.Map // rcvTimes holds the receiving time of the envelopes that were not consumed yet
+
+	rcvCmdIDs     *envelopeIDCache // rcvCmdIDs holds the recently received request command ids
+	onDupEnvelope func(id string)  // onDupEnvelope is called when a request command id is received more than once
 
 	processingCmds   map[string]chan *ResponseCommand
 	processingCmdsMu sync.RWMutex
+	processingSlots  chan struct{} // processingSlots limits the number of in-flight commands, if not nil
 
 	cancel context.CancelFunc // The function for cancelling the listener goroutine
 }
@@ -113,6 +152,38 @@ func (c *channel) Established() bool {
 	return c.State() == SessionStateEstablished && c.transport.Connected()
 }
 
+// receiveErr returns the transport error that stopped the receiver goroutine.
+// It returns nil if the receiver is still running or if it was stopped without errors.
+func (c *channel) receiveErr() error {
+	select {
+	case <-c.rcvDone:
+		return c.rcvErr
+	default:
+		return nil
+	}
+}
+
+// receivedSession returns the session envelope received while the session was established, if any.
+// The receiver goroutine stops after receiving it, so it should be called after the receiver is done.
+func (c *channel) receivedSession() (*Session, bool) {
+	select {
+	case ses, ok := <-c.inSesChan:
+		return ses, ok
+	default:
+		return nil, false
+	}
+}
+
+// failedReason returns the reason of the session failure, if the session is failed.
+func (c *channel) failedReason() *Reason {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	if c.state != SessionStateFailed {
+		return nil
+	}
+	return c.failReason
+}
+
 func (c *channel) startReceiver() {
 	defer c.rcvMu.Unlock()
 	c.rcvMu.Lock()
@@ -133,7 +204,7 @@ func (c *channel) stopReceiver() {
 }
 
 func (c *channel) setState(state SessionState) {
-	c.setStateWLock(state)
+	changed, watchers := c.setStateWLock(state)
 
 	switch state {
 	case SessionStateEstablished:
@@ -141,9 +212,15 @@ func (c *channel) setState(state SessionState) {
 	case SessionStateFinished, SessionStateFailed:
 		c.stopRcv.Do(c.stopReceiver)
 	}
+
+	if changed {
+		for _, f := range watchers {
+			f(state)
+		}
+	}
 }
 
-func (c *channel) setStateWLock(state SessionState) {
+func (c *channel) setStateWLock(state SessionState) (bool, []func(state SessionState)) {
 	c.stateMu.Lock()
 	defer c.stateMu.Unlock()
 
@@ -151,7 +228,87 @@ func (c *channel) setStateWLock(state SessionState) {
 		panic(fmt.Errorf("cannot change from state %s to %s", c.state, state))
 	}
 
+	changed := c.state != state
 	c.state = state
+	return changed, c.stateWatchers
+}
+
+// setFailedWLock changes the channel state to failed, setting the failure reason in the same critical section.
+func (c *channel) setFailedWLock(reason *Reason) (bool, []func(state SessionState)) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	changed := c.state != SessionStateFailed
+	c.failReason = reason
+	c.state = SessionStateFailed
+	return changed, c.stateWatchers
+}
+
+// WatchState registers a function to be called on each session state transition of the channel, like from
+// 'negotiating' to 'authenticating' and then to 'established'.
+// The function is called synchronously by the goroutine that changes the state, after the transition, so it should
+// not block. It should be registered before the session establishment for observing all the transitions.
+func (c *channel) WatchState(f func(state SessionState)) {
+	if f == nil {
+		panic("nil watcher")
+	}
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.stateWatchers = append(c.stateWatchers[:len(c.stateWatchers):len(c.stateWatchers)], f)
+}
+
+// Drain removes and returns the envelopes that were received but not consumed yet, like the messages and
+// notifications that are buffered when the channel is closing, allowing them to be persisted before discarding the
+// channel. The buffered envelopes are still available after the channel is closed. It does not block awaiting for new
+// envelopes, and stops if the context is canceled.
+func (c *channel) Drain(ctx context.Context) []envelope {
+	var envs []envelope
+	envs = drainChan(ctx, c.inMsgChan, envs)
+	envs = drainChan(ctx, c.inNotChan, envs)
+	envs = drainChan(ctx, c.inReqCmdChan, envs)
+	envs = drainChan(ctx, c.inRespCmdChan, envs)
+	for _, e := range envs {
+		c.rcvTimes.Delete(e)
+	}
+	return envs
+}
+
+// trackReceivedAt enables the recording of the receiving time of the envelopes, which are consumed through the
+// receivedAt method. It should be enabled only if all the received envelopes are consumed by it, which is the case of
+// the EnvelopeMux listener.
+func (c *channel) trackReceivedAt() {
+	atomic.StoreInt32(&c.trackRcvTimes, 1)
+}
+
+func (c *channel) recordReceivedAt(e envelope, t time.Time) {
+	if atomic.LoadInt32(&c.trackRcvTimes) == 1 {
+		c.rcvTimes.Store(e, t)
+	}
+}
+
+// receivedAt returns and forgets the time the envelope was received from the transport, if recorded.
+func (c *channel) receivedAt(e envelope) (time.Time, bool) {
+	v, ok := c.rcvTimes.LoadAndDelete(e)
+	if !ok {
+		return time.Time{}, false
+	}
+	return v.(time.Time), true
+}
+
+// drainChan appends the values that are available in the channel to the envelopes slice, without blocking.
+func drainChan[T envelope](ctx context.Context, ch <-chan T, envs []envelope) []envelope {
+	for ctx.Err() == nil {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return envs
+			}
+			envs = append(envs, e)
+		default:
+			return envs
+		}
+	}
+	return envs
 }
 
 func (c *channel) MsgChan() <-chan *Message {
@@ -184,24 +341,48 @@ func receiveFromTransport(ctx context.Context, c *channel, done chan<- struct{})
 		if err != nil {
 			if ctx.Err() == nil {
 				log.Printf("receiveFromTransport: %v", err)
+				c.rcvErr = err
 			}
 			return
 		}
+		rcvTime := time.Now()
+
+		if c.verifier != nil && c.discardUnverified(ctx, env) {
+			continue
+		}
+
+		if c.enforceFrom && !c.enforceFromAddress(ctx, env) {
+			return
+		}
+
+		if c.dropExpired && c.discardExpired(ctx, env) {
+			continue
+		}
 
 		switch e := env.(type) {
 		case *Message:
+			c.recordReceivedAt(e, rcvTime)
 			select {
 			case <-ctx.Done():
 				return
 			case c.inMsgChan <- e:
 			}
 		case *Notification:
+			if c.handlesWatchdog() && isWatchdogNotification(e) {
+				c.handleWatchdog(ctx, e)
+				continue
+			}
+			c.recordReceivedAt(e, rcvTime)
 			select {
 			case <-ctx.Done():
 				return
 			case c.inNotChan <- e:
 			}
 		case *RequestCommand:
+			if c.rcvCmdIDs != nil && e.ID != "" && !c.rcvCmdIDs.add(e.ID) {
+				c.onDupEnvelope(e.ID)
+			}
+			c.recordReceivedAt(e, rcvTime)
 			select {
 			case <-ctx.Done():
 				return
@@ -209,6 +390,7 @@ func receiveFromTransport(ctx context.Context, c *channel, done chan<- struct{})
 			}
 		case *ResponseCommand:
 			if !c.trySubmitCommandResult(e) {
+				c.recordReceivedAt(e, rcvTime)
 				select {
 				case <-ctx.Done():
 					return
@@ -216,6 +398,10 @@ func receiveFromTransport(ctx context.Context, c *channel, done chan<- struct{})
 				}
 			}
 		case *Session:
+			if c.onSession != nil {
+				c.onSession(e)
+				continue
+			}
 			select {
 			case <-ctx.Done():
 				return
@@ -233,6 +419,94 @@ func receiveFromTransport(ctx context.Context, c *channel, done chan<- struct{})
 	}
 }
 
+// enforceFromAddress checks if the received envelope originator matches the session remote node, correcting it or
+// failing the session in case of mismatch. It returns false if the session was failed.
+func (c *channel) enforceFromAddress(ctx context.Context, e envelope) bool {
+	env := envelopeOf(e)
+	if env == nil ||
+		env.From == (Node{}) ||
+		env.From == c.remoteNode ||
+		(env.From.Instance == "" && env.From.Identity == c.remoteNode.Identity) {
+		return true
+	}
+
+	if !c.rejectFrom {
+		env.From = c.remoteNode
+		return true
+	}
+
+	ses := &Session{
+		Envelope: Envelope{
+			ID:   c.sessionID,
+			From: c.localNode,
+			To:   c.remoteNode,
+		},
+		State: SessionStateFailed,
+		Reason: &Reason{
+			Code:        ReasonCodeValidationInvalidRecipients,
+			Description: "The envelope originator doesn't match the session node",
+		},
+	}
+
+	c.sendMu.Lock()
+	err := c.transport.Send(ctx, ses)
+	c.sendMu.Unlock()
+	if err != nil {
+		log.Printf("enforceFromAddress: %v", err)
+	}
+
+	// The receiver goroutine is the caller, so the state is changed without stopping it
+	if changed, watchers := c.setFailedWLock(ses.Reason); changed {
+		for _, f := range watchers {
+			f(SessionStateFailed)
+		}
+	}
+	_ = c.transport.Close()
+	return false
+}
+
+// discardExpired checks if the received message or request command is expired, returning true if it should be
+// discarded. A failed notification is sent for discarded messages if notifyExpired is enabled.
+func (c *channel) discardExpired(ctx context.Context, e envelope) bool {
+	switch v := e.(type) {
+	case *Message:
+		if !v.Expired(time.Now()) {
+			return false
+		}
+		if c.notifyExpired && v.ID != "" {
+			not := v.FailedNotification(&Reason{
+				Code:        ReasonCodeValidationError,
+				Description: "The message has expired",
+			})
+			c.sendMu.Lock()
+			err := c.transport.Send(ctx, not)
+			c.sendMu.Unlock()
+			if err != nil {
+				log.Printf("discardExpired: %v", err)
+			}
+		}
+		return true
+	case *RequestCommand:
+		return v.Expired(time.Now())
+	}
+	return false
+}
+
+// envelopeOf returns the base Envelope of messages, notifications and commands.
+func envelopeOf(e envelope) *Envelope {
+	switch v := e.(type) {
+	case *Message:
+		return &v.Envelope
+	case *Notification:
+		return &v.Envelope
+	case *RequestCommand:
+		return &v.Envelope
+	case *ResponseCommand:
+		return &v.Envelope
+	}
+	return nil
+}
+
 func (c *channel) ID() string {
 	return c.sessionID
 }
@@ -310,6 +584,67 @@ func (c *channel) SendMessage(ctx context.Context, msg *Message) error {
 	return c.sendToTransport(ctx, msg, "send message")
 }
 
+// TrySendMessage attempts to send a message without blocking, returning false if the send is not possible right
+// away because another envelope is being sent. The transport write is never interrupted, since that could leave the
+// connection in an inconsistent state, so if it doesn't complete in a short period, it continues in background and
+// true is returned, with any error of the write being logged.
+// It is intended for callers that must never block, like UI threads.
+func (c *channel) TrySendMessage(ctx context.Context, msg *Message) (bool, error) {
+	const action = "try send message"
+	if err := c.prepareEnvelope(ctx, msg, action); err != nil {
+		return false, err
+	}
+
+	if !c.sendMu.TryLock() {
+		return false, nil
+	}
+
+	done := make(chan error)
+	abandoned := make(chan struct{})
+	go func() {
+		// The write is not bound to the caller context, which may end before it completes
+		err := c.transport.Send(context.Background(), msg)
+		c.sendMu.Unlock()
+		select {
+		case done <- err:
+		case <-abandoned:
+			if err != nil {
+				log.Printf("%v: %v", action, err)
+			}
+		}
+	}()
+
+	timer := time.NewTimer(trySendTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return false, fmt.Errorf("%v: %w", action, err)
+		}
+		return true, nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	close(abandoned)
+	return true, nil
+}
+
+// IsHealthy checks the liveness of the session transport through the HealthChecker interface, if implemented by it,
+// or returns if the transport is connected otherwise. The transport probe is written holding the send lock, so it
+// doesn't interleave with the envelopes being sent.
+func (c *channel) IsHealthy(ctx context.Context) bool {
+	hc, ok := c.transport.(HealthChecker)
+	if !ok {
+		return c.transport.Connected()
+	}
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	return hc.IsHealthy(ctx)
+}
+
 func (c *channel) SendNotification(ctx context.Context, not *Notification) error {
 	return c.sendToTransport(ctx, not, "send notification")
 }
@@ -336,10 +671,7 @@ func (c *channel) Close() error {
 }
 
 func (c *channel) sendToTransport(ctx context.Context, e envelope, action string) error {
-	if e == nil || reflect.ValueOf(e).IsNil() {
-		panic(fmt.Errorf("%v: envelope cannot be nil", action))
-	}
-	if err := c.ensureEstablished(action); err != nil {
+	if err := c.prepareEnvelope(ctx, e, action); err != nil {
 		return err
 	}
 
@@ -353,6 +685,65 @@ func (c *channel) sendToTransport(ctx context.Context, e envelope, action string
 	return nil
 }
 
+// prepareEnvelope validates the envelope for sending and fills its values, accordingly to the channel options.
+func (c *channel) prepareEnvelope(ctx context.Context, e envelope, action string) error {
+	if e == nil || reflect.ValueOf(e).IsNil() {
+		panic(fmt.Errorf("%v: envelope cannot be nil", action))
+	}
+	if err := c.ensureEstablished(action); err != nil {
+		return err
+	}
+	if c.validateEnvs {
+		if err := c.validateEnvelope(e); err != nil {
+			return fmt.Errorf("%v: %w", action, err)
+		}
+	}
+	if c.fillFrom {
+		if env := envelopeOf(e); env != nil && env.From == (Node{}) {
+			env.From = c.localNode
+		}
+	}
+	if c.correlationKey != "" {
+		if id, ok := ContextCorrelationID(ctx); ok {
+			if env := envelopeOf(e); env != nil && env.Metadata[c.correlationKey] == "" {
+				env.SetMetadataKeyValue(c.correlationKey, id)
+			}
+		}
+	}
+	if c.signer != nil {
+		if err := c.signEnvelope(ctx, e); err != nil {
+			return fmt.Errorf("%v: %w", action, err)
+		}
+	}
+
+	return nil
+}
+
+// validateEnvelope checks if the envelope addressing is valid for sending.
+// In client channels, messages and commands should have the destination address defined.
+func (c *channel) validateEnvelope(e envelope) error {
+	if !c.client {
+		return nil
+	}
+
+	var to Node
+	switch v := e.(type) {
+	case *Message:
+		to = v.To
+	case *RequestCommand:
+		to = v.To
+	case *ResponseCommand:
+		to = v.To
+	default:
+		return nil
+	}
+
+	if to == (Node{}) {
+		return errors.New("invalid envelope: the destination address is required")
+	}
+	return nil
+}
+
 func (c *channel) ensureEstablished(action string) error {
 	return c.ensureState(SessionStateEstablished, action)
 }
@@ -381,6 +772,51 @@ func (c *channel) ensureTransportOK(action string) error {
 }
 
 func (c *channel) processCommand(ctx context.Context, sender RequestCommandSender, reqCmd *RequestCommand) (*ResponseCommand, error) {
+	f, err := c.sendCommandFuture(ctx, sender, reqCmd)
+	if err != nil {
+		return nil, err
+	}
+	return f.Await(ctx)
+}
+
+// ProcessCommands sends the request commands to the remote party and returns the corresponding responses, in the
+// same order of the commands. All commands are sent before awaiting for the responses.
+// If some responses are not received, like when the context is canceled, the partial result is returned, with nil
+// values for the missing responses, along with the errors of each failed command.
+func (c *channel) ProcessCommands(ctx context.Context, reqCmds []*RequestCommand) ([]*ResponseCommand, error) {
+	var errs error
+	futures := make([]*CommandFuture, len(reqCmds))
+	for i, reqCmd := range reqCmds {
+		f, err := c.sendCommandFuture(ctx, c, reqCmd)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("command '%v': %w", reqCmd.ID, err))
+			continue
+		}
+		futures[i] = f
+	}
+
+	respCmds := make([]*ResponseCommand, len(reqCmds))
+	for i, f := range futures {
+		if f == nil {
+			continue
+		}
+		respCmd, err := f.Await(ctx)
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("command '%v': %w", reqCmds[i].ID, err))
+			continue
+		}
+		respCmds[i] = respCmd
+	}
+	return respCmds, errs
+}
+
+// SendRequestCommandFuture sends a RequestCommand to the remote party, returning a CommandFuture for awaiting the
+// corresponding ResponseCommand later.
+func (c *channel) SendRequestCommandFuture(ctx context.Context, reqCmd *RequestCommand) (*CommandFuture, error) {
+	return c.sendCommandFuture(ctx, c, reqCmd)
+}
+
+func (c *channel) sendCommandFuture(ctx context.Context, sender RequestCommandSender, reqCmd *RequestCommand) (*CommandFuture, error) {
 	if reqCmd == nil {
 		panic("process command: command cannot be nil")
 	}
@@ -388,10 +824,21 @@ func (c *channel) processCommand(ctx context.Context, sender RequestCommandSende
 		panic("process command: invalid command id")
 	}
 
+	if c.processingSlots != nil {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("process command: %w", ctx.Err())
+		case c.processingSlots <- struct{}{}:
+		}
+	}
+
 	c.processingCmdsMu.Lock()
 
 	if _, ok := c.processingCmds[reqCmd.ID]; ok {
 		c.processingCmdsMu.Unlock()
+		if c.processingSlots != nil {
+			<-c.processingSlots
+		}
 		return nil, errors.New("process command: the command id is already in use")
 	}
 
@@ -399,25 +846,74 @@ func (c *channel) processCommand(ctx context.Context, sender RequestCommandSende
 	c.processingCmds[reqCmd.ID] = respChan
 	c.processingCmdsMu.Unlock()
 
-	defer func() {
+	f := &CommandFuture{
+		respChan: respChan,
+		released: make(chan struct{}),
+	}
+	f.release = func() {
 		c.processingCmdsMu.Lock()
-		delete(c.processingCmds, reqCmd.ID)
+		if c.processingCmds[reqCmd.ID] == respChan {
+			delete(c.processingCmds, reqCmd.ID)
+		}
 		c.processingCmdsMu.Unlock()
-	}()
+		if c.processingSlots != nil {
+			<-c.processingSlots
+		}
+		close(f.released)
+	}
 
-	err := sender.SendRequestCommand(ctx, reqCmd)
-	if err != nil {
+	if err := sender.SendRequestCommand(ctx, reqCmd); err != nil {
+		f.Release()
 		return nil, err
 	}
+	return f, nil
+}
+
+// CommandFuture represents the pending response of a request command, allowing it to be awaited after the command
+// is sent. It is not safe for concurrent use.
+type CommandFuture struct {
+	respChan    chan *ResponseCommand
+	respCmd     *ResponseCommand
+	release     func()
+	releaseOnce sync.Once
+	released    chan struct{}
+}
+
+// Await blocks until the response of the command is received or the context is canceled.
+// If the context is canceled, the future is released and the response is discarded. Once received, the response is
+// returned by the subsequent calls.
+func (f *CommandFuture) Await(ctx context.Context) (*ResponseCommand, error) {
+	if f.respCmd != nil {
+		return f.respCmd, nil
+	}
 
 	select {
 	case <-ctx.Done():
+		// The response may have been received along with the cancellation
+		select {
+		case respCmd := <-f.respChan:
+			f.respCmd = respCmd
+			f.Release()
+			return respCmd, nil
+		default:
+		}
+		f.Release()
 		return nil, fmt.Errorf("process command: %w", ctx.Err())
-	case respCmd := <-respChan:
+	case <-f.released:
+		return nil, errors.New("process command: the command future was released")
+	case respCmd := <-f.respChan:
+		f.respCmd = respCmd
+		f.Release()
 		return respCmd, nil
 	}
 }
 
+// Release stops awaiting for the command response, freeing the resources associated with the future.
+// It should be called if the future will not be awaited.
+func (f *CommandFuture) Release() {
+	f.releaseOnce.Do(f.release)
+}
+
 func (c *channel) trySubmitCommandResult(respCmd *ResponseCommand) bool {
 	if respCmd == nil {
 		return false
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/goleak"
+	"golang.org/x/sync/errgroup"
 	"testing"
 	"time"
 )
@@ -223,6 +224,34 @@ func TestChannel_ReceiveMessage_WhenEstablished(t *testing.T) {
 	}
 }
 
+func TestChannel_ReceiveMessage_WhenNotTrackingReceivedAt(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := newChannel(client, 1)
+	defer silentClose(c)
+	c.setState(SessionStateEstablished)
+	m := createMessage()
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	_ = server.Send(ctx, m)
+
+	// Act
+	select {
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	case <-c.MsgChan():
+	}
+
+	// Assert
+	_, ok := c.receivedAt(m)
+	assert.False(t, ok)
+	c.rcvTimes.Range(func(key, value interface{}) bool {
+		assert.Fail(t, "unexpected receiving time")
+		return false
+	})
+}
+
 func TestChannel_ReceiveMessage_WhenFinishedState(t *testing.T) {
 	receiveMessageWithState(t, SessionStateFinished)
 }
@@ -427,6 +456,31 @@ func TestChannel_ReceiveNotification_WhenEstablished(t *testing.T) {
 	}
 }
 
+func TestChannel_ReceiveNotification_WhenWatchdogNotEnabled(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := newChannel(client, 1)
+	defer silentClose(c)
+	c.client = true
+	c.setState(SessionStateEstablished)
+	n := newWatchdogNotification()
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	_ = server.Send(ctx, n)
+
+	// Act
+	select {
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	case actual, ok := <-c.NotChan():
+		// Assert
+		assert.True(t, ok)
+		assert.Equal(t, n, actual)
+	}
+	assert.Zero(t, c.lastWatchdogEcho())
+}
+
 func TestChannel_ReceiveNotification_WhenFinishedState(t *testing.T) {
 	receiveNotificationWithState(t, SessionStateFinished)
 	defer goleak.VerifyNone(t)
@@ -761,3 +815,502 @@ func TestChannel_ProcessCommand_ResponseWithAnotherId(t *testing.T) {
 		assert.Equal(t, respCmd, actualRespCmd)
 	}
 }
+
+func TestChannel_ProcessCommand_WithProcessingLimit(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := newChannel(client, 1)
+	defer silentClose(c)
+	c.setState(SessionStateEstablished)
+	limit := 3
+	count := 10
+	c.processingSlots = make(chan struct{}, limit)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	maxProcessing := 0
+	go func() {
+		for i := 0; i < count; i++ {
+			env, err := server.Receive(ctx)
+			if err != nil {
+				return
+			}
+			// Gives some time for other commands to be submitted
+			time.Sleep(time.Millisecond)
+			c.processingCmdsMu.RLock()
+			if len(c.processingCmds) > maxProcessing {
+				maxProcessing = len(c.processingCmds)
+			}
+			c.processingCmdsMu.RUnlock()
+			reqCmd := env.(*RequestCommand)
+			_ = server.Send(ctx, reqCmd.SuccessResponse())
+		}
+	}()
+	errChan := make(chan error, count)
+
+	// Act
+	for i := 0; i < count; i++ {
+		go func() {
+			reqCmd := createGetPingCommand()
+			reqCmd.SetNewEnvelopeID()
+			_, err := c.ProcessCommand(ctx, reqCmd)
+			errChan <- err
+		}()
+	}
+
+	// Assert
+	for i := 0; i < count; i++ {
+		assert.NoError(t, <-errChan)
+	}
+	assert.LessOrEqual(t, maxProcessing, limit)
+}
+
+func TestChannel_ReceiveMessage_WhenEnforceFromAddressCorrection(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := newChannel(server, 1)
+	defer silentClose(c)
+	c.remoteNode = Node{Identity: Identity{Name: "golang", Domain: "limeprotocol.org"}, Instance: "home"}
+	c.enforceFrom = true
+	c.setState(SessionStateEstablished)
+	m := createMessage()
+	m.SetFromString("admin@limeprotocol.org/home")
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	_ = client.Send(ctx, m)
+
+	// Act
+	select {
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	case actual, ok := <-c.MsgChan():
+		// Assert
+		assert.True(t, ok)
+		assert.Equal(t, m.ID, actual.ID)
+		assert.Equal(t, c.remoteNode, actual.From)
+	}
+}
+
+func TestChannel_ReceiveMessage_WhenEnforceFromAddressRejection(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := newChannel(server, 1)
+	defer silentClose(c)
+	c.remoteNode = Node{Identity: Identity{Name: "golang", Domain: "limeprotocol.org"}, Instance: "home"}
+	c.enforceFrom = true
+	c.rejectFrom = true
+	c.setState(SessionStateEstablished)
+	watched := make(chan SessionState, 1)
+	c.WatchState(func(state SessionState) {
+		watched <- state
+	})
+	m := createMessage()
+	m.SetFromString("admin@limeprotocol.org/home")
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	_ = client.Send(ctx, m)
+
+	// Act
+	env, err := client.Receive(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.IsType(t, &Session{}, env) {
+		ses := env.(*Session)
+		assert.Equal(t, SessionStateFailed, ses.State)
+		assert.Equal(t, ReasonCodeValidationInvalidRecipients, ses.Reason.Code)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	case _, ok := <-c.MsgChan():
+		assert.False(t, ok)
+	}
+	assert.Equal(t, SessionStateFailed, c.State())
+	assert.Equal(t, SessionStateFailed, <-watched)
+	if assert.NotNil(t, c.failedReason()) {
+		assert.Equal(t, ReasonCodeValidationInvalidRecipients, c.failedReason().Code)
+	}
+}
+
+func TestChannel_ReceiveMessage_WhenDropExpired(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := newChannel(server, 1)
+	defer silentClose(c)
+	c.dropExpired = true
+	c.notifyExpired = true
+	c.setState(SessionStateEstablished)
+	expired := createMessage()
+	expired.SetFromString("golang@limeprotocol.org/home")
+	expired.SetExpiration(time.Now().Add(-time.Minute))
+	valid := createMessage()
+	valid.SetNewEnvelopeID()
+	valid.SetExpiration(time.Now().Add(time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	_ = client.Send(ctx, expired)
+	_ = client.Send(ctx, valid)
+
+	// Act
+	env, err := client.Receive(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.IsType(t, &Notification{}, env) {
+		not := env.(*Notification)
+		assert.Equal(t, expired.ID, not.ID)
+		assert.Equal(t, NotificationEventFailed, not.Event)
+		assert.Equal(t, expired.Sender(), not.To)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	case actual := <-c.MsgChan():
+		assert.Equal(t, valid.ID, actual.ID)
+	}
+}
+
+func TestChannel_SendRequestCommandFuture_Concurrent(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := newChannel(client, 1)
+	defer silentClose(c)
+	c.setState(SessionStateEstablished)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	count := 5
+	go func() {
+		// Responds in the reverse order
+		var reqCmds []*RequestCommand
+		for i := 0; i < count; i++ {
+			e, err := server.Receive(ctx)
+			if err != nil {
+				return
+			}
+			reqCmds = append(reqCmds, e.(*RequestCommand))
+		}
+		for i := len(reqCmds) - 1; i >= 0; i-- {
+			_ = server.Send(ctx, reqCmds[i].SuccessResponse())
+		}
+	}()
+	ids := make([]string, count)
+	futures := make([]*CommandFuture, count)
+	eg, _ := errgroup.WithContext(ctx)
+	for i := 0; i < count; i++ {
+		i := i
+		eg.Go(func() error {
+			reqCmd := createGetPingCommand()
+			reqCmd.ID = NewEnvelopeID()
+			ids[i] = reqCmd.ID
+			f, err := c.SendRequestCommandFuture(ctx, reqCmd)
+			futures[i] = f
+			return err
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, f := range futures {
+		// Act
+		actual, err := f.Await(ctx)
+
+		// Assert
+		assert.NoError(t, err)
+		if assert.NotNil(t, actual) {
+			assert.Equal(t, ids[i], actual.ID)
+			assert.Equal(t, CommandStatusSuccess, actual.Status)
+		}
+	}
+	assert.Empty(t, c.processingCmds)
+}
+
+func TestChannel_SendRequestCommandFuture_WhenReleased(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, _ := newInProcessTransportPair("localhost", 1)
+	c := newChannel(client, 1)
+	defer silentClose(c)
+	c.setState(SessionStateEstablished)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	f, err := c.SendRequestCommandFuture(ctx, createGetPingCommand())
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Release()
+
+	// Act
+	actual, err := f.Await(ctx)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Nil(t, actual)
+	assert.Empty(t, c.processingCmds)
+}
+
+func TestChannel_ProcessCommands(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := newChannel(client, 1)
+	defer silentClose(c)
+	c.setState(SessionStateEstablished)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	count := 3
+	go func() {
+		for i := 0; i < count; i++ {
+			e, err := server.Receive(ctx)
+			if err != nil {
+				return
+			}
+			_ = server.Send(ctx, e.(*RequestCommand).SuccessResponse())
+		}
+	}()
+	var reqCmds []*RequestCommand
+	for i := 0; i < count; i++ {
+		reqCmd := createGetPingCommand()
+		reqCmd.ID = NewEnvelopeID()
+		reqCmds = append(reqCmds, reqCmd)
+	}
+
+	// Act
+	actual, err := c.ProcessCommands(ctx, reqCmds)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.Len(t, actual, count) {
+		for i, respCmd := range actual {
+			assert.Equal(t, reqCmds[i].ID, respCmd.ID)
+		}
+	}
+}
+
+func TestChannel_ProcessCommands_WhenResponseIsMissing(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := newChannel(client, 1)
+	defer silentClose(c)
+	c.setState(SessionStateEstablished)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	count := 3
+	var reqCmds []*RequestCommand
+	for i := 0; i < count; i++ {
+		reqCmd := createGetPingCommand()
+		reqCmd.ID = NewEnvelopeID()
+		reqCmds = append(reqCmds, reqCmd)
+	}
+	go func() {
+		for i := 0; i < count; i++ {
+			e, err := server.Receive(ctx)
+			if err != nil {
+				return
+			}
+			// The response of the second command never arrives
+			if reqCmd := e.(*RequestCommand); reqCmd.ID != reqCmds[1].ID {
+				_ = server.Send(ctx, reqCmd.SuccessResponse())
+			}
+		}
+	}()
+
+	// Act
+	actual, err := c.ProcessCommands(ctx, reqCmds)
+
+	// Assert
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), reqCmds[1].ID)
+	if assert.Len(t, actual, count) {
+		assert.Equal(t, reqCmds[0].ID, actual[0].ID)
+		assert.Nil(t, actual[1])
+		assert.Equal(t, reqCmds[2].ID, actual[2].ID)
+	}
+	assert.Empty(t, c.processingCmds)
+}
+
+func TestChannel_TrySendMessage_WhenIdle(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := newChannel(client, 1)
+	defer silentClose(c)
+	c.setState(SessionStateEstablished)
+	m := createMessage()
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	// Act
+	sent, err := c.TrySendMessage(ctx, m)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, sent)
+	actual, err := server.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, m, actual)
+}
+
+func TestChannel_TrySendMessage_WhenSending(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, _ := newInProcessTransportPair("localhost", 1)
+	c := newChannel(client, 1)
+	defer silentClose(c)
+	c.setState(SessionStateEstablished)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	// Simulates another envelope being sent
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	// Act
+	sent, err := c.TrySendMessage(ctx, createMessage())
+
+	// Assert
+	assert.NoError(t, err)
+	assert.False(t, sent)
+}
+
+func TestChannel_TrySendMessage_WhenTransportIsFull(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := newChannel(client, 1)
+	defer silentClose(c)
+	c.setState(SessionStateEstablished)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	first := createMessage()
+	if err := c.SendMessage(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	m := createMessage()
+	m.ID = NewEnvelopeID()
+
+	// Act
+	start := time.Now()
+	sent, err := c.TrySendMessage(ctx, m)
+	elapsed := time.Since(start)
+	// The write continues in background, holding the send lock
+	sentAgain, errAgain := c.TrySendMessage(ctx, createMessage())
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, sent)
+	assert.Less(t, elapsed, 100*time.Millisecond)
+	assert.NoError(t, errAgain)
+	assert.False(t, sentAgain)
+	actual1, err := server.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, first, actual1)
+	actual2, err := server.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, m, actual2)
+}
+
+func TestChannel_Drain_WhenMessagesAreBuffered(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 3)
+	c := newChannel(client, 3)
+	defer silentClose(c)
+	c.setState(SessionStateEstablished)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	var msgs []*Message
+	for i := 0; i < 3; i++ {
+		msg := createMessage()
+		msg.ID = NewEnvelopeID()
+		msgs = append(msgs, msg)
+		if err := server.Send(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	not := createNotification()
+	if err := server.Send(ctx, not); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		return len(c.inMsgChan) == 3 && len(c.inNotChan) == 1
+	}, 200*time.Millisecond, 5*time.Millisecond)
+	_ = c.Close()
+
+	// Act
+	actual := c.Drain(ctx)
+
+	// Assert
+	assert.Equal(t, []envelope{msgs[0], msgs[1], msgs[2], not}, actual)
+	assert.Empty(t, c.Drain(ctx))
+}
+
+func TestChannel_Drain_WhenEmpty(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, _ := newInProcessTransportPair("localhost", 1)
+	c := newChannel(client, 1)
+	defer silentClose(c)
+	c.setState(SessionStateEstablished)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	// Act
+	actual := c.Drain(ctx)
+
+	// Assert
+	assert.Empty(t, actual)
+}
+
+func TestChannel_IsHealthy_WhenSendingConcurrently(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	var transportChan = make(chan Transport, 1)
+	listener := createTCPListener(t, addr, transportChan)
+	defer silentClose(listener)
+	client := createClientTCPTransport(t, addr)
+	server := receiveTransport(t, transportChan)
+	c := newChannel(client, 1)
+	defer silentClose(c)
+	// Closing the server first ends the channel receiver
+	defer silentClose(server)
+	c.setState(SessionStateEstablished)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	count := 100
+	rcvErr := make(chan error, 1)
+	go func() {
+		for i := 0; i < count; i++ {
+			if _, err := server.Receive(ctx); err != nil {
+				rcvErr <- err
+				return
+			}
+		}
+		rcvErr <- nil
+	}()
+	sendErr := make(chan error, 1)
+
+	// Act
+	go func() {
+		for i := 0; i < count; i++ {
+			if err := c.SendMessage(ctx, createMessage()); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+		sendErr <- nil
+	}()
+	for i := 0; i < count; i++ {
+		assert.True(t, c.IsHealthy(ctx))
+	}
+
+	// Assert
+	assert.NoError(t, <-sendErr)
+	assert.NoError(t, <-rcvErr)
+}
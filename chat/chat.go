@@ -19,4 +19,16 @@ func RegisterChatDocuments() {
 	lime.RegisterDocumentFactory(func() lime.Document {
 		return &Receipt{}
 	})
+	lime.RegisterDocumentFactory(func() lime.Document {
+		return &Select{}
+	})
+	lime.RegisterDocumentFactory(func() lime.Document {
+		return &Input{}
+	})
+	lime.RegisterDocumentFactory(func() lime.Document {
+		return &MediaLink{}
+	})
+	lime.RegisterDocumentFactory(func() lime.Document {
+		return &WebLink{}
+	})
 }
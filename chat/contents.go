@@ -0,0 +1,224 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/takenet/lime-go"
+)
+
+// Select represents a text with options to be selected by the receiver, like a menu.
+type Select struct {
+	// Scope indicates how the options should be presented to the receiver.
+	Scope SelectScope `json:"scope,omitempty"`
+	// Text is the select question text.
+	Text string `json:"text,omitempty"`
+	// Destination is the node that should receive the selected option.
+	// If not defined, the option should be sent to the message originator.
+	Destination *lime.Node `json:"destination,omitempty"`
+	// Options are the available options to be selected.
+	Options []SelectOption `json:"options"`
+}
+
+func MediaTypeSelect() lime.MediaType {
+	return lime.MediaType{
+		Type:    "application",
+		Subtype: "vnd.lime.select",
+		Suffix:  "json",
+	}
+}
+
+func (s *Select) MediaType() lime.MediaType {
+	return MediaTypeSelect()
+}
+
+// SelectScope defines the presentation scope of the select options.
+type SelectScope string
+
+const (
+	// SelectScopeTransient indicates that the options should be presented only until the receiver sends a new message.
+	SelectScopeTransient = SelectScope("transient")
+	// SelectScopePersistent indicates that the options should be presented until they are replaced by other options.
+	SelectScopePersistent = SelectScope("persistent")
+	// SelectScopeImmediate indicates that the options should be presented only along with the select text.
+	SelectScopeImmediate = SelectScope("immediate")
+)
+
+// SelectOption represents an option of a Select document.
+type SelectOption struct {
+	// Order is the option order number. It is optional and should be unique in the select.
+	Order int
+	// Text is the option text.
+	Text string
+	// Value is the document that should be sent back by the receiver when the option is selected.
+	// If not defined, the option Text or Order should be sent instead.
+	Value lime.Document
+}
+
+// rawSelectOption is a wrapper for custom marshalling
+type rawSelectOption struct {
+	Order int              `json:"order,omitempty"`
+	Text  string           `json:"text,omitempty"`
+	Type  *lime.MediaType  `json:"type,omitempty"`
+	Value *json.RawMessage `json:"value,omitempty"`
+}
+
+func (o SelectOption) MarshalJSON() ([]byte, error) {
+	raw := rawSelectOption{Order: o.Order, Text: o.Text}
+	if o.Value != nil {
+		t := o.Value.MediaType()
+		raw.Type = &t
+		b, err := json.Marshal(o.Value)
+		if err != nil {
+			return nil, err
+		}
+		r := json.RawMessage(b)
+		raw.Value = &r
+	}
+	return json.Marshal(raw)
+}
+
+func (o *SelectOption) UnmarshalJSON(b []byte) error {
+	raw := rawSelectOption{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	option := SelectOption{Order: raw.Order, Text: raw.Text}
+	if raw.Value != nil {
+		if raw.Type == nil {
+			return errors.New("select option value type is required")
+		}
+		d, err := lime.UnmarshalDocument(raw.Value, *raw.Type)
+		if err != nil {
+			return err
+		}
+		option.Value = d
+	}
+
+	*o = option
+	return nil
+}
+
+// Input represents a request for the receiver to provide an input value, like a form field.
+type Input struct {
+	// Label is the document to be presented to the receiver for requesting the input, like a text.
+	Label *lime.DocumentContainer `json:"label,omitempty"`
+	// Validation defines the rules for validating the input value.
+	Validation *InputValidation `json:"validation,omitempty"`
+}
+
+func MediaTypeInput() lime.MediaType {
+	return lime.MediaType{
+		Type:    "application",
+		Subtype: "vnd.lime.input",
+		Suffix:  "json",
+	}
+}
+
+func (i *Input) MediaType() lime.MediaType {
+	return MediaTypeInput()
+}
+
+// InputValidation defines the validation rules of an Input value.
+type InputValidation struct {
+	// Rule is the validation rule to be applied to the input value.
+	Rule InputValidationRule `json:"rule,omitempty"`
+	// Format is the validation format, which depends on the rule, like a regular expression for the regex rule.
+	Format string `json:"format,omitempty"`
+	// Type is the expected media type of the input value, for the type rule.
+	Type *lime.MediaType `json:"type,omitempty"`
+	// ErrorMessage is the message to be presented to the receiver when the input value is invalid.
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+// InputValidationRule defines the validation rules of an input value.
+type InputValidationRule string
+
+const (
+	// InputValidationRuleText indicates that the input value should be a text.
+	InputValidationRuleText = InputValidationRule("text")
+	// InputValidationRuleNumber indicates that the input value should be a number.
+	InputValidationRuleNumber = InputValidationRule("number")
+	// InputValidationRuleDate indicates that the input value should be a date.
+	InputValidationRuleDate = InputValidationRule("date")
+	// InputValidationRuleRegex indicates that the input value should match the regular expression of the format.
+	InputValidationRuleRegex = InputValidationRule("regex")
+	// InputValidationRuleType indicates that the input value should be a document of the specified type.
+	InputValidationRuleType = InputValidationRule("type")
+)
+
+// MediaLink represents a link to a media file, like an image, a video or a document.
+type MediaLink struct {
+	// Type is the media type of the linked file.
+	Type *lime.MediaType `json:"type,omitempty"`
+	// Size is the size of the linked file, in bytes.
+	Size int64 `json:"size,omitempty"`
+	// URI is the address of the linked file.
+	URI string `json:"uri"`
+	// PreviewURI is the address of a preview of the linked file, like a thumbnail.
+	PreviewURI string `json:"previewUri,omitempty"`
+	// PreviewType is the media type of the preview file.
+	PreviewType *lime.MediaType `json:"previewType,omitempty"`
+	// Title is the media title.
+	Title string `json:"title,omitempty"`
+	// Text is the media description text.
+	Text string `json:"text,omitempty"`
+	// AspectRatio is the media aspect ratio, like "16:9".
+	AspectRatio string `json:"aspectRatio,omitempty"`
+}
+
+func MediaTypeMediaLink() lime.MediaType {
+	return lime.MediaType{
+		Type:    "application",
+		Subtype: "vnd.lime.media-link",
+		Suffix:  "json",
+	}
+}
+
+func (m *MediaLink) MediaType() lime.MediaType {
+	return MediaTypeMediaLink()
+}
+
+// WebLink represents a link to a web page.
+type WebLink struct {
+	// URI is the address of the web page.
+	URI string `json:"uri"`
+	// PreviewURI is the address of a preview image of the web page.
+	PreviewURI string `json:"previewUri,omitempty"`
+	// PreviewType is the media type of the preview image.
+	PreviewType *lime.MediaType `json:"previewType,omitempty"`
+	// Title is the web page title.
+	Title string `json:"title,omitempty"`
+	// Text is the web page description text.
+	Text string `json:"text,omitempty"`
+	// Target defines how the web page should be opened by the receiver.
+	Target WebLinkTarget `json:"target,omitempty"`
+}
+
+func MediaTypeWebLink() lime.MediaType {
+	return lime.MediaType{
+		Type:    "application",
+		Subtype: "vnd.lime.web-link",
+		Suffix:  "json",
+	}
+}
+
+func (w *WebLink) MediaType() lime.MediaType {
+	return MediaTypeWebLink()
+}
+
+// WebLinkTarget defines how a web link should be opened by the receiver.
+type WebLinkTarget string
+
+const (
+	// WebLinkTargetBlank indicates that the web page should be opened in a new window, like a browser.
+	WebLinkTargetBlank = WebLinkTarget("blank")
+	// WebLinkTargetSelf indicates that the web page should be opened in the current conversation window.
+	WebLinkTargetSelf = WebLinkTarget("self")
+	// WebLinkTargetSelfCompact indicates that the web page should be opened in the current conversation window, with
+	// a compact size.
+	WebLinkTargetSelfCompact = WebLinkTarget("selfCompact")
+	// WebLinkTargetSelfTall indicates that the web page should be opened in the current conversation window, with a
+	// tall size.
+	WebLinkTargetSelfTall = WebLinkTarget("selfTall")
+)
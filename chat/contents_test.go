@@ -0,0 +1,184 @@
+package chat
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/takenet/lime-go"
+	"testing"
+)
+
+func createSelectMessage() *lime.Message {
+	one := lime.TextDocument("1")
+	msg := &lime.Message{}
+	msg.ID = "4609d0a3-00eb-4e16-9d44-27d115c6eb31"
+	msg.SetToString("golang@limeprotocol.org/default")
+	msg.SetContent(&Select{
+		Scope: SelectScopeImmediate,
+		Text:  "Choose an option",
+		Options: []SelectOption{
+			{Order: 1, Text: "First option", Value: &one},
+			{Order: 2, Text: "Second option", Value: &lime.JsonDocument{"key": "value"}},
+			{Text: "Third option"},
+		},
+	})
+	return msg
+}
+
+func createInputMessage() *lime.Message {
+	label := lime.TextDocument("What is your name?")
+	t := lime.MediaTypeTextPlain()
+	msg := &lime.Message{}
+	msg.ID = "4609d0a3-00eb-4e16-9d44-27d115c6eb31"
+	msg.SetToString("golang@limeprotocol.org/default")
+	msg.SetContent(&Input{
+		Label: lime.NewDocumentContainer(&label),
+		Validation: &InputValidation{
+			Rule: InputValidationRuleType,
+			Type: &t,
+		},
+	})
+	return msg
+}
+
+func createMediaLinkMessage() *lime.Message {
+	imageType := lime.MediaType{Type: "image", Subtype: "jpeg"}
+	msg := &lime.Message{}
+	msg.ID = "4609d0a3-00eb-4e16-9d44-27d115c6eb31"
+	msg.SetToString("golang@limeprotocol.org/default")
+	msg.SetContent(&MediaLink{
+		Type:        &imageType,
+		Size:        3124,
+		URI:         "https://limeprotocol.org/images/logo.jpg",
+		PreviewURI:  "https://limeprotocol.org/images/logo-small.jpg",
+		PreviewType: &imageType,
+		Title:       "Lime logo",
+		Text:        "The protocol logo",
+	})
+	return msg
+}
+
+func createWebLinkMessage() *lime.Message {
+	msg := &lime.Message{}
+	msg.ID = "4609d0a3-00eb-4e16-9d44-27d115c6eb31"
+	msg.SetToString("golang@limeprotocol.org/default")
+	msg.SetContent(&WebLink{
+		URI:        "https://limeprotocol.org",
+		PreviewURI: "https://limeprotocol.org/images/logo-small.jpg",
+		Title:      "Lime protocol",
+		Text:       "The protocol website",
+		Target:     WebLinkTargetBlank,
+	})
+	return msg
+}
+
+func TestSelect_MarshalJSON(t *testing.T) {
+	// Arrange
+	msg := createSelectMessage()
+
+	// Act
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	assert.JSONEq(t, `{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"application/vnd.lime.select+json","content":{"scope":"immediate","text":"Choose an option","options":[{"order":1,"text":"First option","type":"text/plain","value":"1"},{"order":2,"text":"Second option","type":"application/json","value":{"key":"value"}},{"text":"Third option"}]}}`, string(b))
+}
+
+func TestSelect_UnmarshalJSON(t *testing.T) {
+	// Arrange
+	RegisterChatDocuments()
+	j := []byte(`{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"application/vnd.lime.select+json","content":{"scope":"immediate","text":"Choose an option","options":[{"order":1,"text":"First option","type":"text/plain","value":"1"},{"order":2,"text":"Second option","type":"application/json","value":{"key":"value"}},{"text":"Third option"}]}}`)
+	var msg lime.Message
+
+	// Act
+	err := json.Unmarshal(j, &msg)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, createSelectMessage(), &msg)
+}
+
+func TestInput_MarshalJSON(t *testing.T) {
+	// Arrange
+	msg := createInputMessage()
+
+	// Act
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	assert.JSONEq(t, `{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"application/vnd.lime.input+json","content":{"label":{"type":"text/plain","value":"What is your name?"},"validation":{"rule":"type","type":"text/plain"}}}`, string(b))
+}
+
+func TestInput_UnmarshalJSON(t *testing.T) {
+	// Arrange
+	RegisterChatDocuments()
+	j := []byte(`{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"application/vnd.lime.input+json","content":{"label":{"type":"text/plain","value":"What is your name?"},"validation":{"rule":"type","type":"text/plain"}}}`)
+	var msg lime.Message
+
+	// Act
+	err := json.Unmarshal(j, &msg)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, createInputMessage(), &msg)
+}
+
+func TestMediaLink_MarshalJSON(t *testing.T) {
+	// Arrange
+	msg := createMediaLinkMessage()
+
+	// Act
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	assert.JSONEq(t, `{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"application/vnd.lime.media-link+json","content":{"type":"image/jpeg","size":3124,"uri":"https://limeprotocol.org/images/logo.jpg","previewUri":"https://limeprotocol.org/images/logo-small.jpg","previewType":"image/jpeg","title":"Lime logo","text":"The protocol logo"}}`, string(b))
+}
+
+func TestMediaLink_UnmarshalJSON(t *testing.T) {
+	// Arrange
+	RegisterChatDocuments()
+	j := []byte(`{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"application/vnd.lime.media-link+json","content":{"type":"image/jpeg","size":3124,"uri":"https://limeprotocol.org/images/logo.jpg","previewUri":"https://limeprotocol.org/images/logo-small.jpg","previewType":"image/jpeg","title":"Lime logo","text":"The protocol logo"}}`)
+	var msg lime.Message
+
+	// Act
+	err := json.Unmarshal(j, &msg)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, createMediaLinkMessage(), &msg)
+}
+
+func TestWebLink_MarshalJSON(t *testing.T) {
+	// Arrange
+	msg := createWebLinkMessage()
+
+	// Act
+	b, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	assert.JSONEq(t, `{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"application/vnd.lime.web-link+json","content":{"uri":"https://limeprotocol.org","previewUri":"https://limeprotocol.org/images/logo-small.jpg","title":"Lime protocol","text":"The protocol website","target":"blank"}}`, string(b))
+}
+
+func TestWebLink_UnmarshalJSON(t *testing.T) {
+	// Arrange
+	RegisterChatDocuments()
+	j := []byte(`{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"application/vnd.lime.web-link+json","content":{"uri":"https://limeprotocol.org","previewUri":"https://limeprotocol.org/images/logo-small.jpg","title":"Lime protocol","text":"The protocol website","target":"blank"}}`)
+	var msg lime.Message
+
+	// Act
+	err := json.Unmarshal(j, &msg)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, createWebLinkMessage(), &msg)
+}
@@ -50,6 +50,8 @@ type contact struct {
 // Account represents a user account information.
 type Account struct {
 	contact
+	// The user's name.
+	Name string `json:"name,omitempty"`
 	// The user's full name.
 	FullName string `json:"fullName,omitempty"`
 	// Indicates that the account is temporary is valid only in the current session.
@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/takenet/lime-go"
+	"testing"
+)
+
+func createAccount() *Account {
+	a := &Account{Name: "John Doe"}
+	a.Address = "Main street"
+	a.City = "Belo Horizonte"
+	a.Extras = map[string]string{"plan": "premium"}
+	return a
+}
+
+func createGetAccountResponse() *lime.ResponseCommand {
+	c := &lime.ResponseCommand{}
+	c.ID = "4609d0a3-00eb-4e16-9d44-27d115c6eb31"
+	c.SetFromString("postmaster@limeprotocol.org/#server1")
+	c.SetToString("golang@limeprotocol.org/default")
+	c.Method = lime.CommandMethodGet
+	c.Status = lime.CommandStatusSuccess
+	c.SetResource(createAccount())
+	return c
+}
+
+func TestAccount_MarshalJSON(t *testing.T) {
+	// Arrange
+	c := createGetAccountResponse()
+
+	// Act
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	assert.JSONEq(t, `{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","from":"postmaster@limeprotocol.org/#server1","to":"golang@limeprotocol.org/default","method":"get","status":"success","type":"application/vnd.lime.account+json","resource":{"name":"John Doe","address":"Main street","city":"Belo Horizonte","extras":{"plan":"premium"}}}`, string(b))
+}
+
+func TestAccount_UnmarshalJSON(t *testing.T) {
+	// Arrange
+	RegisterChatDocuments()
+	j := []byte(`{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","from":"postmaster@limeprotocol.org/#server1","to":"golang@limeprotocol.org/default","method":"get","status":"success","type":"application/vnd.lime.account+json","resource":{"name":"John Doe","address":"Main street","city":"Belo Horizonte","extras":{"plan":"premium"}}}`)
+	var c lime.ResponseCommand
+
+	// Act
+	err := json.Unmarshal(j, &c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, createGetAccountResponse(), &c)
+	a, err := lime.ResourceAs[*Account](&c)
+	assert.NoError(t, err)
+	assert.Equal(t, "John Doe", a.Name)
+}
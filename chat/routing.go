@@ -0,0 +1,144 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"github.com/takenet/lime-go"
+	"go.uber.org/multierr"
+	"strings"
+	"sync"
+)
+
+// PresenceStore holds the presences of the nodes of a server, which define the routing rules of its sessions.
+// It is safe for concurrent use.
+type PresenceStore struct {
+	presences map[lime.Node]*Presence
+	mu        sync.RWMutex
+}
+
+// NewPresenceStore creates a new instance of the PresenceStore type.
+func NewPresenceStore() *PresenceStore {
+	return &PresenceStore{presences: make(map[lime.Node]*Presence)}
+}
+
+// Set stores the presence of the specified node, replacing the previous one.
+func (s *PresenceStore) Set(n lime.Node, p *Presence) {
+	if p == nil {
+		panic("nil presence")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.presences[n] = p
+}
+
+// Get returns the presence of the specified node.
+func (s *PresenceStore) Get(n lime.Node) (*Presence, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.presences[n]
+	return p, ok
+}
+
+// Remove removes the presence of the specified node.
+// It is usually called by the lime.ServerConfig.Finished callback.
+func (s *PresenceStore) Remove(n lime.Node) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.presences, n)
+}
+
+// RoutingRule returns the routing rule of the presence of the specified node.
+// If the node has no presence or its presence doesn't define a rule, the RoutingRuleInstance value is returned.
+func (s *PresenceStore) RoutingRule(n lime.Node) RoutingRule {
+	if p, ok := s.Get(n); ok && p.RoutingRule != "" {
+		return p.RoutingRule
+	}
+	return RoutingRuleInstance
+}
+
+// Router delivers the envelopes to the established sessions of a server, applying the routing rules of the node
+// presences. The envelopes addressed to an instance are delivered to its session, while the ones addressed to an
+// identity or domain are delivered to all the sessions whose routing rule accepts the destination.
+type Router struct {
+	sessions  lime.SessionStore
+	presences *PresenceStore
+}
+
+// NewRouter creates a new instance of the Router type.
+func NewRouter(sessions lime.SessionStore, presences *PresenceStore) *Router {
+	if sessions == nil {
+		panic("nil sessions")
+	}
+	if presences == nil {
+		panic("nil presences")
+	}
+	return &Router{sessions: sessions, presences: presences}
+}
+
+// Route returns the session channels that should receive the envelopes addressed to the specified node.
+func (r *Router) Route(to lime.Node) []*lime.ServerChannel {
+	var channels []*lime.ServerChannel
+	for _, c := range r.sessions.All() {
+		n := c.RemoteNode()
+		if acceptsRoute(r.presences.RoutingRule(n), n, to) {
+			channels = append(channels, c)
+		}
+	}
+	return channels
+}
+
+// SendMessage delivers the message to the sessions of its destination.
+// An error that wraps lime.ErrRouteNotFound is returned if no session accepts the destination.
+func (r *Router) SendMessage(ctx context.Context, msg *lime.Message) error {
+	return r.send(ctx, msg.To, func(c *lime.ServerChannel) error {
+		return c.SendMessage(ctx, msg)
+	})
+}
+
+// SendNotification delivers the notification to the sessions of its destination.
+// An error that wraps lime.ErrRouteNotFound is returned if no session accepts the destination.
+func (r *Router) SendNotification(ctx context.Context, not *lime.Notification) error {
+	return r.send(ctx, not.To, func(c *lime.ServerChannel) error {
+		return c.SendNotification(ctx, not)
+	})
+}
+
+func (r *Router) send(ctx context.Context, to lime.Node, f func(c *lime.ServerChannel) error) error {
+	channels := r.Route(to)
+	if len(channels) == 0 {
+		return fmt.Errorf("route to '%v': %w", to, lime.ErrRouteNotFound)
+	}
+	var err error
+	for _, c := range channels {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return multierr.Append(err, ctxErr)
+		}
+		if sendErr := f(c); sendErr != nil {
+			err = multierr.Append(err, fmt.Errorf("route to '%v': %w", c.RemoteNode(), sendErr))
+		}
+	}
+	return err
+}
+
+// acceptsRoute indicates if a session of the node with the specified routing rule should receive the envelopes
+// addressed to the destination.
+func acceptsRoute(rule RoutingRule, n lime.Node, to lime.Node) bool {
+	if to == n {
+		return true
+	}
+	switch {
+	case to.Name != "" && to.Instance == "":
+		// Addressed to the identity
+		return rule == RoutingRuleIdentity && to.Identity == n.Identity
+	case to.Name == "" && to.Domain != "":
+		// Addressed to the domain
+		switch rule {
+		case RoutingRuleDomain:
+			return strings.EqualFold(to.Domain, n.Domain)
+		case RoutingRuleRootDomain:
+			return strings.EqualFold(to.Domain, n.Domain) ||
+				strings.HasSuffix(strings.ToLower(to.Domain), "."+strings.ToLower(n.Domain))
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package chat
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/takenet/lime-go"
+	"go.uber.org/goleak"
+	"golang.org/x/sync/errgroup"
+	"testing"
+	"time"
+)
+
+func establishInstanceChannel(ctx context.Context, t testing.TB, addr lime.InProcessAddr, name string, instance string) *lime.ClientChannel {
+	client, err := lime.DialInProcess(addr, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel := lime.NewClientChannel(client, 1)
+	_, err = channel.EstablishSession(
+		ctx,
+		func([]lime.SessionCompression) lime.SessionCompression {
+			return lime.SessionCompressionNone
+		},
+		func([]lime.SessionEncryption) lime.SessionEncryption {
+			return lime.SessionEncryptionNone
+		},
+		lime.Identity{Name: name, Domain: "localhost"},
+		func([]lime.AuthenticationScheme, lime.Authentication) lime.Authentication {
+			return &lime.GuestAuthentication{}
+		},
+		instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return channel
+}
+
+func TestAcceptsRoute(t *testing.T) {
+	// Arrange
+	n := lime.Node{Identity: lime.Identity{Name: "golang", Domain: "limeprotocol.org"}, Instance: "home"}
+	cases := []struct {
+		rule     RoutingRule
+		to       lime.Node
+		expected bool
+	}{
+		{RoutingRuleInstance, n, true},
+		{RoutingRuleInstance, lime.Node{Identity: n.Identity}, false},
+		{RoutingRuleIdentity, lime.Node{Identity: n.Identity}, true},
+		{RoutingRuleIdentity, lime.Node{Identity: n.Identity, Instance: "work"}, false},
+		{RoutingRuleIdentity, lime.Node{Identity: lime.Identity{Name: "csharp", Domain: "limeprotocol.org"}}, false},
+		{RoutingRuleIdentity, lime.Node{Identity: lime.Identity{Domain: "limeprotocol.org"}}, false},
+		{RoutingRuleDomain, lime.Node{Identity: lime.Identity{Domain: "limeprotocol.org"}}, true},
+		{RoutingRuleDomain, lime.Node{Identity: lime.Identity{Domain: "chat.limeprotocol.org"}}, false},
+		{RoutingRuleRootDomain, lime.Node{Identity: lime.Identity{Domain: "chat.limeprotocol.org"}}, true},
+		{RoutingRuleRootDomain, lime.Node{Identity: lime.Identity{Domain: "otherlimeprotocol.org"}}, false},
+	}
+
+	for _, c := range cases {
+		// Act
+		actual := acceptsRoute(c.rule, n, c.to)
+
+		// Assert
+		assert.Equal(t, c.expected, actual, "rule %v to %v", c.rule, c.to)
+	}
+}
+
+func TestRouter_SendMessage_WithInstancesRoutingRules(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := lime.InProcessAddr("localhost")
+	srv := lime.NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Build()
+	defer func() { _ = srv.Close() }()
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	// The guest identities should be unique ids
+	name := lime.NewEnvelopeID()
+	home := establishInstanceChannel(ctx, t, addr1, name, "home")
+	defer func() { _ = home.Close() }()
+	work := establishInstanceChannel(ctx, t, addr1, name, "work")
+	defer func() { _ = work.Close() }()
+	presences := NewPresenceStore()
+	presences.Set(home.LocalNode(), &Presence{Status: PresenceStatusAvailable, RoutingRule: RoutingRuleIdentity})
+	presences.Set(work.LocalNode(), &Presence{Status: PresenceStatusAvailable, RoutingRule: RoutingRuleInstance})
+	router := NewRouter(srv.SessionStore(), presences)
+	var content lime.TextDocument = "Hello world"
+	identityMsg := &lime.Message{}
+	identityMsg.ID = lime.NewEnvelopeID()
+	identityMsg.To = lime.Node{Identity: home.LocalNode().Identity}
+	identityMsg.SetContent(&content)
+	instanceMsg := &lime.Message{}
+	instanceMsg.ID = lime.NewEnvelopeID()
+	instanceMsg.To = work.LocalNode()
+	instanceMsg.SetContent(&content)
+
+	// Act
+	identityErr := router.SendMessage(ctx, identityMsg)
+	instanceErr := router.SendMessage(ctx, instanceMsg)
+
+	// Assert
+	assert.NoError(t, identityErr)
+	assert.NoError(t, instanceErr)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive message timeout")
+	case actual := <-home.MsgChan():
+		assert.Equal(t, identityMsg.ID, actual.ID)
+	}
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive message timeout")
+	case actual := <-work.MsgChan():
+		assert.Equal(t, instanceMsg.ID, actual.ID)
+	}
+	assert.Len(t, home.MsgChan(), 0)
+	assert.Len(t, work.MsgChan(), 0)
+}
+
+func TestRouter_SendMessage_WhenNoSessionAcceptsTheDestination(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	router := NewRouter(lime.NewMemorySessionStore(), NewPresenceStore())
+	msg := &lime.Message{}
+	msg.ID = lime.NewEnvelopeID()
+	msg.To = lime.Node{Identity: lime.Identity{Name: "golang", Domain: "localhost"}}
+
+	// Act
+	err := router.SendMessage(ctx, msg)
+
+	// Assert
+	assert.ErrorIs(t, err, lime.ErrRouteNotFound)
+}
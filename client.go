@@ -7,7 +7,7 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"log"
-	"math"
+	"math/rand"
 	"net"
 	"net/http"
 	"os"
@@ -29,6 +29,54 @@ type Client struct {
 	lock    chan struct{}      // lock is used as a mutex for channel lifetime handling operations
 	cancel  context.CancelFunc // cancel stops the channel listener goroutine
 	done    chan bool          // done is used by the listener goroutine to signal its end
+	state   ClientState
+	stateMu sync.Mutex
+
+	watchdogCancel context.CancelFunc // watchdogCancel stops the watchdog goroutine, if enabled
+	watchdogDone   chan struct{}      // watchdogDone is closed by the watchdog goroutine on its end
+	watchdogMu     sync.Mutex
+
+	sendQueue   chan *Message      // sendQueue holds the messages enqueued for sending, if enabled
+	sendCancel  context.CancelFunc // sendCancel stops the send queue goroutine
+	sendDone    chan struct{}      // sendDone is closed by the send queue goroutine on its end
+	sendClosing chan struct{}      // sendClosing is closed when the client starts closing, for releasing blocked enqueuers
+	sendClosed  bool               // sendClosed indicates that the send queue doesn't accept messages anymore
+	sendMu      sync.RWMutex       // sendMu makes the enqueuing and the closing of the send queue exclusive
+	sendStop    sync.Once          // sendStop ensures that the send queue is stopped only once
+
+	offline       []*Message // offline holds the messages sent while the session is not established, if enabled
+	offlineClosed bool       // offlineClosed indicates that the offline buffer doesn't accept messages anymore
+	offlineMu     sync.Mutex
+
+	rnd *rand.Rand // rnd is the source of the reconnection intervals randomization
+}
+
+// ClientState represents the connection state of a Client with the server.
+type ClientState int
+
+const (
+	// ClientStateDisconnected indicates that the client doesn't have an established session with the server.
+	ClientStateDisconnected = ClientState(iota)
+	// ClientStateConnecting indicates that the client is trying to establish a session with the server.
+	ClientStateConnecting
+	// ClientStateEstablished indicates that the client has an established session with the server.
+	ClientStateEstablished
+	// ClientStateClosed indicates that the client was closed.
+	ClientStateClosed
+)
+
+func (s ClientState) String() string {
+	switch s {
+	case ClientStateDisconnected:
+		return "disconnected"
+	case ClientStateConnecting:
+		return "connecting"
+	case ClientStateEstablished:
+		return "established"
+	case ClientStateClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
 }
 
 // NewClient creates a new instance of the Client type.
@@ -43,6 +91,10 @@ func NewClient(config *ClientConfig, mux *EnvelopeMux) *Client {
 		config: config,
 		mux:    mux,
 		lock:   make(chan struct{}, 1),
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if config.SendQueueSize > 0 {
+		c.startSender()
 	}
 	c.startListener()
 	return c
@@ -55,9 +107,60 @@ func (c *Client) Establish(ctx context.Context) error {
 	return err
 }
 
+// Channel returns the current established channel of the client, allowing advanced operations like reading the
+// negotiated session options. It returns false if there is no established channel, like during a reconnection.
+// Note that the returned channel may be replaced by a new one in case of reconnection, so it should not be retained.
+func (c *Client) Channel() (*ClientChannel, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.channel == nil || !c.channel.Established() {
+		return nil, false
+	}
+	return c.channel, true
+}
+
+// State returns the current connection state of the client.
+func (c *Client) State() ClientState {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.state
+}
+
+func (c *Client) setState(state ClientState) {
+	c.stateMu.Lock()
+	old := c.state
+	if old == state {
+		c.stateMu.Unlock()
+		return
+	}
+	c.state = state
+	c.stateMu.Unlock()
+
+	if c.config.OnStateChange != nil {
+		c.config.OnStateChange(old, state)
+	}
+}
+
+// defaultCloseTimeout is the maximum duration of the graceful session finishing by the Close method.
+const defaultCloseTimeout = 5 * time.Second
+
 // Close stops the listener and finishes any established session with the server.
+// It awaits up to 5 seconds for the session finishing, closing the transport after that.
 func (c *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCloseTimeout)
+	defer cancel()
+	return c.CloseWithContext(ctx)
+}
+
+// CloseWithContext stops the listener and finishes any established session with the server.
+// If the session can't be finished gracefully before the context is done, the transport is closed and the finishing
+// error is returned. In any case, the client is closed when the method returns.
+func (c *Client) CloseWithContext(ctx context.Context) error {
+	c.stopWatchdog()
+	c.stopSender()
 	c.stopListener()
+	c.discardOffline()
+	defer c.setState(ClientStateClosed)
 
 	if c.channel == nil {
 		return nil
@@ -74,9 +177,10 @@ func (c *Client) Close() error {
 
 	if c.channel.Established() {
 		// Try to close the session gracefully
-		ctx, cancelFunc := context.WithTimeout(context.Background(), time.Second*5)
-		defer cancelFunc()
 		_, err := c.channel.FinishSession(ctx)
+		if err != nil {
+			_ = c.channel.Close()
+		}
 		c.channel = nil
 		return err
 	}
@@ -89,7 +193,12 @@ func (c *Client) Close() error {
 // SendMessage asynchronously sends a Message to the server.
 // The server may route the Message to another node, accordingly to the specified destination address.
 // It may also send back one or more Notification envelopes, containing status about the Message.
+// If the offline buffer is enabled and the session is not established, like during a reconnection, the Message is
+// buffered for sending after the establishment and the call returns right away.
 func (c *Client) SendMessage(ctx context.Context, msg *Message) error {
+	if c.config.OfflineBufferSize > 0 && c.bufferOffline(msg) {
+		return nil
+	}
 	channel, err := c.getOrBuildChannel(ctx)
 	if err != nil {
 		return err
@@ -97,6 +206,20 @@ func (c *Client) SendMessage(ctx context.Context, msg *Message) error {
 	return channel.SendMessage(ctx, msg)
 }
 
+// TrySendMessage attempts to send a Message to the server without blocking, returning false if it is not possible
+// right away, like when the session is not established or another envelope is being sent.
+// If the offline buffer is enabled and the session is not established, the Message is buffered and true is returned.
+func (c *Client) TrySendMessage(ctx context.Context, msg *Message) (bool, error) {
+	if c.config.OfflineBufferSize > 0 && c.bufferOffline(msg) {
+		return true, nil
+	}
+	channel, ok := c.Channel()
+	if !ok {
+		return false, nil
+	}
+	return channel.TrySendMessage(ctx, msg)
+}
+
 // SendNotification asynchronously sends a Notification to the server.
 // The server may route the Notification to another node, accordingly to the specified destination address.
 func (c *Client) SendNotification(ctx context.Context, not *Notification) error {
@@ -128,6 +251,16 @@ func (c *Client) ProcessCommand(ctx context.Context, cmd *RequestCommand) (*Resp
 	return channel.ProcessCommand(ctx, cmd)
 }
 
+// SendRequestCommandFuture sends a RequestCommand to the server, returning a CommandFuture for awaiting the
+// corresponding ResponseCommand later. Note that the response is lost if the client reconnects in the meantime.
+func (c *Client) SendRequestCommandFuture(ctx context.Context, cmd *RequestCommand) (*CommandFuture, error) {
+	channel, err := c.getOrBuildChannel(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return channel.SendRequestCommandFuture(ctx, cmd)
+}
+
 func (c *Client) channelOK() bool {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -158,7 +291,8 @@ func (c *Client) getOrBuildChannel(ctx context.Context) (*ClientChannel, error)
 		return c.channel, nil
 	}
 
-	count := 0.0
+	count := 0
+	c.setState(ClientStateConnecting)
 
 	for ctx.Err() == nil {
 		if c.channel != nil {
@@ -172,18 +306,23 @@ func (c *Client) getOrBuildChannel(ctx context.Context) (*ClientChannel, error)
 
 		channel, err := c.buildChannel(ctx)
 		if err == nil {
-			c.mu.Lock()
-			c.channel = channel
-			c.mu.Unlock()
+			// The callback is called before the offline messages are sent, so the downstream state is initialized
+			// before them
+			if c.config.OnReestablished != nil {
+				c.config.OnReestablished(channel)
+			}
+			c.setChannel(ctx, channel)
+			c.setState(ClientStateEstablished)
 			return channel, nil
 		}
 
-		interval := time.Duration(math.Pow(count, 2)*100) * time.Millisecond
+		interval := reconnectInterval(count, c.config.ReconnectJitter, c.rnd)
 		log.Printf("build channel error on attempt %v, sleeping %v ms: %v", count, interval, err)
 		time.Sleep(interval)
 		count++
 	}
 
+	c.setState(ClientStateDisconnected)
 	return nil, fmt.Errorf("client: getOrBuildChannel: %w", ctx.Err())
 }
 
@@ -208,6 +347,7 @@ func (c *Client) startListener() {
 				}
 				log.Printf("client: listen: %v", err)
 			}
+			c.setState(ClientStateDisconnected)
 		}
 	}()
 }
@@ -216,7 +356,6 @@ func (c *Client) stopListener() {
 	if c.cancel != nil {
 		c.cancel()
 		<-c.done
-		c.cancel = nil
 	}
 }
 
@@ -227,11 +366,23 @@ func (c *Client) buildChannel(ctx context.Context) (*ClientChannel, error) {
 	}
 
 	channel := NewClientChannel(transport, c.config.ChannelBufferSize)
+	channel.validateEnvs = c.config.ValidateEnvelopes
+	channel.fillFrom = c.config.FillFromAddress
+	channel.correlationKey = c.config.CorrelationKey
+	channel.signer = c.config.Signer
+	channel.stepTimeout = c.config.HandshakeStepTimeout
+	if c.config.MaxInFlightCommands > 0 {
+		channel.processingSlots = make(chan struct{}, c.config.MaxInFlightCommands)
+	}
+	identity := c.config.Node.Identity
+	if c.config.EphemeralIdentity {
+		identity.Name = uuid.NewString()
+	}
 	ses, err := channel.EstablishSession(
 		ctx,
 		c.config.CompSelector,
 		c.config.EncryptSelector,
-		c.config.Node.Identity,
+		identity,
 		c.config.Authenticator,
 		c.config.Node.Instance,
 	)
@@ -240,7 +391,7 @@ func (c *Client) buildChannel(ctx context.Context) (*ClientChannel, error) {
 	}
 
 	if ses.State != SessionStateEstablished {
-		return nil, fmt.Errorf("buildChannel: channel state is %v", ses.State)
+		return nil, fmt.Errorf("buildChannel: %w", newEstablishFailure(channel.establishStep, ses))
 	}
 
 	return channel, nil
@@ -263,6 +414,63 @@ type ClientConfig struct {
 	// Authenticator is called during the session authentication and allows the client to provide its credentials
 	// during the process.
 	Authenticator Authenticator
+	// ValidateEnvelopes indicates if the addressing of the outgoing envelopes should be validated before sending.
+	// If enabled, messages and commands without the destination address are rejected.
+	ValidateEnvelopes bool
+	// FillFromAddress indicates if the node assigned to the session should be set as the originator address of the
+	// outgoing envelopes that don't have it. Note that the envelopes are changed by the sending methods.
+	FillFromAddress bool
+	// MaxInFlightCommands defines the maximum number of commands that can be awaiting for a response at the same time
+	// through the ProcessCommand method. When the limit is reached, the calls are blocked until a response is received
+	// or the context is canceled. A zero value means no limit.
+	MaxInFlightCommands int
+	// SendQueueSize defines the capacity of the queue used by the EnqueueMessage method.
+	// When the queue is full, the calls are blocked until there's space or the context is canceled.
+	// A zero value disables the queue.
+	SendQueueSize int
+	// SendTimeout defines the maximum duration for sending each enqueued message, including the time awaiting for the
+	// session establishment. A zero value means no limit.
+	SendTimeout time.Duration
+	// OnSendError is called when an enqueued message could not be sent, including the messages that are still in the
+	// queue when the client is closed.
+	// The function is called synchronously by the goroutine that is sending the messages, so it should not block.
+	OnSendError func(msg *Message, err error)
+	// OfflineBufferSize defines the maximum number of messages that are held by the client while the session is not
+	// established, like during a reconnection. The buffered messages are sent in order right after the session
+	// establishment. When the buffer is full, the oldest message is dropped. A zero value disables the buffer.
+	OfflineBufferSize int
+	// OnOfflineDrop is called when a message of the offline buffer is dropped, with the ErrOfflineBufferOverflow
+	// error on overflow, or when it could not be sent after the establishment.
+	// The function is called while holding the buffer lock, so it should not block.
+	OnOfflineDrop func(msg *Message, err error)
+	// CorrelationKey is the metadata key used for propagating correlation ids, for distributed tracing.
+	// If defined, the id set in the context through the ContextWithCorrelationID function is added to the outgoing
+	// envelopes and the ids found in the received envelopes are available to the handlers.
+	CorrelationKey string
+	// Signer signs the outgoing messages, notifications and commands, placing the signature in the envelope metadata,
+	// allowing the server to verify its originator.
+	Signer Signer
+	// ReconnectJitter defines the randomization of the intervals between the session establishment attempts, which
+	// avoids many clients reconnecting at the same time. The default is ReconnectJitterNone.
+	ReconnectJitter ReconnectJitter
+	// HandshakeStepTimeout defines the maximum duration of each session establishment step, like the negotiation and
+	// the authentication, allowing the client to fail fast when the server stops responding in the middle of the
+	// handshake. A zero value means that the steps are limited only by the establishment context.
+	HandshakeStepTimeout time.Duration
+	// EphemeralIdentity indicates if a new identity name, in the UUID format, should be generated for each session
+	// establishment, including the reconnections. It is intended for the guest authentication, where the identity
+	// is anonymous and the server expects a UUID name. The configured node name is not used if enabled.
+	EphemeralIdentity bool
+	// OnStateChange is called when the client connection state changes.
+	// The function is called synchronously by the goroutine that is handling the session lifetime, so it should not
+	// block.
+	OnStateChange func(old, new ClientState)
+	// OnReestablished is called each time a new session is established with the server, including the first one
+	// and the ones after the reconnections, allowing the re-initialization of the state that depends on the session,
+	// like presence or subscriptions. It is called before the messages of the offline buffer are sent.
+	// The function is called synchronously by the goroutine that is establishing the session, so it should not
+	// block. The envelopes should be sent through the provided channel, since the client is not established yet.
+	OnReestablished func(channel *ClientChannel)
 }
 
 var defaultClientConfig = NewClientConfig()
@@ -283,6 +491,7 @@ func NewClientConfig() *ClientConfig {
 			Instance: instance,
 		},
 		ChannelBufferSize: runtime.NumCPU() * 32,
+		FillFromAddress:   true,
 		NewTransport: func(ctx context.Context) (Transport, error) {
 			return DialTcp(ctx, &net.TCPAddr{
 				IP:   net.IPv4(127, 0, 0, 1),
@@ -360,6 +569,20 @@ func (b *ClientBuilder) MessageHandler(handler MessageHandler) *ClientBuilder {
 	return b
 }
 
+// MessageMiddleware allows the registration of a middleware that wraps the handling of all received messages.
+// The middlewares are executed in the registration order.
+func (b *ClientBuilder) MessageMiddleware(middleware MessageMiddleware) *ClientBuilder {
+	b.mux.MessageMiddleware(middleware)
+	return b
+}
+
+// DisablePanicRecovery disables the recovery from panics in the handlers, which are recovered by default for
+// keeping the session alive. It may be useful for debugging.
+func (b *ClientBuilder) DisablePanicRecovery() *ClientBuilder {
+	b.mux.DisablePanicRecovery()
+	return b
+}
+
 // NotificationHandlerFunc allows the registration of a function for handling received notifications that matches
 // the specified predicate. Note that the registration order matters, since the receiving process stops when
 // the first predicate match occurs.
@@ -404,6 +627,13 @@ func (b *ClientBuilder) RequestCommandHandler(handler RequestCommandHandler) *Cl
 	return b
 }
 
+// RequestCommandRouter allows the registration of a CommandRouter for handling received commands that matches its
+// routes. Note that the registration order matters, since the receiving process stops when the first match occurs.
+func (b *ClientBuilder) RequestCommandRouter(router *CommandRouter) *ClientBuilder {
+	b.mux.RequestCommandRouter(router)
+	return b
+}
+
 // AutoReplyPings adds a RequestCommandHandler handler to automatically reply ping requests from the remote node.
 func (b *ClientBuilder) AutoReplyPings() *ClientBuilder {
 	return b.RequestCommandHandlerFunc(
@@ -417,6 +647,12 @@ func (b *ClientBuilder) AutoReplyPings() *ClientBuilder {
 		})
 }
 
+// AutoNotifyFailed adds a MessageMiddleware to automatically send a 'failed' notification to the sender of a message
+// when its handler returns a ReasonError. The notification reason is obtained from the error, which is not propagated.
+func (b *ClientBuilder) AutoNotifyFailed() *ClientBuilder {
+	return b.MessageMiddleware(notifyFailedMiddleware)
+}
+
 // ResponseCommandHandlerFunc allows the registration of a function for handling received commands that matches
 // the specified predicate. Note that the registration order matters, since the receiving process stops when
 // the first predicate match occurs.
@@ -447,6 +683,15 @@ func (b *ClientBuilder) UseTCP(addr net.Addr, config *TCPConfig) *ClientBuilder
 	return b
 }
 
+// UseUnix configures the client to connect to the server through the Unix domain socket of the specified path, with
+// the TCP transport configuration.
+func (b *ClientBuilder) UseUnix(path string, config *TCPConfig) *ClientBuilder {
+	b.config.NewTransport = func(ctx context.Context) (Transport, error) {
+		return DialUnix(ctx, path, config)
+	}
+	return b
+}
+
 // UseWebsocket adds a Websockets listener to the server, allowing receiving connections from this transport.
 func (b *ClientBuilder) UseWebsocket(urlStr string, requestHeader http.Header, tls *tls.Config) *ClientBuilder {
 	b.config.NewTransport = func(ctx context.Context) (Transport, error) {
@@ -471,6 +716,13 @@ func (b *ClientBuilder) GuestAuthentication() *ClientBuilder {
 	return b
 }
 
+// Ephemeral enables the generation of a new guest identity for each session establishment, so the reconnections
+// use a new identity. It should be used with the guest authentication, like in GuestAuthentication().Ephemeral().
+func (b *ClientBuilder) Ephemeral() *ClientBuilder {
+	b.config.EphemeralIdentity = true
+	return b
+}
+
 // TransportAuthentication enables the use of the transport authentication scheme during the session establishment with
 // the server. Note that the transport that are being used to communicate with the server will be asked to present the
 // credentials, and the form of passing the credentials may vary depending on the transport type. For instance, in
@@ -534,6 +786,95 @@ func (b *ClientBuilder) ChannelBufferSize(bufferSize int) *ClientBuilder {
 	return b
 }
 
+// ValidateEnvelopes enables the validation of the outgoing envelopes addressing before sending.
+// Messages and commands without the destination address are rejected.
+func (b *ClientBuilder) ValidateEnvelopes() *ClientBuilder {
+	b.config.ValidateEnvelopes = true
+	return b
+}
+
+// FillFromAddress defines if the node assigned to the session should be set as the originator address of the
+// outgoing envelopes that don't have it. It is enabled by default.
+func (b *ClientBuilder) FillFromAddress(fill bool) *ClientBuilder {
+	b.config.FillFromAddress = fill
+	return b
+}
+
+// MaxInFlightCommands sets the maximum number of commands awaiting for a response at the same time.
+func (b *ClientBuilder) MaxInFlightCommands(limit int) *ClientBuilder {
+	b.config.MaxInFlightCommands = limit
+	return b
+}
+
+// CorrelationKey sets the metadata key used for propagating correlation ids.
+func (b *ClientBuilder) CorrelationKey(key string) *ClientBuilder {
+	b.config.CorrelationKey = key
+	return b
+}
+
+// Signer sets the Signer for the outgoing envelopes.
+func (b *ClientBuilder) Signer(signer Signer) *ClientBuilder {
+	b.config.Signer = signer
+	return b
+}
+
+// SendQueue enables the queue used by the EnqueueMessage method, with the specified capacity.
+func (b *ClientBuilder) SendQueue(size int) *ClientBuilder {
+	b.config.SendQueueSize = size
+	return b
+}
+
+// SendTimeout sets the maximum duration for sending each enqueued message.
+func (b *ClientBuilder) SendTimeout(timeout time.Duration) *ClientBuilder {
+	b.config.SendTimeout = timeout
+	return b
+}
+
+// OnSendError sets a function to be called when an enqueued message could not be sent.
+func (b *ClientBuilder) OnSendError(onSendError func(msg *Message, err error)) *ClientBuilder {
+	b.config.OnSendError = onSendError
+	return b
+}
+
+// OfflineBuffer enables the buffering of the messages sent while the session is not established, with the specified
+// capacity.
+func (b *ClientBuilder) OfflineBuffer(size int) *ClientBuilder {
+	b.config.OfflineBufferSize = size
+	return b
+}
+
+// OnOfflineDrop sets a function to be called when a message of the offline buffer is dropped.
+func (b *ClientBuilder) OnOfflineDrop(onOfflineDrop func(msg *Message, err error)) *ClientBuilder {
+	b.config.OnOfflineDrop = onOfflineDrop
+	return b
+}
+
+// ReconnectJitter sets the randomization of the intervals between the session establishment attempts.
+func (b *ClientBuilder) ReconnectJitter(jitter ReconnectJitter) *ClientBuilder {
+	b.config.ReconnectJitter = jitter
+	return b
+}
+
+// HandshakeStepTimeout sets the maximum duration of each session establishment step.
+func (b *ClientBuilder) HandshakeStepTimeout(timeout time.Duration) *ClientBuilder {
+	b.config.HandshakeStepTimeout = timeout
+	return b
+}
+
+// OnStateChange sets a function to be called when the client connection state changes.
+// The function is called synchronously and should not block.
+func (b *ClientBuilder) OnStateChange(onStateChange func(old, new ClientState)) *ClientBuilder {
+	b.config.OnStateChange = onStateChange
+	return b
+}
+
+// OnReestablished sets a function to be called each time a new session is established, including the reconnections.
+// The function is called synchronously and should not block.
+func (b *ClientBuilder) OnReestablished(onReestablished func(channel *ClientChannel)) *ClientBuilder {
+	b.config.OnReestablished = onReestablished
+	return b
+}
+
 // Build creates a new instance of Client.
 func (b *ClientBuilder) Build() *Client {
 	return NewClient(b.config, b.mux)
@@ -2,12 +2,71 @@ package lime
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 )
 
 // ClientChannel implements the client-side communication channel in a Lime session.
 type ClientChannel struct {
 	*channel
+	establishStep EstablishStep // establishStep is the current step of the session establishment
+	// stepTimeout is the maximum duration of each session establishment step, if greater than zero
+	stepTimeout time.Duration
+}
+
+// EstablishStep identifies a step of the client session establishment.
+type EstablishStep string
+
+const (
+	// EstablishStepNew is the sending of the new session, which starts the session in the server.
+	EstablishStepNew = EstablishStep("new")
+	// EstablishStepNegotiation is the negotiation of the transport options, like compression and encryption.
+	EstablishStepNegotiation = EstablishStep("negotiation")
+	// EstablishStepAuthentication is the authentication of the client identity.
+	EstablishStepAuthentication = EstablishStep("authentication")
+	// EstablishStepRegistration is the registration of the client node in the server, after its authentication.
+	EstablishStepRegistration = EstablishStep("registration")
+)
+
+// EstablishError describes a failure in the session establishment, allowing the callers to decide how to handle it.
+// A failure caused by the transport, like a closed connection, has the Err value defined and may be retried, while
+// a session failed by the server, like in an authentication failure, has the Reason value defined.
+type EstablishError struct {
+	Step   EstablishStep // Step is the establishment step that failed.
+	State  SessionState  // State is the session state of the channel when the failure happened.
+	Reason *Reason       // Reason is the failure reason sent by the server, if the session was failed by it.
+	Err    error         // Err is the underlying error, if the failure was not caused by the server.
+}
+
+// newEstablishFailure creates an EstablishError for a session that was not established by the server.
+func newEstablishFailure(step EstablishStep, ses *Session) *EstablishError {
+	if ses.Reason != nil && ses.Reason.Code == ReasonCodeSessionRegistrationError {
+		step = EstablishStepRegistration
+	}
+	return &EstablishError{Step: step, State: ses.State, Reason: ses.Reason}
+}
+
+func (e *EstablishError) Error() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("establish session: %v: %v", e.Step, e.Err)
+	case e.Reason != nil:
+		return fmt.Sprintf("establish session: %v: session %v: %v", e.Step, e.State, e.Reason)
+	default:
+		return fmt.Sprintf("establish session: %v: session state is %v", e.Step, e.State)
+	}
+}
+
+// Unwrap returns the underlying error or, if the session was failed by the server, a ReasonError with its reason.
+func (e *EstablishError) Unwrap() error {
+	if e.Err != nil {
+		return e.Err
+	}
+	if e.Reason != nil {
+		return &ReasonError{Reason: e.Reason}
+	}
+	return nil
 }
 
 func NewClientChannel(t Transport, bufferSize int) *ClientChannel {
@@ -40,6 +99,27 @@ func (c *ClientChannel) receiveSessionFromServer(ctx context.Context) (*Session,
 	return ses, nil
 }
 
+// SendSession sends a session envelope to the server, allowing the implementation of custom session establishment
+// flows, like in bridges and proxies.
+// Note that this method bypasses the state validations of the EstablishSession and FinishSession methods, so the
+// caller is responsible for sending the envelopes in the expected order of the protocol. Sending an unexpected
+// session envelope usually results in the session failure by the server.
+func (c *ClientChannel) SendSession(ctx context.Context, ses *Session) error {
+	if ses == nil {
+		panic("nil session")
+	}
+	return c.sendSession(ctx, ses)
+}
+
+// ReceiveSession awaits for a session envelope from the server, updating the channel state with its values.
+// If the session is established, the channel starts receiving the other envelope types, and if it is finished
+// or failed, the transport is closed.
+// Note that after the session establishment, this method should be used only for receiving the session
+// finishing result.
+func (c *ClientChannel) ReceiveSession(ctx context.Context) (*Session, error) {
+	return c.receiveSessionFromServer(ctx)
+}
+
 // startNewSession sends a new session envelope to the server and awaits for the response.
 func (c *ClientChannel) startNewSession(ctx context.Context) (*Session, error) {
 	if err := c.ensureState(SessionStateNew, "start new session"); err != nil {
@@ -158,6 +238,10 @@ var TransportAuthenticator Authenticator = func(schemes []AuthenticationScheme,
 }
 
 // EstablishSession performs the client session negotiation and authentication handshake.
+// The failures are returned as an EstablishError value, except when the session is failed by the server, which
+// results in the returned session being in the failed state.
+// If the channel has a step timeout, each step fails with an error wrapping context.DeadlineExceeded when the server
+// doesn't reply in time.
 func (c *ClientChannel) EstablishSession(
 	ctx context.Context,
 	compSelector CompressionSelector,
@@ -174,9 +258,12 @@ func (c *ClientChannel) EstablishSession(
 		panic("channel state is not new")
 	}
 
-	ses, err := c.startNewSession(ctx)
+	c.establishStep = EstablishStepNew
+	stepCtx, cancel := c.stepContext(ctx)
+	ses, err := c.startNewSession(stepCtx)
+	cancel()
 	if err != nil {
-		return nil, fmt.Errorf("establish session: %w", err)
+		return nil, c.establishError(ctx, err)
 	}
 
 	// Session negotiation
@@ -189,34 +276,12 @@ func (c *ClientChannel) EstablishSession(
 			panic("nil encrypt selector")
 		}
 
-		// Select options
-		ses, err = c.negotiateSession(
-			ctx,
-			compSelector(ses.CompressionOptions),
-			encryptSelector(ses.EncryptionOptions))
+		c.establishStep = EstablishStepNegotiation
+		stepCtx, cancel := c.stepContext(ctx)
+		ses, err = c.negotiate(stepCtx, ses, compSelector, encryptSelector)
+		cancel()
 		if err != nil {
-			return nil, fmt.Errorf("establish session: %w", err)
-		}
-
-		if ses.State == SessionStateNegotiating {
-			if ses.Compression != "" && ses.Compression != c.transport.Compression() {
-				err = c.transport.SetCompression(ctx, ses.Compression)
-				if err != nil {
-					return nil, fmt.Errorf("establish session: set compression: %w", err)
-				}
-			}
-			if ses.Encryption != "" && ses.Encryption != c.transport.Encryption() {
-				err = c.transport.SetEncryption(ctx, ses.Encryption)
-				if err != nil {
-					return nil, fmt.Errorf("establish session: set encryption: %w", err)
-				}
-			}
-		}
-
-		// Await for authentication options
-		ses, err = c.receiveSessionFromServer(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("establish session: %w", err)
+			return nil, c.establishError(ctx, err)
 		}
 	}
 
@@ -224,14 +289,17 @@ func (c *ClientChannel) EstablishSession(
 	var roundTrip Authentication
 
 	for ses.State == SessionStateAuthenticating {
+		c.establishStep = EstablishStepAuthentication
+		stepCtx, cancel := c.stepContext(ctx)
 		ses, err = c.authenticateSession(
-			ctx,
+			stepCtx,
 			identity,
 			authenticator(ses.SchemeOptions, roundTrip),
 			instance,
 		)
+		cancel()
 		if err != nil {
-			return nil, fmt.Errorf("establish session: %w", err)
+			return nil, c.establishError(ctx, err)
 		}
 		roundTrip = ses.Authentication
 	}
@@ -239,7 +307,59 @@ func (c *ClientChannel) EstablishSession(
 	return ses, nil
 }
 
-// FinishSession performs the session finishing handshake.
+// negotiate selects the session options, applies them to the transport and awaits for the authentication options.
+func (c *ClientChannel) negotiate(
+	ctx context.Context,
+	ses *Session,
+	compSelector CompressionSelector,
+	encryptSelector EncryptionSelector,
+) (*Session, error) {
+	// Select options
+	ses, err := c.negotiateSession(
+		ctx,
+		compSelector(ses.CompressionOptions),
+		encryptSelector(ses.EncryptionOptions))
+	if err != nil {
+		return nil, err
+	}
+
+	if ses.State == SessionStateNegotiating {
+		if ses.Compression != "" && ses.Compression != c.transport.Compression() {
+			err = c.transport.SetCompression(ctx, ses.Compression)
+			if err != nil {
+				return nil, fmt.Errorf("set compression: %w", err)
+			}
+		}
+		if ses.Encryption != "" && ses.Encryption != c.transport.Encryption() {
+			err = c.transport.SetEncryption(ctx, ses.Encryption)
+			if err != nil {
+				return nil, fmt.Errorf("set encryption: %w", err)
+			}
+		}
+	}
+
+	// Await for authentication options
+	return c.receiveSessionFromServer(ctx)
+}
+
+// stepContext returns the context for a session establishment step, bounded by the step timeout, if defined.
+func (c *ClientChannel) stepContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.stepTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.stepTimeout)
+}
+
+func (c *ClientChannel) establishError(ctx context.Context, err error) *EstablishError {
+	if c.stepTimeout > 0 && errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		err = fmt.Errorf("step timeout of %v exceeded: %w", c.stepTimeout, err)
+	}
+	return &EstablishError{Step: c.establishStep, State: c.state, Err: err}
+}
+
+// FinishSession performs the session finishing handshake, sending a 'finishing' session to the server and awaiting
+// for the 'finished' session, which closes the transport.
+// The server may also reply with a 'failed' session, which is returned without error.
 func (c *ClientChannel) FinishSession(ctx context.Context) (*Session, error) {
 	if err := c.sendFinishingSession(ctx); err != nil {
 		return nil, fmt.Errorf("finish session: %w", err)
@@ -2,6 +2,7 @@ package lime
 
 import (
 	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/goleak"
 	"testing"
@@ -203,3 +204,201 @@ func TestClientChannel_FinishSession(t *testing.T) {
 	assert.False(t, c.Established())
 	assert.False(t, c.transport.Connected())
 }
+
+func TestClientChannel_SendSession_ReceiveSession_GuestHandshake(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := NewClientChannel(client, 1)
+	defer silentClose(c)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	clientNode := Node{
+		Identity: Identity{Name: "golang", Domain: "limeprotocol.org"},
+		Instance: "home",
+	}
+	serverNode := Node{
+		Identity: Identity{Name: "postmaster", Domain: "limeprotocol.org"},
+		Instance: "server1",
+	}
+	sessionID := "52e59849-19a8-4b2d-86b7-3fa563cdb616"
+	s := NewServerChannel(server, 1, serverNode, sessionID)
+	defer silentClose(s)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.EstablishSession(
+			ctx,
+			[]SessionCompression{SessionCompressionNone},
+			[]SessionEncryption{SessionEncryptionNone},
+			[]AuthenticationScheme{AuthenticationSchemeGuest},
+			func(context.Context, Identity, Authentication) (*AuthenticationResult, error) {
+				return &AuthenticationResult{Role: DomainRoleMember}, nil
+			},
+			func(context.Context, Node, *ServerChannel) (Node, error) {
+				return clientNode, nil
+			},
+		)
+	}()
+
+	// Act
+	err := c.SendSession(ctx, &Session{State: SessionStateNew})
+	assert.NoError(t, err)
+	authSes, err := c.ReceiveSession(ctx)
+	assert.NoError(t, err)
+	authRes := &Session{
+		Envelope: Envelope{ID: authSes.ID, From: clientNode},
+		State:    SessionStateAuthenticating,
+	}
+	authRes.SetAuthentication(&GuestAuthentication{})
+	err = c.SendSession(ctx, authRes)
+	assert.NoError(t, err)
+	actual, err := c.ReceiveSession(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, <-errChan)
+	assert.Equal(t, SessionStateAuthenticating, authSes.State)
+	assert.Equal(t, []AuthenticationScheme{AuthenticationSchemeGuest}, authSes.SchemeOptions)
+	if assert.NotNil(t, actual) {
+		assert.Equal(t, SessionStateEstablished, actual.State)
+		assert.Equal(t, sessionID, actual.ID)
+	}
+	assert.Equal(t, sessionID, c.ID())
+	assert.Equal(t, clientNode, c.LocalNode())
+	assert.Equal(t, serverNode, c.RemoteNode())
+	assert.True(t, c.Established())
+}
+
+func TestClientChannel_SendMessage_WhenValidateEnvelopesAndNoDestination(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, _ := newInProcessTransportPair("localhost", 1)
+	c := NewClientChannel(client, 1)
+	defer silentClose(c)
+	c.validateEnvs = true
+	c.setState(SessionStateEstablished)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	m := createMessage()
+	m.To = Node{}
+
+	// Act
+	err := c.SendMessage(ctx, m)
+
+	// Assert
+	assert.Error(t, err)
+}
+
+func TestClientChannel_SendMessage_WhenValidateEnvelopesAndDestination(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := NewClientChannel(client, 1)
+	defer silentClose(c)
+	c.validateEnvs = true
+	c.setState(SessionStateEstablished)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	m := createMessage()
+
+	// Act
+	err := c.SendMessage(ctx, m)
+
+	// Assert
+	assert.NoError(t, err)
+	actual, err := server.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, m, actual)
+}
+
+func TestClientChannel_SendMessage_WhenNotValidateEnvelopesAndNoDestination(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := NewClientChannel(client, 1)
+	defer silentClose(c)
+	c.setState(SessionStateEstablished)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	m := createMessage()
+	m.To = Node{}
+
+	// Act
+	err := c.SendMessage(ctx, m)
+
+	// Assert
+	assert.NoError(t, err)
+	actual, err := server.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, m, actual)
+}
+
+func TestClientChannel_EstablishSession_WhenTransportCloses(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	c := NewClientChannel(client, 1)
+	defer silentClose(c)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	go func() {
+		_, _ = server.Receive(ctx)
+		_ = server.Close()
+	}()
+
+	// Act
+	actual, err := c.EstablishSession(ctx, NoneCompressionSelector, NoneEncryptionSelector, Identity{}, GuestAuthenticator, "")
+
+	// Assert
+	assert.Nil(t, actual)
+	var establishErr *EstablishError
+	if assert.ErrorAs(t, err, &establishErr) {
+		assert.Equal(t, EstablishStepNew, establishErr.Step)
+		assert.Nil(t, establishErr.Reason)
+		assert.Error(t, establishErr.Err)
+	}
+	var reasonErr *ReasonError
+	assert.False(t, errors.As(err, &reasonErr))
+}
+
+func TestClientChannel_EstablishSession_WhenServerStallsOnAuthentication(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	defer silentClose(server)
+	c := NewClientChannel(client, 1)
+	defer silentClose(c)
+	c.stepTimeout = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	received := make(chan bool)
+	go func() {
+		if _, err := server.Receive(ctx); err != nil {
+			return
+		}
+		authSes := &Session{State: SessionStateAuthenticating, SchemeOptions: []AuthenticationScheme{AuthenticationSchemeGuest}}
+		authSes.ID = NewEnvelopeID()
+		if err := server.Send(ctx, authSes); err != nil {
+			return
+		}
+		// Receives the authentication and stalls
+		_, _ = server.Receive(ctx)
+		close(received)
+	}()
+	start := time.Now()
+
+	// Act
+	actual, err := c.EstablishSession(ctx, NoneCompressionSelector, NoneEncryptionSelector, Identity{Name: "golang", Domain: "limeprotocol.org"}, GuestAuthenticator, "")
+
+	// Assert
+	assert.Nil(t, actual)
+	assert.Less(t, time.Since(start), time.Second)
+	var establishErr *EstablishError
+	if assert.ErrorAs(t, err, &establishErr) {
+		assert.Equal(t, EstablishStepAuthentication, establishErr.Step)
+		assert.Equal(t, SessionStateAuthenticating, establishErr.State)
+	}
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "authentication")
+	<-received
+}
@@ -3,10 +3,13 @@ package lime
 import (
 	"context"
 	"errors"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/goleak"
 	"log"
 	"net"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -52,3 +55,902 @@ func TestClient_NewClient_Message(t *testing.T) {
 	err = client.Close()
 	assert.NoError(t, err)
 }
+
+func TestClient_OnStateChange_ServerRestart(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	buildServer := func() *Server {
+		return NewServerBuilder().
+			ListenInProcess(addr1).
+			EnableGuestAuthentication().
+			Build()
+	}
+	listen := func(srv *Server) {
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+				log.Println(err)
+			}
+		}()
+		time.Sleep(16 * time.Millisecond)
+	}
+	server := buildServer()
+	listen(server)
+	stateChan := make(chan ClientState, 16)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		OnStateChange(func(old, new ClientState) {
+			stateChan <- new
+		}).
+		Build()
+	receiveState := func() ClientState {
+		select {
+		case <-ctx.Done():
+			assert.FailNow(t, "receive state timeout")
+		case s := <-stateChan:
+			return s
+		}
+		return ClientStateDisconnected
+	}
+	err := client.Establish(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, ClientStateConnecting, receiveState())
+	assert.Equal(t, ClientStateEstablished, receiveState())
+
+	// Act
+	_ = server.Close()
+	assert.Equal(t, ClientStateDisconnected, receiveState())
+	server = buildServer()
+	listen(server)
+	defer silentClose(server)
+
+	// Assert
+	assert.Equal(t, ClientStateConnecting, receiveState())
+	assert.Equal(t, ClientStateEstablished, receiveState())
+	_ = client.Close()
+	assert.Equal(t, ClientStateClosed, receiveState())
+	assert.Equal(t, ClientStateClosed, client.State())
+}
+
+func TestClient_Channel_Reconnect(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("client-channel-reconnect")
+	server := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Build()
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+			log.Println(err)
+		}
+	}()
+	time.Sleep(16 * time.Millisecond)
+	disconnected := make(chan struct{}, 1)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		OnStateChange(func(old, new ClientState) {
+			// The client may start reconnecting without reporting the disconnection, if the session is lost before
+			// its listener starts
+			if old == ClientStateEstablished {
+				select {
+				case disconnected <- struct{}{}:
+				default:
+				}
+			}
+		}).
+		Build()
+	defer silentClose(client)
+	err := client.Establish(ctx)
+	assert.NoError(t, err)
+
+	// Act
+	channel, ok := client.Channel()
+
+	// Assert
+	assert.True(t, ok)
+	if assert.NotNil(t, channel) {
+		assert.True(t, channel.Established())
+		assert.NotEmpty(t, channel.ID())
+	}
+	_ = server.Close()
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "disconnection timeout")
+	case <-disconnected:
+	}
+	channel, ok = client.Channel()
+	assert.False(t, ok)
+	assert.Nil(t, channel)
+}
+
+func TestClient_EnableWatchdog_WhenServerEchoes(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	server := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		EchoWatchdog().
+		Build()
+	defer silentClose(server)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+			log.Println(err)
+		}
+	}()
+	time.Sleep(16 * time.Millisecond)
+	var disconnections int32
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		OnStateChange(func(old, new ClientState) {
+			if new == ClientStateDisconnected {
+				atomic.AddInt32(&disconnections, 1)
+			}
+		}).
+		Build()
+	err := client.Establish(ctx)
+	assert.NoError(t, err)
+
+	// Act
+	client.EnableWatchdog(10*time.Millisecond, 30*time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+
+	// Assert
+	assert.Equal(t, int32(0), atomic.LoadInt32(&disconnections))
+	channel, ok := client.Channel()
+	if assert.True(t, ok) {
+		assert.NotZero(t, channel.lastWatchdogEcho())
+	}
+	_ = client.Close()
+}
+
+func TestClient_EnableWatchdog_WhenServerDoesNotEcho(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	var notifications int32
+	server := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		NotificationsHandlerFunc(func(ctx context.Context, not *Notification) error {
+			atomic.AddInt32(&notifications, 1)
+			return nil
+		}).
+		Build()
+	defer silentClose(server)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+			log.Println(err)
+		}
+	}()
+	time.Sleep(16 * time.Millisecond)
+	stateChan := make(chan ClientState, 16)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		OnStateChange(func(old, new ClientState) {
+			stateChan <- new
+		}).
+		Build()
+	receiveState := func() ClientState {
+		select {
+		case <-ctx.Done():
+			assert.FailNow(t, "receive state timeout")
+		case s := <-stateChan:
+			return s
+		}
+		return ClientStateDisconnected
+	}
+	err := client.Establish(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, ClientStateConnecting, receiveState())
+	assert.Equal(t, ClientStateEstablished, receiveState())
+	channel, _ := client.Channel()
+
+	// Act
+	client.EnableWatchdog(10*time.Millisecond, 30*time.Millisecond)
+
+	// Assert
+	assert.Equal(t, ClientStateDisconnected, receiveState())
+	assert.Equal(t, ClientStateConnecting, receiveState())
+	assert.Equal(t, ClientStateEstablished, receiveState())
+	reconnected, ok := client.Channel()
+	assert.True(t, ok)
+	assert.NotSame(t, channel, reconnected)
+	// The server without the echo handles the watchdog notifications as regular ones
+	assert.NotZero(t, atomic.LoadInt32(&notifications))
+	_ = client.Close()
+}
+
+func TestClient_SendMessage_FillFromAddress(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	msgChan := make(chan *Message, 1)
+	server := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			msgChan <- msg
+			return nil
+		}).
+		Build()
+	defer silentClose(server)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+			log.Println(err)
+		}
+	}()
+	time.Sleep(16 * time.Millisecond)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		Build()
+	defer silentClose(client)
+	err := client.Establish(ctx)
+	assert.NoError(t, err)
+	channel, _ := client.Channel()
+	msg := createMessage()
+	msg.From = Node{}
+
+	// Act
+	err = client.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive message timeout")
+	case actual := <-msgChan:
+		assert.Equal(t, channel.LocalNode(), actual.From)
+	}
+}
+
+func TestClient_SendMessage_WhenFillFromAddressDisabled(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	msgChan := make(chan *Message, 1)
+	server := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			msgChan <- msg
+			return nil
+		}).
+		Build()
+	defer silentClose(server)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+			log.Println(err)
+		}
+	}()
+	time.Sleep(16 * time.Millisecond)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		FillFromAddress(false).
+		Build()
+	defer silentClose(client)
+	msg := createMessage()
+	msg.From = Node{}
+
+	// Act
+	err := client.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive message timeout")
+	case actual := <-msgChan:
+		assert.Equal(t, Node{}, actual.From)
+	}
+}
+
+func TestClient_EnqueueMessage_Order(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	count := 10
+	msgChan := make(chan *Message, count)
+	server := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			msgChan <- msg
+			return nil
+		}).
+		Build()
+	defer silentClose(server)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+			log.Println(err)
+		}
+	}()
+	time.Sleep(16 * time.Millisecond)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		SendQueue(count).
+		Build()
+	defer silentClose(client)
+	var msgs []*Message
+
+	// Act
+	for i := 0; i < count; i++ {
+		msg := createMessage()
+		msgs = append(msgs, msg)
+		err := client.EnqueueMessage(ctx, msg)
+		assert.NoError(t, err)
+	}
+
+	// Assert
+	for _, msg := range msgs {
+		select {
+		case <-ctx.Done():
+			assert.FailNow(t, "receive message timeout")
+		case actual := <-msgChan:
+			assert.Equal(t, msg.ID, actual.ID)
+		}
+	}
+}
+
+func TestClient_EnqueueMessage_WhenQueueIsFull(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	config := NewClientConfig()
+	config.SendQueueSize = 1
+	config.OnSendError = func(*Message, error) {}
+	config.NewTransport = func(ctx context.Context) (Transport, error) {
+		// Never connects
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	client := NewClient(config, &EnvelopeMux{})
+	defer silentClose(client)
+	err := client.EnqueueMessage(ctx, createMessage())
+	assert.NoError(t, err)
+	err = client.EnqueueMessage(ctx, createMessage())
+	assert.NoError(t, err)
+	enqueueCtx, enqueueCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer enqueueCancel()
+
+	// Act
+	err = client.EnqueueMessage(enqueueCtx, createMessage())
+
+	// Assert
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClient_EnqueueMessage_WhenClosed(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	config := NewClientConfig()
+	config.SendQueueSize = 16
+	var reported int32
+	config.OnSendError = func(*Message, error) {
+		atomic.AddInt32(&reported, 1)
+	}
+	config.NewTransport = func(ctx context.Context) (Transport, error) {
+		// Never connects
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	client := NewClient(config, &EnvelopeMux{})
+	err := client.Close()
+	assert.NoError(t, err)
+
+	// Act & Assert
+	for i := 0; i < 100; i++ {
+		err = client.EnqueueMessage(ctx, createMessage())
+		assert.ErrorIs(t, err, errClientClosed)
+	}
+	assert.Zero(t, atomic.LoadInt32(&reported))
+}
+
+func TestClient_EnqueueMessage_WhenClosedConcurrently(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	config := NewClientConfig()
+	config.SendQueueSize = 16
+	config.NewTransport = func(ctx context.Context) (Transport, error) {
+		// Never connects
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	client := NewClient(config, &EnvelopeMux{})
+	var wg sync.WaitGroup
+
+	// Act
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = client.Close()
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	err := client.EnqueueMessage(context.Background(), createMessage())
+	assert.ErrorIs(t, err, errClientClosed)
+}
+
+func TestClient_EnqueueMessage_OnSendErrorWhenTransportFails(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	type sendError struct {
+		msg *Message
+		err error
+	}
+	errChan := make(chan sendError, 1)
+	config := NewClientConfig()
+	config.SendQueueSize = 1
+	config.SendTimeout = 50 * time.Millisecond
+	config.OnSendError = func(msg *Message, err error) {
+		errChan <- sendError{msg, err}
+	}
+	config.NewTransport = func(ctx context.Context) (Transport, error) {
+		return nil, errors.New("connection refused")
+	}
+	client := NewClient(config, &EnvelopeMux{})
+	defer silentClose(client)
+	msg := createMessage()
+
+	// Act
+	err := client.EnqueueMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "send error timeout")
+	case actual := <-errChan:
+		assert.Equal(t, msg, actual.msg)
+		assert.ErrorIs(t, actual.err, context.DeadlineExceeded)
+	}
+}
+
+func TestClient_EnqueueMessage_WhenQueueIsNotEnabled(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	config := NewClientConfig()
+	config.NewTransport = func(ctx context.Context) (Transport, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	client := NewClient(config, &EnvelopeMux{})
+	defer silentClose(client)
+
+	// Act
+	err := client.EnqueueMessage(ctx, createMessage())
+
+	// Assert
+	assert.Error(t, err)
+}
+
+func TestClient_SendMessage_CorrelationID(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	idChan := make(chan string, 1)
+	server := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		CorrelationKey("traceId").
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			id, _ := ContextCorrelationID(ctx)
+			idChan <- id
+			return nil
+		}).
+		Build()
+	defer silentClose(server)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+			log.Println(err)
+		}
+	}()
+	time.Sleep(16 * time.Millisecond)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		CorrelationKey("traceId").
+		Build()
+	defer silentClose(client)
+	msg := createMessage()
+	traceID := NewEnvelopeID()
+
+	// Act
+	err := client.SendMessage(ContextWithCorrelationID(ctx, traceID), msg)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, traceID, msg.Metadata["traceId"])
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive message timeout")
+	case actual := <-idChan:
+		assert.Equal(t, traceID, actual)
+	}
+}
+
+func TestClient_OfflineBuffer_WhenServerRestarts(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	msgChan := make(chan *Message, 4)
+	buildServer := func() *Server {
+		return NewServerBuilder().
+			ListenInProcess(addr1).
+			EnableGuestAuthentication().
+			MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+				msgChan <- msg
+				return nil
+			}).
+			Build()
+	}
+	listen := func(srv *Server) {
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+				log.Println(err)
+			}
+		}()
+		time.Sleep(16 * time.Millisecond)
+	}
+	server := buildServer()
+	listen(server)
+	disconnected := make(chan struct{}, 1)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		OfflineBuffer(4).
+		OnStateChange(func(old, new ClientState) {
+			if new == ClientStateDisconnected {
+				select {
+				case disconnected <- struct{}{}:
+				default:
+				}
+			}
+		}).
+		Build()
+	defer silentClose(client)
+	if err := client.Establish(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = server.Close()
+	select {
+	case <-ctx.Done():
+		t.Fatal("disconnection timeout")
+	case <-disconnected:
+	}
+	var msgs []*Message
+
+	// Act
+	for i := 0; i < 3; i++ {
+		msg := createMessage()
+		msg.ID = NewEnvelopeID()
+		msgs = append(msgs, msg)
+		err := client.SendMessage(ctx, msg)
+		assert.NoError(t, err)
+	}
+	server = buildServer()
+	listen(server)
+	defer silentClose(server)
+
+	// Assert
+	for _, msg := range msgs {
+		select {
+		case <-ctx.Done():
+			assert.FailNow(t, "receive message timeout")
+		case actual := <-msgChan:
+			assert.Equal(t, msg.ID, actual.ID)
+		}
+	}
+}
+
+func TestClient_OfflineBuffer_OnOfflineDropWhenBufferIsFull(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	type dropArgs struct {
+		msg *Message
+		err error
+	}
+	dropChan := make(chan dropArgs, 2)
+	// There's no server listening, so the session is never established
+	client := NewClientBuilder().
+		UseInProcess(InProcessAddr("localhost"), 1).
+		OfflineBuffer(1).
+		OnOfflineDrop(func(msg *Message, err error) {
+			dropChan <- dropArgs{msg, err}
+		}).
+		Build()
+	msg1 := createMessage()
+	msg1.ID = NewEnvelopeID()
+	msg2 := createMessage()
+	msg2.ID = NewEnvelopeID()
+
+	// Act
+	err1 := client.SendMessage(ctx, msg1)
+	err2 := client.SendMessage(ctx, msg2)
+	_ = client.Close()
+
+	// Assert
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	if assert.Len(t, dropChan, 2) {
+		args := <-dropChan
+		assert.Equal(t, msg1.ID, args.msg.ID)
+		assert.ErrorIs(t, args.err, ErrOfflineBufferOverflow)
+		args = <-dropChan
+		assert.Equal(t, msg2.ID, args.msg.ID)
+		assert.ErrorIs(t, args.err, errClientClosed)
+	}
+}
+
+func TestClient_CloseWithContext_WhenFinishTimesOut(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	release := make(chan struct{})
+	server := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		SessionHandler(func(ctx context.Context, ses *Session, c *ServerChannel) error {
+			// Never replies the finishing request in time
+			<-release
+			return nil
+		}).
+		Build()
+	defer silentClose(server)
+	defer close(release)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+			log.Println(err)
+		}
+	}()
+	time.Sleep(16 * time.Millisecond)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		Build()
+	if err := client.Establish(ctx); err != nil {
+		t.Fatal(err)
+	}
+	channel, _ := client.Channel()
+	closeCtx, closeCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer closeCancel()
+
+	// Act
+	start := time.Now()
+	err := client.CloseWithContext(closeCtx)
+
+	// Assert
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, ClientStateClosed, client.State())
+	assert.False(t, channel.transport.Connected())
+}
+
+func TestClient_Establish_WhenAuthenticationFails(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	server := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnablePlainAuthentication(func(ctx context.Context, identity Identity, password string) (*AuthenticationResult, error) {
+			return UnknownAuthenticationResult(), nil
+		}).
+		Build()
+	defer silentClose(server)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+			log.Println(err)
+		}
+	}()
+	time.Sleep(16 * time.Millisecond)
+	client := NewClientBuilder().
+		Name("golang").
+		Domain("localhost").
+		PlainAuthentication("wrong-password").
+		UseInProcess(addr1, 1).
+		Build()
+	defer silentClose(client)
+
+	// Act
+	channel, err := client.buildChannel(ctx)
+
+	// Assert
+	assert.Nil(t, channel)
+	var establishErr *EstablishError
+	if assert.ErrorAs(t, err, &establishErr) {
+		assert.Equal(t, EstablishStepAuthentication, establishErr.Step)
+		assert.Equal(t, SessionStateFailed, establishErr.State)
+		assert.Nil(t, establishErr.Err)
+		if assert.NotNil(t, establishErr.Reason) {
+			assert.Equal(t, ReasonCodeSessionAuthenticationFailed, establishErr.Reason.Code)
+		}
+	}
+	assert.Equal(t, ReasonCodeSessionAuthenticationFailed, ReasonFromError(err).Code)
+}
+
+func TestClient_TrySendMessage_WhenNotEstablished(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	client := NewClientBuilder().
+		UseInProcess(InProcessAddr(NewEnvelopeID()), 1).
+		Build()
+	defer silentClose(client)
+
+	// Act
+	sent, err := client.TrySendMessage(ctx, createMessage())
+
+	// Assert
+	assert.NoError(t, err)
+	assert.False(t, sent)
+}
+
+func TestClientBuilder_Ephemeral_WhenReconnects(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	buildServer := func() *Server {
+		return NewServerBuilder().
+			ListenInProcess(addr1).
+			EnableGuestAuthentication().
+			Build()
+	}
+	listen := func(srv *Server) {
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+				log.Println(err)
+			}
+		}()
+		time.Sleep(16 * time.Millisecond)
+	}
+	server := buildServer()
+	listen(server)
+	stateChan := make(chan ClientState, 16)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		GuestAuthentication().
+		Ephemeral().
+		OnStateChange(func(old, new ClientState) {
+			stateChan <- new
+		}).
+		Build()
+	defer silentClose(client)
+	awaitState := func(state ClientState) {
+		for {
+			select {
+			case <-ctx.Done():
+				assert.FailNow(t, "receive state timeout")
+			case s := <-stateChan:
+				if s == state {
+					return
+				}
+			}
+		}
+	}
+	err := client.Establish(ctx)
+	assert.NoError(t, err)
+	channel, _ := client.Channel()
+	firstName := channel.LocalNode().Name
+
+	// Act
+	_ = server.Close()
+	awaitState(ClientStateDisconnected)
+	server = buildServer()
+	listen(server)
+	defer silentClose(server)
+	awaitState(ClientStateEstablished)
+
+	// Assert
+	channel, ok := client.Channel()
+	if assert.True(t, ok) {
+		secondName := channel.LocalNode().Name
+		assert.NotEqual(t, firstName, secondName)
+		_, err = uuid.Parse(firstName)
+		assert.NoError(t, err)
+		_, err = uuid.Parse(secondName)
+		assert.NoError(t, err)
+	}
+}
+
+func TestClientBuilder_OnReestablished_WhenReconnects(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	buildServer := func() *Server {
+		return NewServerBuilder().
+			ListenInProcess(addr1).
+			EnableGuestAuthentication().
+			Build()
+	}
+	listen := func(srv *Server) {
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+				log.Println(err)
+			}
+		}()
+		time.Sleep(16 * time.Millisecond)
+	}
+	server := buildServer()
+	listen(server)
+	channelChan := make(chan *ClientChannel, 16)
+	stateChan := make(chan ClientState, 16)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		OnReestablished(func(channel *ClientChannel) {
+			channelChan <- channel
+		}).
+		OnStateChange(func(old, new ClientState) {
+			stateChan <- new
+		}).
+		Build()
+	defer silentClose(client)
+	awaitState := func(state ClientState) {
+		for {
+			select {
+			case <-ctx.Done():
+				assert.FailNow(t, "receive state timeout")
+			case s := <-stateChan:
+				if s == state {
+					return
+				}
+			}
+		}
+	}
+	err := client.Establish(ctx)
+	assert.NoError(t, err)
+	awaitState(ClientStateEstablished)
+
+	// Act
+	_ = server.Close()
+	awaitState(ClientStateDisconnected)
+	server = buildServer()
+	listen(server)
+	defer silentClose(server)
+	awaitState(ClientStateEstablished)
+
+	// Assert
+	if assert.Len(t, channelChan, 2) {
+		first, second := <-channelChan, <-channelChan
+		assert.NotSame(t, first, second)
+		assert.NotEqual(t, first.ID(), second.ID())
+		channel, _ := client.Channel()
+		assert.Same(t, channel, second)
+	}
+}
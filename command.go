@@ -5,11 +5,14 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"reflect"
 )
 
 // Command is the base type for the RequestCommand and ResponseCommand types.
 // It allows the manipulation of node resources, like server session parameters or
 // information related to the network nodes.
+// It is not an envelope by itself, since it has neither the request URI nor the response status, so a request or
+// response is created by embedding it, like in RequestCommand{Command: cmd, URI: uri}.
 type Command struct {
 	Envelope
 	Method   CommandMethod // Method defines the action to be taken to the resource.
@@ -29,6 +32,11 @@ func (cmd *Command) SetResource(d Document) *Command {
 	return cmd
 }
 
+// GetResource returns the command resource document.
+func (cmd *Command) GetResource() Document {
+	return cmd.Resource
+}
+
 func (cmd *Command) toRawEnvelope() (*rawEnvelope, error) {
 	raw, err := cmd.Envelope.toRawEnvelope()
 	if err != nil {
@@ -140,6 +148,12 @@ func (cmd *RequestCommand) FailureResponse(reason *Reason) *ResponseCommand {
 	}
 }
 
+// FailureResponseFromError creates a failure response Command for the current request, with a Reason value
+// obtained from the specified error through the ReasonFromError function.
+func (cmd *RequestCommand) FailureResponseFromError(err error) *ResponseCommand {
+	return cmd.FailureResponse(ReasonFromError(err))
+}
+
 func (cmd *RequestCommand) MarshalJSON() ([]byte, error) {
 	raw, err := cmd.toRawEnvelope()
 	if err != nil {
@@ -198,6 +212,48 @@ func (cmd *ResponseCommand) SetStatusFailure(r Reason) {
 	cmd.Reason = &r
 }
 
+// Into stores the response resource in the value pointed by the target, which should be a pointer to a document
+// type, like in:
+//
+//	var acc Account
+//	err := resp.Into(&acc)
+//
+// If the response is a failure, a ReasonError with its reason is returned.
+// The resource is assigned to the target if it has the same type, or decoded from its JSON representation otherwise,
+// like when it was received as a JsonDocument or RawDocument.
+func (cmd *ResponseCommand) Into(target Document) error {
+	if cmd.Status == CommandStatusFailure {
+		return &ReasonError{Reason: cmd.Reason}
+	}
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("invalid target: %T", target)
+	}
+	if cmd.Resource == nil {
+		return errors.New("nil resource")
+	}
+
+	elem := v.Elem()
+	r := reflect.ValueOf(cmd.Resource)
+	switch {
+	case r.Type().AssignableTo(elem.Type()):
+		elem.Set(r)
+		return nil
+	case r.Kind() == reflect.Pointer && !r.IsNil() && r.Elem().Type().AssignableTo(elem.Type()):
+		elem.Set(r.Elem())
+		return nil
+	}
+
+	b, err := json.Marshal(cmd.Resource)
+	if err != nil {
+		return fmt.Errorf("encode resource: %w", err)
+	}
+	if err = json.Unmarshal(b, target); err != nil {
+		return fmt.Errorf("decode resource: %w", err)
+	}
+	return nil
+}
+
 func (cmd *ResponseCommand) MarshalJSON() ([]byte, error) {
 	raw, err := cmd.toRawEnvelope()
 	if err != nil {
@@ -316,13 +372,14 @@ const URISchemeLime = "lime"
 // URI defines a Lime resource identifier.
 // It can be represented in the short form (like '/presence') or in the absolute form, that includes the URI scheme and
 // resource owner identity (like 'lime://name@domain/presence').
+// Its methods are safe to be called on nil and zero values, which represents an empty URI.
 type URI struct {
 	url *url.URL
 }
 
 // URL returns the raw URL associated with the Lime URI.
 func (u *URI) URL() *url.URL {
-	if u.url == nil {
+	if u == nil || u.url == nil {
 		return nil
 	}
 
@@ -349,21 +406,36 @@ func ParseLimeURI(s string) (*URI, error) {
 }
 
 func (u *URI) String() string {
-	if u.url == nil {
+	if u == nil || u.url == nil {
 		return ""
 	}
 	return u.url.String()
 }
 
 func (u *URI) Path() string {
-	if u.url == nil {
+	if u == nil || u.url == nil {
 		return ""
 	}
 	return u.url.Path
 }
 
+// Query returns the parsed query parameters of the URI, like '?filter=active&limit=10'.
+// It returns an empty map if the URI has no query parameters.
+func (u *URI) Query() url.Values {
+	if u == nil || u.url == nil {
+		return url.Values{}
+	}
+	return u.url.Query()
+}
+
+// QueryParam returns the first value of the specified query parameter of the URI or an empty string if the
+// parameter is not present.
+func (u *URI) QueryParam(key string) string {
+	return u.Query().Get(key)
+}
+
 func (u *URI) Owner() *Identity {
-	if u.url == nil || u.url.User == nil {
+	if u == nil || u.url == nil || u.url.User == nil {
 		return nil
 	}
 	i := ParseIdentity(u.url.User.Username())
@@ -371,7 +443,7 @@ func (u *URI) Owner() *Identity {
 }
 
 func (u *URI) MarshalText() ([]byte, error) {
-	if u.url == nil {
+	if u == nil || u.url == nil {
 		return nil, nil
 	}
 
@@ -3,6 +3,7 @@ package lime
 import (
 	"encoding/json"
 	"github.com/stretchr/testify/assert"
+	"net/url"
 	"testing"
 )
 
@@ -335,3 +336,120 @@ func createResponseCommand() *ResponseCommand {
 	c.Status = CommandStatusSuccess
 	return &c
 }
+
+func TestURI_WhenNil(t *testing.T) {
+	// Arrange
+	var u *URI
+
+	// Act
+	path := u.Path()
+	s := u.String()
+	u2 := u.URL()
+	owner := u.Owner()
+	b, err := u.MarshalText()
+
+	// Assert
+	assert.Empty(t, path)
+	assert.Empty(t, s)
+	assert.Nil(t, u2)
+	assert.Nil(t, owner)
+	assert.Nil(t, b)
+	assert.NoError(t, err)
+}
+
+func TestURI_WhenZero(t *testing.T) {
+	// Arrange
+	u := &URI{}
+
+	// Act
+	path := u.Path()
+	s := u.String()
+	u2 := u.URL()
+	owner := u.Owner()
+
+	// Assert
+	assert.Empty(t, path)
+	assert.Empty(t, s)
+	assert.Nil(t, u2)
+	assert.Nil(t, owner)
+}
+
+func TestURI_Query(t *testing.T) {
+	// Arrange
+	u, err := ParseLimeURI("/contacts?filter=active&limit=10&tag=a&tag=b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	query := u.Query()
+
+	// Assert
+	assert.Equal(t, url.Values{"filter": {"active"}, "limit": {"10"}, "tag": {"a", "b"}}, query)
+	assert.Equal(t, "active", u.QueryParam("filter"))
+	assert.Equal(t, "10", u.QueryParam("limit"))
+	assert.Equal(t, "a", u.QueryParam("tag"))
+	assert.Empty(t, u.QueryParam("skip"))
+}
+
+func TestURI_Query_WhenNoParams(t *testing.T) {
+	// Arrange
+	u, err := ParseLimeURI("lime://golang@limeprotocol.org/contacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nilURI *URI
+
+	// Act
+	query := u.Query()
+
+	// Assert
+	assert.Empty(t, query)
+	assert.Empty(t, u.QueryParam("filter"))
+	assert.Empty(t, nilURI.Query())
+	assert.Empty(t, nilURI.QueryParam("filter"))
+}
+
+func TestResponseCommand_Into_WhenSuccess(t *testing.T) {
+	// Arrange
+	resp := createGetPingCommand().SuccessResponseWithResource(createTestJsonDocument())
+	var d testJsonDocument
+
+	// Act
+	err := resp.Into(&d)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, *createTestJsonDocument(), d)
+}
+
+func TestResponseCommand_Into_WhenJsonDocument(t *testing.T) {
+	// Arrange
+	resp := createGetPingCommand().SuccessResponseWithResource(&JsonDocument{"property1": "value1", "property2": 2})
+	var d testJsonDocument
+
+	// Act
+	err := resp.Into(&d)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "value1", d.Property1)
+	assert.Equal(t, 2, d.Property2)
+}
+
+func TestResponseCommand_Into_WhenFailure(t *testing.T) {
+	// Arrange
+	reason := &Reason{Code: ReasonCodeCommandResourceNotFound, Description: "The resource was not found"}
+	resp := createGetPingCommand().FailureResponse(reason)
+	var d testJsonDocument
+
+	// Act
+	err := resp.Into(&d)
+
+	// Assert
+	var reasonErr *ReasonError
+	if assert.ErrorAs(t, err, &reasonErr) {
+		assert.Equal(t, reason, reasonErr.Reason)
+	}
+	assert.Zero(t, d)
+}
@@ -1,6 +1,11 @@
 package lime
 
-import "context"
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
 
 type contextKey string
 
@@ -12,12 +17,27 @@ var (
 	contextKeySessionID         = contextKey("sessionID")
 	contextKeySessionRemoteNode = contextKey("sessionRemoteNode")
 	contextKeySessionLocalNode  = contextKey("sessionLocalNode")
+	contextKeyDomainRole        = contextKey("domainRole")
+	contextKeyListenerName      = contextKey("listenerName")
+	contextKeyRemoteAddr        = contextKey("remoteAddr")
+	contextKeyTLSState          = contextKey("tlsState")
+	contextKeyPeerInfo          = contextKey("peerInfo")
+	contextKeyRouteParams       = contextKey("routeParams")
+	contextKeyCorrelationID     = contextKey("correlationID")
+	contextKeyServerChannel     = contextKey("serverChannel")
+	contextKeyReceivedAt        = contextKey("receivedAt")
 )
 
 func sessionContext(ctx context.Context, c *channel) context.Context {
 	ctx = context.WithValue(ctx, contextKeySessionID, c.sessionID)
 	ctx = context.WithValue(ctx, contextKeySessionRemoteNode, c.remoteNode)
 	ctx = context.WithValue(ctx, contextKeySessionLocalNode, c.localNode)
+	if c.remoteRole != "" {
+		ctx = context.WithValue(ctx, contextKeyDomainRole, c.remoteRole)
+	}
+	if c.listenerName != "" {
+		ctx = context.WithValue(ctx, contextKeyListenerName, c.listenerName)
+	}
 	return ctx
 }
 
@@ -38,3 +58,116 @@ func ContextSessionLocalNode(ctx context.Context) (Node, bool) {
 	node, ok := ctx.Value(contextKeySessionLocalNode).(Node)
 	return node, ok
 }
+
+// ContextDomainRole gets the domain role of the session remote node from the context.
+// The role is available only in server sessions, being assigned by the authentication during the session
+// establishment.
+func ContextDomainRole(ctx context.Context) (DomainRole, bool) {
+	role, ok := ctx.Value(contextKeyDomainRole).(DomainRole)
+	return role, ok
+}
+
+// ContextListenerName gets the name of the server listener that accepted the session transport from the context.
+// The name is available only in server sessions accepted by named listeners.
+func ContextListenerName(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(contextKeyListenerName).(string)
+	return name, ok
+}
+
+// ContextServerChannel gets the server channel of the session from the context, allowing advanced operations in the
+// handlers, like finishing the session. The channel is available only in the handlers of server sessions.
+func ContextServerChannel(ctx context.Context) (*ServerChannel, bool) {
+	c, ok := ctx.Value(contextKeyServerChannel).(*ServerChannel)
+	return c, ok
+}
+
+// ContextWithCorrelationID returns a copy of the context with the specified correlation id, for distributed tracing.
+// When the correlation key is configured in the client or server, the id is copied to the metadata of the envelopes
+// sent with the returned context.
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKeyCorrelationID, id)
+}
+
+// ContextCorrelationID gets the correlation id from the context.
+// In the envelope handlers, it is available if the correlation key is configured and the received envelope has it in
+// its metadata.
+func ContextCorrelationID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKeyCorrelationID).(string)
+	return id, ok && id != ""
+}
+
+// correlationContext adds the correlation id from the envelope metadata to the context, if the channel has a
+// correlation key.
+func correlationContext(ctx context.Context, c *channel, env *Envelope) context.Context {
+	if c.correlationKey == "" {
+		return ctx
+	}
+	if id := env.Metadata[c.correlationKey]; id != "" {
+		return ContextWithCorrelationID(ctx, id)
+	}
+	return ctx
+}
+
+// receivedAtContext adds the time the envelope was received from the transport to the context, if recorded.
+func receivedAtContext(ctx context.Context, c *channel, e envelope) context.Context {
+	if t, ok := c.receivedAt(e); ok {
+		return context.WithValue(ctx, contextKeyReceivedAt, t)
+	}
+	return ctx
+}
+
+// ContextReceivedAt gets the time the envelope being handled was received from the transport, allowing the handlers
+// to compute the processing latency. The difference between it and the handler start is the time the envelope
+// waited in the channel buffer. The time is recorded only for the envelopes received after the EnvelopeMux started
+// listening the channel.
+func ContextReceivedAt(ctx context.Context) (time.Time, bool) {
+	t, ok := ctx.Value(contextKeyReceivedAt).(time.Time)
+	return t, ok
+}
+
+// transportContext adds the remote address, the TLS connection state and the peer information of the transport to
+// the context.
+func transportContext(ctx context.Context, t Transport) context.Context {
+	if addr := t.RemoteAddr(); addr != nil {
+		ctx = context.WithValue(ctx, contextKeyRemoteAddr, addr)
+	}
+	if tt, ok := t.(tlsStateTransport); ok {
+		if state, ok := tt.ConnectionState(); ok {
+			ctx = context.WithValue(ctx, contextKeyTLSState, &state)
+		}
+	}
+	if info, ok := t.PeerInfo(); ok {
+		ctx = context.WithValue(ctx, contextKeyPeerInfo, info)
+	}
+	return ctx
+}
+
+// ContextRemoteAddr gets the remote address of the session transport from the context.
+// The address is available to the authentication and registration functions of server sessions.
+func ContextRemoteAddr(ctx context.Context) (net.Addr, bool) {
+	addr, ok := ctx.Value(contextKeyRemoteAddr).(net.Addr)
+	return addr, ok
+}
+
+// ContextPeerInfo gets the identity information of the remote peer provided by the session transport from the
+// context. The information is available to the authentication and registration functions of server sessions, if the
+// transport provides it.
+func ContextPeerInfo(ctx context.Context) (PeerInfo, bool) {
+	info, ok := ctx.Value(contextKeyPeerInfo).(PeerInfo)
+	return info, ok
+}
+
+// ContextTLSConnectionState gets the TLS connection state of the session transport from the context.
+// The state is available to the authentication and registration functions of server sessions, if the transport is
+// encrypted with TLS.
+func ContextTLSConnectionState(ctx context.Context) (*tls.ConnectionState, bool) {
+	state, ok := ctx.Value(contextKeyTLSState).(*tls.ConnectionState)
+	return state, ok
+}
+
+// ContextRouteParams gets the route template parameters from the context.
+// The parameters are available for the handlers registered in a CommandRouter.
+func ContextRouteParams(ctx context.Context) (map[string]string, bool) {
+	params, ok := ctx.Value(contextKeyRouteParams).(map[string]string)
+	return params, ok
+}
@@ -0,0 +1,88 @@
+package lime
+
+import (
+	"encoding/json"
+)
+
+// DelegationURIPath is the path of the resource for delegating envelopes to another node.
+const DelegationURIPath = "/delegations"
+
+// DelegationDocument represents the delegation of an envelope to a target node, which is allowed to act on behalf of
+// the envelope originator, like sending envelopes with the originator address in the PP (per procurationem) field.
+// It differs from the chat.Delegation document, which grants a node the permission to send envelopes on behalf of
+// another, and so it has a distinct media type.
+type DelegationDocument struct {
+	// Target is the node that the envelope is delegated to.
+	Target Node
+	// Envelope is the delegated envelope.
+	Envelope Envelope
+}
+
+func MediaTypeDelegationDocument() MediaType {
+	return MediaType{
+		Type:    "application",
+		Subtype: "vnd.lime.envelope-delegation",
+		Suffix:  "json",
+	}
+}
+
+func (d *DelegationDocument) MediaType() MediaType {
+	return MediaTypeDelegationDocument()
+}
+
+// rawDelegationDocument is a wrapper for custom marshalling
+type rawDelegationDocument struct {
+	Target   *Node        `json:"target,omitempty"`
+	Envelope *rawEnvelope `json:"envelope,omitempty"`
+}
+
+func (d *DelegationDocument) MarshalJSON() ([]byte, error) {
+	raw := rawDelegationDocument{}
+	if d.Target != (Node{}) {
+		raw.Target = &d.Target
+	}
+	env, err := d.Envelope.toRawEnvelope()
+	if err != nil {
+		return nil, err
+	}
+	raw.Envelope = env
+	return json.Marshal(raw)
+}
+
+func (d *DelegationDocument) UnmarshalJSON(b []byte) error {
+	raw := rawDelegationDocument{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	delegation := DelegationDocument{}
+	if raw.Target != nil {
+		delegation.Target = *raw.Target
+	}
+	if err := delegation.Envelope.populate(raw.Envelope); err != nil {
+		return err
+	}
+
+	*d = delegation
+	return nil
+}
+
+// NewDelegateCommand creates a request command for delegating the specified envelope to the target node.
+func NewDelegateCommand(target Node, envelope Envelope) *RequestCommand {
+	cmd := &RequestCommand{}
+	cmd.SetNewEnvelopeID()
+	cmd.SetMethod(CommandMethodSet)
+	cmd.SetURIString(DelegationURIPath)
+	cmd.SetResource(&DelegationDocument{Target: target, Envelope: envelope})
+	return cmd
+}
+
+// IsDelegateCommand indicates if the specified request command is a delegation command, with a DelegationDocument
+// resource. It can be used as a RequestCommandPredicate for handling delegations.
+func IsDelegateCommand(cmd *RequestCommand) bool {
+	if cmd.Method != CommandMethodSet || cmd.URI == nil || cmd.URI.Path() != DelegationURIPath {
+		return false
+	}
+	_, ok := cmd.Resource.(*DelegationDocument)
+	return ok
+}
@@ -0,0 +1,93 @@
+package lime
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func createDelegateCommand() *RequestCommand {
+	env := Envelope{}
+	env.SetID("1d2f9e1a-5c7e-4a1b-8a3e-2a9f0c6b7d41")
+	env.SetFromString("golang@limeprotocol.org/home")
+	env.SetToString("postmaster@limeprotocol.org")
+	env.SetMetadataKeyValue("trace", "1")
+	cmd := NewDelegateCommand(ParseNode("bot@limeprotocol.org/default"), env)
+	cmd.SetID("4609d0a3-00eb-4e16-9d44-27d115c6eb31")
+	return cmd
+}
+
+func TestDelegationDocument_MarshalJSON(t *testing.T) {
+	// Arrange
+	cmd := createDelegateCommand()
+
+	// Act
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	assert.JSONEq(t, `{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","method":"set","uri":"/delegations","type":"application/vnd.lime.envelope-delegation+json","resource":{"target":"bot@limeprotocol.org/default","envelope":{"id":"1d2f9e1a-5c7e-4a1b-8a3e-2a9f0c6b7d41","from":"golang@limeprotocol.org/home","to":"postmaster@limeprotocol.org","metadata":{"trace":"1"}}}}`, string(b))
+}
+
+func TestDelegationDocument_UnmarshalJSON(t *testing.T) {
+	// Arrange
+	j := []byte(`{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","method":"set","uri":"/delegations","type":"application/vnd.lime.envelope-delegation+json","resource":{"target":"bot@limeprotocol.org/default","envelope":{"id":"1d2f9e1a-5c7e-4a1b-8a3e-2a9f0c6b7d41","from":"golang@limeprotocol.org/home","to":"postmaster@limeprotocol.org","metadata":{"trace":"1"}}}}`)
+	var cmd RequestCommand
+
+	// Act
+	err := json.Unmarshal(j, &cmd)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, createDelegateCommand(), &cmd)
+	assert.True(t, IsDelegateCommand(&cmd))
+}
+
+func TestIsDelegateCommand_WhenOtherCommand(t *testing.T) {
+	// Arrange
+	cmd := createGetPingCommand()
+
+	// Act
+	ok := IsDelegateCommand(cmd)
+
+	// Assert
+	assert.False(t, ok)
+}
+
+func TestEnvelopeMux_RequestCommandHandlerFunc_UnwrapDelegation(t *testing.T) {
+	// Arrange
+	s := &senderMock{}
+	mux := &EnvelopeMux{}
+	var delegated Envelope
+	var target Node
+	mux.RequestCommandHandlerFunc(
+		IsDelegateCommand,
+		func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+			d, err := ResourceAs[*DelegationDocument](cmd)
+			if err != nil {
+				return err
+			}
+			target = d.Target
+			delegated = d.Envelope
+			return s.SendResponseCommand(ctx, cmd.SuccessResponse())
+		})
+	cmd := createDelegateCommand()
+
+	// Act
+	err := mux.handleRequestCommand(context.Background(), cmd, s)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, ParseNode("bot@limeprotocol.org/default"), target)
+	assert.Equal(t, "1d2f9e1a-5c7e-4a1b-8a3e-2a9f0c6b7d41", delegated.ID)
+	assert.Equal(t, ParseNode("golang@limeprotocol.org/home"), delegated.From)
+	assert.Equal(t, map[string]string{"trace": "1"}, delegated.Metadata)
+	if assert.Len(t, s.envelopes, 1) {
+		resp := s.envelopes[0].(*ResponseCommand)
+		assert.Equal(t, cmd.ID, resp.ID)
+		assert.Equal(t, CommandStatusSuccess, resp.Status)
+	}
+}
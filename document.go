@@ -3,6 +3,7 @@ package lime
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 )
 
 func init() {
@@ -22,6 +23,9 @@ func init() {
 	RegisterDocumentFactory(func() Document {
 		return &Ping{}
 	})
+	RegisterDocumentFactory(func() Document {
+		return &DelegationDocument{}
+	})
 }
 
 // Document defines an entity with a media type.
@@ -30,6 +34,41 @@ type Document interface {
 	MediaType() MediaType
 }
 
+// ResourceAs returns the resource of the specified envelope, like a RequestCommand or ResponseCommand, as a document
+// of the type T, which should be the same type produced by the registered document factory, like *JsonDocument.
+// An error is returned if the resource is nil or if it is not of the expected type.
+func ResourceAs[T Document](env interface{ GetResource() Document }) (T, error) {
+	return documentAs[T](env.GetResource(), "resource")
+}
+
+// ContentAs returns the content of the message as a document of the type T.
+// An error is returned if the content is nil or if it is not of the expected type.
+func ContentAs[T Document](msg *Message) (T, error) {
+	return documentAs[T](msg.Content, "content")
+}
+
+// ContainerAs returns the value of the document container as a document of the type T.
+// An error is returned if the container or its value is nil or if the value is not of the expected type.
+func ContainerAs[T Document](c *DocumentContainer) (T, error) {
+	if c == nil {
+		var zero T
+		return zero, errors.New("nil container")
+	}
+	return documentAs[T](c.Value, "container value")
+}
+
+func documentAs[T Document](d Document, name string) (T, error) {
+	var zero T
+	if d == nil {
+		return zero, fmt.Errorf("nil %v", name)
+	}
+	t, ok := d.(T)
+	if !ok {
+		return zero, fmt.Errorf("unexpected %v type: got %T (%v), expected %T", name, d, d.MediaType(), zero)
+	}
+	return t, nil
+}
+
 // JsonDocument represents a generic JSON document.
 type JsonDocument map[string]interface{}
 
@@ -44,6 +83,26 @@ func (d TextDocument) MediaType() MediaType {
 	return MediaTypeTextPlain()
 }
 
+// RawDocument represents a document of a media type without a registered factory, which cannot be deserialized to a
+// known type. It preserves the document media type and its raw JSON value, allowing the handlers to inspect it.
+type RawDocument struct {
+	// The media type of the document.
+	Type MediaType
+	// The raw JSON value of the document.
+	Value json.RawMessage
+}
+
+func (d *RawDocument) MediaType() MediaType {
+	return d.Type
+}
+
+func (d *RawDocument) MarshalJSON() ([]byte, error) {
+	if len(d.Value) == 0 {
+		return []byte("null"), nil
+	}
+	return d.Value, nil
+}
+
 // DocumentContainer represents a generic container for a document,
 // providing a media type for the correct handling of its value by the nodes.
 // This type can be used along with DocumentCollection to transport distinct
@@ -55,7 +114,11 @@ type DocumentContainer struct {
 	Value Document
 }
 
+// NewDocumentContainer creates a new DocumentContainer for the specified document, using its media type.
 func NewDocumentContainer(d Document) *DocumentContainer {
+	if d == nil {
+		panic("nil document")
+	}
 	return &DocumentContainer{
 		Type:  d.MediaType(),
 		Value: d,
@@ -92,7 +155,7 @@ func (d *DocumentContainer) UnmarshalJSON(b []byte) error {
 	}
 
 	documentContainer := DocumentContainer{}
-	err = documentContainer.populate(&raw)
+	err = documentContainer.populate(&raw, 1)
 	if err != nil {
 		return err
 	}
@@ -116,13 +179,17 @@ func (d *DocumentContainer) raw() (*rawDocumentContainer, error) {
 	return &raw, nil
 }
 
-func (d *DocumentContainer) populate(raw *rawDocumentContainer) error {
+func (d *DocumentContainer) populate(raw *rawDocumentContainer, depth int) error {
+	if err := checkNestingDepth(depth); err != nil {
+		return err
+	}
+
 	// Create the document type instance and unmarshal the json to it
 	if raw.Type == nil {
 		return errors.New("document type is required")
 	}
 
-	document, err := UnmarshalDocument(raw.Value, *raw.Type)
+	document, err := unmarshalNestedDocument(raw.Value, *raw.Type, depth)
 	if err != nil {
 		return err
 	}
@@ -143,12 +210,18 @@ type DocumentCollection struct {
 	ItemType MediaType
 	// The collection items.
 	Items []Document
+	// The position of the first item of the collection in the source collection, for paginated collections.
+	Offset int
+	// The maximum number of items of each page of the source collection, for paginated collections.
+	ItemsPerPage int
 }
 
 func (d *DocumentCollection) MediaType() MediaType {
 	return MediaType{MediaTypeApplication, "vnd.lime.collection", "json"}
 }
 
+// NewDocumentCollection creates a collection with the specified items of the type t.
+// The items can be nil for creating an empty collection, to be filled by the Add method.
 func NewDocumentCollection(items []Document, t MediaType) *DocumentCollection {
 	return &DocumentCollection{
 		Total:    len(items),
@@ -157,11 +230,37 @@ func NewDocumentCollection(items []Document, t MediaType) *DocumentCollection {
 	}
 }
 
+// Add appends the items to the collection, incrementing its Total value accordingly.
+// For paginated collections, the Total value should be set afterwards to the source collection size.
+// It panics if an item type is not the collection item type.
+func (d *DocumentCollection) Add(items ...Document) *DocumentCollection {
+	for _, item := range items {
+		if item == nil {
+			panic("nil item")
+		}
+		if item.MediaType() != d.ItemType {
+			panic(fmt.Errorf("item type %v does not match the collection item type %v", item.MediaType(), d.ItemType))
+		}
+	}
+	d.Items = append(d.Items, items...)
+	d.Total += len(items)
+	return d
+}
+
+// SetPage sets the pagination values of the collection.
+func (d *DocumentCollection) SetPage(offset, itemsPerPage int) *DocumentCollection {
+	d.Offset = offset
+	d.ItemsPerPage = itemsPerPage
+	return d
+}
+
 // rawDocumentCollection is a wrapper for custom marshalling
 type rawDocumentCollection struct {
-	Total    int                `json:"total,omitempty"`
-	ItemType *MediaType         `json:"itemType"`
-	Items    []*json.RawMessage `json:"items"`
+	Total        int                `json:"total,omitempty"`
+	ItemType     *MediaType         `json:"itemType"`
+	Items        []*json.RawMessage `json:"items"`
+	Offset       int                `json:"offset,omitempty"`
+	ItemsPerPage int                `json:"itemsPerPage,omitempty"`
 }
 
 func (d *DocumentCollection) MarshalJSON() ([]byte, error) {
@@ -180,7 +279,7 @@ func (d *DocumentCollection) UnmarshalJSON(b []byte) error {
 	}
 
 	documentCollection := DocumentCollection{}
-	err = documentCollection.populate(&raw)
+	err = documentCollection.populate(&raw, 1)
 	if err != nil {
 		return err
 	}
@@ -191,8 +290,10 @@ func (d *DocumentCollection) UnmarshalJSON(b []byte) error {
 
 func (d *DocumentCollection) raw() (*rawDocumentCollection, error) {
 	raw := rawDocumentCollection{
-		ItemType: &d.ItemType,
-		Total:    d.Total,
+		ItemType:     &d.ItemType,
+		Total:        d.Total,
+		Offset:       d.Offset,
+		ItemsPerPage: d.ItemsPerPage,
 	}
 
 	if d.Items != nil {
@@ -211,7 +312,11 @@ func (d *DocumentCollection) raw() (*rawDocumentCollection, error) {
 	return &raw, nil
 }
 
-func (d *DocumentCollection) populate(raw *rawDocumentCollection) error {
+func (d *DocumentCollection) populate(raw *rawDocumentCollection, depth int) error {
+	if err := checkNestingDepth(depth); err != nil {
+		return err
+	}
+
 	// Create the document type instance and unmarshal the json to it
 	if raw.ItemType == nil {
 		return errors.New("document collection item type is required")
@@ -221,7 +326,7 @@ func (d *DocumentCollection) populate(raw *rawDocumentCollection) error {
 		d.Items = make([]Document, len(raw.Items))
 
 		for i, v := range raw.Items {
-			document, err := UnmarshalDocument(v, *raw.ItemType)
+			document, err := unmarshalNestedDocument(v, *raw.ItemType, depth)
 			if err != nil {
 				return err
 			}
@@ -232,10 +337,55 @@ func (d *DocumentCollection) populate(raw *rawDocumentCollection) error {
 
 	d.ItemType = *raw.ItemType
 	d.Total = raw.Total
+	d.Offset = raw.Offset
+	d.ItemsPerPage = raw.ItemsPerPage
 
 	return nil
 }
 
+// MaxDocumentNestingDepth defines the maximum nesting depth of DocumentContainer and DocumentCollection values during
+// the deserialization, protecting the process against maliciously deep documents.
+// The containers and collections in the fields of custom documents are deserialized by the JSON decoder, which starts
+// a new depth count for them, so they are limited only by their own nesting and not by the depth of the custom
+// document.
+// A zero or negative value disables the check.
+var MaxDocumentNestingDepth = 32
+
+func checkNestingDepth(depth int) error {
+	if MaxDocumentNestingDepth > 0 && depth > MaxDocumentNestingDepth {
+		return fmt.Errorf("the maximum document nesting depth of %v was exceeded", MaxDocumentNestingDepth)
+	}
+	return nil
+}
+
+// unmarshalNestedDocument deserializes a document contained by a DocumentContainer or DocumentCollection in the
+// specified depth. Nested containers and collections are deserialized directly, for tracking the nesting depth.
+func unmarshalNestedDocument(v *json.RawMessage, t MediaType, depth int) (Document, error) {
+	switch t {
+	case (&DocumentContainer{}).MediaType():
+		raw := rawDocumentContainer{}
+		if err := json.Unmarshal(*v, &raw); err != nil {
+			return nil, err
+		}
+		d := &DocumentContainer{}
+		if err := d.populate(&raw, depth+1); err != nil {
+			return nil, err
+		}
+		return d, nil
+	case (&DocumentCollection{}).MediaType():
+		raw := rawDocumentCollection{}
+		if err := json.Unmarshal(*v, &raw); err != nil {
+			return nil, err
+		}
+		d := &DocumentCollection{}
+		if err := d.populate(&raw, depth+1); err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+	return UnmarshalDocument(v, t)
+}
+
 // Ping allows the nodes to test the network connectivity.
 type Ping struct{}
 
@@ -147,6 +147,154 @@ func TestDocumentContainer_UnmarshalJSON_CustomJSON(t *testing.T) {
 	assert.Equal(t, *createTestJsonDocument(), *actual)
 }
 
+type testMsgPackDocument struct {
+	Property1 string `json:"property1"`
+}
+
+func (d *testMsgPackDocument) MediaType() MediaType {
+	return MediaType{"application", "x-lime-test", "msgpack"}
+}
+
+func TestDocumentContainer_UnmarshalJSON_MsgPack(t *testing.T) {
+	// Arrange
+	j := []byte(`{"type":"application/x-lime-test+msgpack","value":"galwcm9wZXJ0eTGmdmFsdWUx"}`)
+	var d DocumentContainer
+	RegisterDocumentFactory(func() Document {
+		return &testMsgPackDocument{}
+	})
+
+	// Act
+	err := json.Unmarshal(j, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	assert.Equal(t, MediaType{"application", "x-lime-test", "msgpack"}, d.Type)
+	actual, ok := d.Value.(*RawDocument)
+	if assert.True(t, ok) {
+		assert.Equal(t, d.Type, actual.Type)
+		assert.Equal(t, json.RawMessage(`"galwcm9wZXJ0eTGmdmFsdWUx"`), actual.Value)
+	}
+}
+
+func TestDocumentContainer_UnmarshalJSON_XML(t *testing.T) {
+	// Arrange
+	j := []byte(`{"type":"application/x-lime-test+xml","value":"<property1>value1</property1>"}`)
+	var d DocumentContainer
+
+	// Act
+	err := json.Unmarshal(j, &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	actual, ok := d.Value.(*RawDocument)
+	if assert.True(t, ok) {
+		assert.Equal(t, MediaType{"application", "x-lime-test", "xml"}, actual.Type)
+		assert.Equal(t, json.RawMessage(`"<property1>value1</property1>"`), actual.Value)
+	}
+}
+
+func createNestedContainerJSON(depth int) []byte {
+	j := `"text"`
+	t := `"text/plain"`
+	for i := 0; i < depth; i++ {
+		j = fmt.Sprintf(`{"type":%v,"value":%v}`, t, j)
+		t = `"application/vnd.lime.container+json"`
+	}
+	return []byte(j)
+}
+
+func TestDocumentContainer_UnmarshalJSON_MaxNestingDepth(t *testing.T) {
+	// Arrange
+	j := createNestedContainerJSON(MaxDocumentNestingDepth)
+	var d DocumentContainer
+
+	// Act
+	err := json.Unmarshal(j, &d)
+
+	// Assert
+	assert.NoError(t, err)
+	depth := 1
+	for c, ok := d.Value.(*DocumentContainer); ok; c, ok = c.Value.(*DocumentContainer) {
+		depth++
+	}
+	assert.Equal(t, MaxDocumentNestingDepth, depth)
+}
+
+func TestDocumentContainer_UnmarshalJSON_MaxNestingDepthExceeded(t *testing.T) {
+	// Arrange
+	j := createNestedContainerJSON(MaxDocumentNestingDepth + 1)
+	var d DocumentContainer
+
+	// Act
+	err := json.Unmarshal(j, &d)
+
+	// Assert
+	assert.EqualError(t, err, "the maximum document nesting depth of 32 was exceeded")
+}
+
+func TestDocumentCollection_UnmarshalJSON_MaxNestingDepthExceeded(t *testing.T) {
+	// Arrange
+	j := []byte(fmt.Sprintf(
+		`{"itemType":"application/vnd.lime.container+json","items":[%s]}`,
+		createNestedContainerJSON(MaxDocumentNestingDepth)))
+	var d DocumentCollection
+
+	// Act
+	err := json.Unmarshal(j, &d)
+
+	// Assert
+	assert.EqualError(t, err, "the maximum document nesting depth of 32 was exceeded")
+}
+
+type testNestingDocument struct {
+	Child *DocumentContainer `json:"child"`
+}
+
+func (d *testNestingDocument) MediaType() MediaType {
+	return MediaType{"application", "x-lime-nesting", "json"}
+}
+
+func TestDocumentContainer_UnmarshalJSON_MaxNestingDepthInCustomDocument(t *testing.T) {
+	// Arrange
+	RegisterDocumentFactory(func() Document {
+		return &testNestingDocument{}
+	})
+	outer := func(inner []byte) []byte {
+		j := fmt.Sprintf(`{"type":"application/x-lime-nesting+json","value":{"child":%s}}`, inner)
+		for i := 0; i < MaxDocumentNestingDepth-1; i++ {
+			j = fmt.Sprintf(`{"type":"application/vnd.lime.container+json","value":%s}`, j)
+		}
+		return []byte(j)
+	}
+	var d1, d2 DocumentContainer
+
+	// Act
+	err1 := json.Unmarshal(outer(createNestedContainerJSON(MaxDocumentNestingDepth)), &d1)
+	err2 := json.Unmarshal(outer(createNestedContainerJSON(MaxDocumentNestingDepth+1)), &d2)
+
+	// Assert
+	assert.NoError(t, err1)
+	assert.EqualError(t, err2, "the maximum document nesting depth of 32 was exceeded")
+}
+
+func TestMediaType_IsMsgPack(t *testing.T) {
+	// Arrange
+	m := MediaType{"application", "x-lime-test", "msgpack"}
+
+	// Act
+	isMsgPack := m.IsMsgPack()
+	isJson := m.IsJson()
+
+	// Assert
+	assert.True(t, isMsgPack)
+	assert.False(t, isJson)
+	assert.False(t, mediaTypeTestJson().IsMsgPack())
+}
+
 func TestDocumentCollection_MarshalJSON_Plain(t *testing.T) {
 	// Arrange
 	items := make([]Document, 3)
@@ -224,3 +372,152 @@ func TestDocumentCollection_UnmarshalJSON_JSON(t *testing.T) {
 		assert.Equal(t, JsonDocument{"text": fmt.Sprintf("Hello world %v!", i+1)}, *actual)
 	}
 }
+
+func TestDocumentCollection_Add(t *testing.T) {
+	// Arrange
+	c := NewDocumentCollection(nil, MediaTypeTextPlain())
+
+	// Act
+	c.Add(TextDocument("Hello world 1!")).Add(TextDocument("Hello world 2!"), TextDocument("Hello world 3!"))
+
+	// Assert
+	assert.Equal(t, 3, c.Total)
+	assert.Len(t, c.Items, 3)
+	assert.Equal(t, TextDocument("Hello world 3!"), c.Items[2])
+}
+
+func TestDocumentCollection_Add_WhenTypeMismatch(t *testing.T) {
+	// Arrange
+	c := NewDocumentCollection(nil, MediaTypeTextPlain())
+
+	// Act
+	f := func() {
+		c.Add(&JsonDocument{"text": "Hello world!"})
+	}
+
+	// Assert
+	assert.Panics(t, f)
+	assert.Equal(t, 0, c.Total)
+	assert.Empty(t, c.Items)
+}
+
+func TestDocumentCollection_MarshalJSON_Paginated(t *testing.T) {
+	// Arrange
+	c := NewDocumentCollection(nil, MediaTypeTextPlain()).
+		Add(TextDocument("Hello world 3!"), TextDocument("Hello world 4!")).
+		SetPage(2, 2)
+	c.Total = 5
+
+	// Act
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	assert.JSONEq(t, `{"total":5,"itemType":"text/plain","items":["Hello world 3!","Hello world 4!"],"offset":2,"itemsPerPage":2}`, string(b))
+}
+
+func TestDocumentCollection_UnmarshalJSON_Paginated(t *testing.T) {
+	// Arrange
+	j := []byte(`{"total":5,"itemType":"text/plain","items":["Hello world 3!","Hello world 4!"],"offset":2,"itemsPerPage":2}`)
+	var c DocumentCollection
+
+	// Act
+	err := json.Unmarshal(j, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	assert.Equal(t, 5, c.Total)
+	assert.Equal(t, 2, c.Offset)
+	assert.Equal(t, 2, c.ItemsPerPage)
+	assert.Len(t, c.Items, 2)
+}
+
+func TestResourceAs_MatchingType(t *testing.T) {
+	// Arrange
+	cmd := createGetPingCommand()
+	cmd.SetResource(createTestJsonDocument())
+
+	// Act
+	d, err := ResourceAs[*testJsonDocument](cmd)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, createTestJsonDocument(), d)
+}
+
+func TestResourceAs_MismatchedType(t *testing.T) {
+	// Arrange
+	cmd := createGetPingCommand()
+	cmd.SetResource(createJsonDocument())
+
+	// Act
+	d, err := ResourceAs[*testJsonDocument](cmd)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Nil(t, d)
+}
+
+func TestResourceAs_NilResource(t *testing.T) {
+	// Arrange
+	cmd := createGetPingCommand()
+
+	// Act
+	d, err := ResourceAs[*Ping](cmd)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Nil(t, d)
+}
+
+func TestContentAs_MatchingType(t *testing.T) {
+	// Arrange
+	msg := createMessage()
+
+	// Act
+	d, err := ContentAs[*TextDocument](msg)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, msg.Content, d)
+}
+
+func TestContainerAs_RoundTrip(t *testing.T) {
+	// Arrange
+	RegisterDocumentFactory(func() Document {
+		return &testJsonDocument{}
+	})
+	c := NewDocumentContainer(createTestJsonDocument())
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual DocumentContainer
+	if err := json.Unmarshal(b, &actual); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	d, err := ContainerAs[*testJsonDocument](&actual)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, mediaTypeTestJson(), actual.Type)
+	assert.Equal(t, createTestJsonDocument(), d)
+}
+
+func TestContainerAs_MismatchedType(t *testing.T) {
+	// Arrange
+	c := NewDocumentContainer(createJsonDocument())
+
+	// Act
+	d, err := ContainerAs[*testJsonDocument](c)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Nil(t, d)
+}
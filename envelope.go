@@ -5,8 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"time"
 )
 
+// MetadataKeyExpiration is the metadata key of the envelope expiration timestamp, in the RFC 3339 format.
+const MetadataKeyExpiration = "#expiration"
+
 // Envelope is the base struct to all protocol envelopes.
 type Envelope struct {
 	// ID is the envelope identifier
@@ -73,6 +77,30 @@ func (env *Envelope) SetMetadataKeyValue(key string, value string) *Envelope {
 	return env
 }
 
+// SetExpiration sets the envelope expiration timestamp in the metadata.
+func (env *Envelope) SetExpiration(expiration time.Time) *Envelope {
+	return env.SetMetadataKeyValue(MetadataKeyExpiration, expiration.UTC().Format(time.RFC3339Nano))
+}
+
+// Expiration returns the envelope expiration timestamp from the metadata, if defined and valid.
+func (env *Envelope) Expiration() (time.Time, bool) {
+	v, ok := env.Metadata[MetadataKeyExpiration]
+	if !ok {
+		return time.Time{}, false
+	}
+	expiration, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expiration, true
+}
+
+// Expired indicates if the envelope has an expiration timestamp that is before the specified time.
+func (env *Envelope) Expired(now time.Time) bool {
+	expiration, ok := env.Expiration()
+	return ok && expiration.Before(now)
+}
+
 // Sender returns the envelope sender Node.
 func (env *Envelope) Sender() Node {
 	if env.PP == (Node{}) {
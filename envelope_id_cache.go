@@ -0,0 +1,44 @@
+package lime
+
+import "container/list"
+
+// defaultEnvelopeIDCacheSize is the number of recently received envelope ids kept by channel for the detection of
+// duplicated envelopes.
+const defaultEnvelopeIDCacheSize = 256
+
+// envelopeIDCache is a bounded set of recently seen envelope ids.
+// When the capacity is reached, the least recently seen id is evicted.
+// It is not safe for concurrent use.
+type envelopeIDCache struct {
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+func newEnvelopeIDCache(capacity int) *envelopeIDCache {
+	if capacity <= 0 {
+		panic("capacity must be positive")
+	}
+	return &envelopeIDCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// add includes the id in the cache, returning false if it was already present.
+func (c *envelopeIDCache) add(id string) bool {
+	if e, ok := c.items[id]; ok {
+		c.order.MoveToFront(e)
+		return false
+	}
+
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(string))
+	}
+
+	c.items[id] = c.order.PushFront(id)
+	return true
+}
@@ -0,0 +1,35 @@
+package lime
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEnvelopeIDCache_Add(t *testing.T) {
+	// Arrange
+	cache := newEnvelopeIDCache(2)
+
+	// Act
+	added1 := cache.add("id1")
+	added2 := cache.add("id1")
+
+	// Assert
+	assert.True(t, added1)
+	assert.False(t, added2)
+}
+
+func TestEnvelopeIDCache_Add_EvictLeastRecentlySeen(t *testing.T) {
+	// Arrange
+	cache := newEnvelopeIDCache(2)
+	cache.add("id1")
+	cache.add("id2")
+	cache.add("id1")
+
+	// Act
+	cache.add("id3")
+
+	// Assert
+	assert.Len(t, cache.items, 2)
+	assert.False(t, cache.add("id1"))
+	assert.True(t, cache.add("id2"))
+}
@@ -0,0 +1,35 @@
+package lime
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEnvelope_Expiration(t *testing.T) {
+	// Arrange
+	env := &Envelope{}
+	expiration := time.Date(2021, 6, 1, 12, 30, 0, 0, time.UTC)
+
+	// Act
+	env.SetExpiration(expiration)
+
+	// Assert
+	actual, ok := env.Expiration()
+	assert.True(t, ok)
+	assert.True(t, expiration.Equal(actual))
+	assert.Equal(t, "2021-06-01T12:30:00Z", env.Metadata[MetadataKeyExpiration])
+	assert.True(t, env.Expired(expiration.Add(time.Second)))
+	assert.False(t, env.Expired(expiration.Add(-time.Second)))
+}
+
+func TestEnvelope_Expired_WhenNotDefined(t *testing.T) {
+	// Arrange
+	env := &Envelope{}
+
+	// Act
+	expired := env.Expired(time.Now())
+
+	// Assert
+	assert.False(t, expired)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"github.com/takenet/lime-go"
+	"github.com/takenet/lime-go/chat"
 	"log"
 	"net"
 	"os"
@@ -13,8 +14,27 @@ import (
 
 func main() {
 	addr := &net.TCPAddr{Port: 55321}
+	chat.RegisterChatDocuments()
 
 	server := lime.NewServerBuilder().
+		MessageHandlerFunc(
+			func(msg *lime.Message) bool {
+				txt, ok := msg.Content.(*lime.TextDocument)
+				return ok && *txt == "menu"
+			},
+			func(ctx context.Context, msg *lime.Message, s lime.Sender) error {
+				fmt.Printf("Menu requested - ID: %v - From: %v\n", msg.ID, msg.From)
+				yes, no := lime.TextDocument("yes"), lime.TextDocument("no")
+				menuMsg := &lime.Message{}
+				menuMsg.SetContent(&chat.Select{
+					Text: "Do you like Go?",
+					Options: []chat.SelectOption{
+						{Order: 1, Text: "Yes", Value: &yes},
+						{Order: 2, Text: "No", Value: &no},
+					},
+				}).SetTo(msg.From)
+				return s.SendMessage(ctx, menuMsg)
+			}).
 		MessagesHandlerFunc(
 			func(ctx context.Context, msg *lime.Message, s lime.Sender) error {
 				fmt.Printf("Message received - ID: %v - From: %v - Type: %v\n", msg.ID, msg.From, msg.Type)
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/takenet/lime-go"
-	"go.uber.org/multierr"
 	"log"
 	"math/rand"
 	"net"
@@ -21,8 +20,10 @@ var nodesToID = make(map[string]string)
 var mu sync.RWMutex
 var nodeFriends = make(map[string][]string)
 
+var server *lime.Server
+
 func main() {
-	server := lime.NewServerBuilder().
+	server = lime.NewServerBuilder().
 		// Handler for registering new user sessions
 		Register(func(ctx context.Context, candidate lime.Node, c *lime.ServerChannel) (lime.Node, error) {
 			mu.Lock()
@@ -44,7 +45,7 @@ func main() {
 			return candidate, nil
 		}).
 		// Callback for finished sessions, useful for updating our online users map
-		Finished(func(sessionID string) {
+		Finished(func(sessionID string, reason *lime.Reason, err error) {
 			mu.Lock()
 			defer mu.Unlock()
 			// Remove a finished session
@@ -58,8 +59,7 @@ func main() {
 		// Handler for commands with the "/friends" resource
 		RequestCommandHandlerFunc(
 			func(cmd *lime.RequestCommand) bool {
-				uri := cmd.URI.URL()
-				return cmd.ID != "" && strings.HasPrefix(uri.Path, "/friends")
+				return cmd.ID != "" && strings.HasPrefix(cmd.URI.Path(), "/friends")
 			},
 			handleFriendsCommand).
 		// Listen using the websocket transport in the 8080 port
@@ -104,12 +104,7 @@ func handleMessage(ctx context.Context, msg *lime.Message, _ lime.Sender) error
 		}
 	} else {
 		// Broadcast the message to all others sessions
-		senderSessionID, _ := lime.ContextSessionID(ctx)
-		for id, c := range channels {
-			if id != senderSessionID {
-				err = multierr.Append(err, c.SendMessage(ctx, msg))
-			}
-		}
+		err = server.Broadcast(ctx, msg)
 	}
 	return err
 }
@@ -139,21 +134,16 @@ func getFriends(node lime.Node, cmd *lime.RequestCommand) *lime.ResponseCommand
 	var respCmd *lime.ResponseCommand
 
 	if friends, ok := nodeFriends[node.Name]; ok {
-		items := make([]lime.Document, len(friends))
-		for i, f := range friends {
+		collection := lime.NewDocumentCollection(make([]lime.Document, 0, len(friends)), friendMediaType)
+		for _, f := range friends {
 			_, online := nodesToID[f]
-			items[i] = &Friend{
+			collection.Add(&Friend{
 				Nickname: f,
 				Online:   online,
-			}
+			})
 		}
 
-		respCmd = cmd.SuccessResponseWithResource(
-			&lime.DocumentCollection{
-				Total:    len(friends),
-				ItemType: friendMediaType,
-				Items:    items,
-			})
+		respCmd = cmd.SuccessResponseWithResource(collection)
 	} else {
 		respCmd = cmd.FailureResponse(&lime.Reason{
 			Code:        1,
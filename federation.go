@@ -0,0 +1,152 @@
+package lime
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// FederationLink connects a server to an upstream server, allowing the exchange of envelopes between the nodes of
+// the server domain and the nodes of other domains.
+// The envelopes received by the server that are addressed to other domains are forwarded to the upstream through a
+// Client, which handles the connection lifetime, including the reconnections. The envelopes received from the upstream
+// are delivered to the session channels of the destination nodes, which should be added to the link when established.
+// Only messages and notifications are forwarded, since the commands are processed by the servers themselves.
+type FederationLink struct {
+	domain   string
+	client   *Client
+	sessions SessionStore // sessions holds the local session channels that receive the envelopes from the upstream
+}
+
+// NewFederationLink creates a new instance of the FederationLink type for the specified local domain.
+// The config defines the connection with the upstream server, which is established on the first forwarded envelope
+// or by calling the Establish method.
+func NewFederationLink(domain string, config *ClientConfig) *FederationLink {
+	if domain == "" {
+		panic("empty domain")
+	}
+	l := &FederationLink{
+		domain:   domain,
+		sessions: NewMemorySessionStore(),
+	}
+	mux := &EnvelopeMux{}
+	mux.MessageHandlerFunc(
+		func(*Message) bool {
+			return true
+		},
+		l.deliverMessage)
+	mux.NotificationHandlerFunc(
+		func(*Notification) bool {
+			return true
+		},
+		l.deliverNotification)
+	l.client = NewClient(config, mux)
+	return l
+}
+
+// Establish forces the establishment of the session with the upstream server.
+func (l *FederationLink) Establish(ctx context.Context) error {
+	return l.client.Establish(ctx)
+}
+
+// Close finishes the session with the upstream server.
+func (l *FederationLink) Close() error {
+	return l.client.Close()
+}
+
+// IsRemote indicates if the specified node belongs to a domain other than the link local domain.
+// Nodes without domain are considered local.
+func (l *FederationLink) IsRemote(n Node) bool {
+	return n.Domain != "" && !strings.EqualFold(n.Domain, l.domain)
+}
+
+// AddChannel adds an established local session channel to the link, for receiving the envelopes from the upstream.
+// It is usually called by the ServerConfig.Established callback.
+func (l *FederationLink) AddChannel(c *ServerChannel) {
+	l.sessions.Add(c)
+}
+
+// RemoveChannel removes the local session channel with the specified session id from the link.
+// It is usually called by the ServerConfig.Finished callback.
+func (l *FederationLink) RemoveChannel(sessionID string) {
+	l.sessions.Remove(sessionID)
+}
+
+// RegisterHandlers registers in the mux the handlers for forwarding the messages and notifications addressed to
+// remote domains to the upstream server.
+// Note that the registration order matters, so the handlers should be registered before any catch-all handler.
+func (l *FederationLink) RegisterHandlers(mux *EnvelopeMux) {
+	mux.MessageHandlerFunc(
+		func(msg *Message) bool {
+			return l.IsRemote(msg.To)
+		},
+		func(ctx context.Context, msg *Message, s Sender) error {
+			setOriginator(ctx, &msg.Envelope)
+			if err := l.client.SendMessage(ctx, msg); err != nil {
+				return notifyRoutingFailed(ctx, s, msg, ReasonCodeRoutingGatewayNotFound, err)
+			}
+			return nil
+		})
+	mux.NotificationHandlerFunc(
+		func(not *Notification) bool {
+			return l.IsRemote(not.To)
+		},
+		func(ctx context.Context, not *Notification) error {
+			setOriginator(ctx, &not.Envelope)
+			if err := l.client.SendNotification(ctx, not); err != nil {
+				log.Printf("federation: forward notification: %v\n", err)
+			}
+			return nil
+		})
+}
+
+// setOriginator sets the session remote node as the envelope originator, if not defined, since the upstream
+// server is not aware of the local sessions.
+func setOriginator(ctx context.Context, env *Envelope) {
+	if env.From != (Node{}) {
+		return
+	}
+	if n, ok := ContextSessionRemoteNode(ctx); ok {
+		env.From = n
+	}
+}
+
+// channel returns the local session channel of the specified node.
+// If the node has no instance, any session of the node identity is returned.
+func (l *FederationLink) channel(n Node) (*ServerChannel, bool) {
+	return l.sessions.Get(n)
+}
+
+func (l *FederationLink) deliverMessage(ctx context.Context, msg *Message, s Sender) error {
+	c, ok := l.channel(msg.To)
+	if !ok {
+		return notifyRoutingFailed(
+			ctx, s, msg, ReasonCodeRoutingDestinationNotFound, fmt.Errorf("the destination '%v' was not found", msg.To))
+	}
+	if err := c.SendMessage(ctx, msg); err != nil {
+		return notifyRoutingFailed(ctx, s, msg, ReasonCodeRoutingError, err)
+	}
+	return nil
+}
+
+func (l *FederationLink) deliverNotification(ctx context.Context, not *Notification) error {
+	c, ok := l.channel(not.To)
+	if !ok {
+		// There's no one to notify about the failure
+		return nil
+	}
+	if err := c.SendNotification(ctx, not); err != nil {
+		log.Printf("federation: deliver notification: %v\n", err)
+	}
+	return nil
+}
+
+// notifyRoutingFailed sends a 'failed' notification for a message that could not be routed, if it has an id.
+// Routing failures are not returned as errors, since they would stop the listener of the channel.
+func notifyRoutingFailed(ctx context.Context, s NotificationSender, msg *Message, code int, err error) error {
+	if msg.ID == "" {
+		return nil
+	}
+	return NotifyFailed(ctx, s, msg, &Reason{Code: code, Description: err.Error()})
+}
@@ -0,0 +1,137 @@
+package lime
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"golang.org/x/sync/errgroup"
+	"testing"
+	"time"
+)
+
+func TestFederationLink_IsRemote(t *testing.T) {
+	// Arrange
+	link := NewFederationLink("a.com", nil)
+	defer silentClose(link)
+
+	// Act
+	local := link.IsRemote(ParseNode("alice@A.com/home"))
+	remote := link.IsRemote(ParseNode("bob@b.com/home"))
+	noDomain := link.IsRemote(ParseNode("alice"))
+
+	// Assert
+	assert.False(t, local)
+	assert.True(t, remote)
+	assert.False(t, noDomain)
+}
+
+func TestFederationLink_RemoveChannel_WhenNodeHasNewerSession(t *testing.T) {
+	// Arrange
+	link := NewFederationLink("a.com", nil)
+	defer silentClose(link)
+	node := ParseNode("alice@a.com/home")
+	c1 := createStoredServerChannel("session1", node)
+	c2 := createStoredServerChannel("session2", node)
+	link.AddChannel(c1)
+	link.AddChannel(c2)
+
+	// Act
+	link.RemoveChannel("session1")
+
+	// Assert
+	actual, ok := link.channel(node)
+	assert.True(t, ok)
+	assert.Same(t, c2, actual)
+}
+
+func TestFederationLink_ForwardMessage(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	upstreamAddr := InProcessAddr("b.com")
+	upstreamMsgChan := make(chan *Message, 1)
+	upstream := NewServerBuilder().
+		Domain("b.com").
+		ListenInProcess(upstreamAddr).
+		EnableGuestAuthentication().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			upstreamMsgChan <- msg
+			reply := createMessage()
+			reply.SetNewEnvelopeID()
+			reply.From = msg.To
+			reply.To = msg.From
+			return s.SendMessage(ctx, reply)
+		}).
+		Build()
+	defer silentClose(upstream)
+	config := NewClientConfig()
+	config.Node = Node{Identity: Identity{Name: NewEnvelopeID(), Domain: "a.com"}, Instance: "server1"}
+	config.NewTransport = func(ctx context.Context) (Transport, error) {
+		return DialInProcess(upstreamAddr, 1)
+	}
+	link := NewFederationLink("a.com", config)
+	defer silentClose(link)
+	addr := InProcessAddr("a.com")
+	srv := NewServerBuilder().
+		Domain("a.com").
+		ListenInProcess(addr).
+		EnableGuestAuthentication().
+		FederationLink(link).
+		Established(func(sessionID string, c *ServerChannel) {
+			link.AddChannel(c)
+		}).
+		Finished(func(sessionID string, reason *Reason, err error) {
+			link.RemoveChannel(sessionID)
+		}).
+		Build()
+	defer silentClose(srv)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(upstream.ListenAndServe)
+	eg.Go(srv.ListenAndServe)
+	time.Sleep(16 * time.Millisecond)
+	client, _ := DialInProcess(addr, 1)
+	defer silentClose(client)
+	channel := NewClientChannel(client, 1)
+	defer silentClose(channel)
+	_, _ = channel.EstablishSession(
+		ctx,
+		func([]SessionCompression) SessionCompression {
+			return SessionCompressionNone
+		},
+		func([]SessionEncryption) SessionEncryption {
+			return SessionEncryptionNone
+		},
+		Identity{
+			Name:   NewEnvelopeID(),
+			Domain: "a.com",
+		},
+		func([]AuthenticationScheme, Authentication) Authentication {
+			return &GuestAuthentication{}
+		},
+		"default")
+	msg := createMessage()
+	msg.From = Node{}
+	msg.To = ParseNode("bob@b.com/home")
+
+	// Act
+	err := channel.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "upstream receive message timeout")
+	case actual := <-upstreamMsgChan:
+		assert.Equal(t, msg.ID, actual.ID)
+		assert.Equal(t, msg.To, actual.To)
+		assert.Equal(t, channel.LocalNode(), actual.From)
+	}
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive reply timeout")
+	case reply := <-channel.MsgChan():
+		assert.Equal(t, msg.To, reply.From)
+		assert.Equal(t, channel.LocalNode(), reply.To)
+	}
+}
@@ -4,6 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"time"
 )
 
 type EnvelopeMux struct {
@@ -11,9 +16,17 @@ type EnvelopeMux struct {
 	notHandlers     []NotificationHandler
 	reqCmdHandlers  []RequestCommandHandler
 	respCmdHandlers []ResponseCommandHandler
+	msgMiddlewares  []MessageMiddleware
+	noRecover       bool // noRecover indicates if the panics of the handlers should not be recovered
+	// defaultCmdResponse indicates if a failure response should be sent for the request commands not matched by any
+	// handler
+	defaultCmdResponse bool
+	// deadLetter is called for the messages that can't be delivered, if defined
+	deadLetter func(ctx context.Context, msg *Message) error
 }
 
 func (m *EnvelopeMux) ListenServer(ctx context.Context, c *ServerChannel) error {
+	ctx = context.WithValue(ctx, contextKeyServerChannel, c)
 	if err := m.listen(ctx, c.channel); err != nil {
 		return fmt.Errorf("listen server: %w", err)
 	}
@@ -31,6 +44,7 @@ func (m *EnvelopeMux) listen(ctx context.Context, c *channel) error {
 	if err := c.ensureEstablished("receive"); err != nil {
 		return err
 	}
+	c.trackReceivedAt()
 
 	for c.Established() && ctx.Err() == nil {
 		ctx := sessionContext(ctx, c)
@@ -44,28 +58,36 @@ func (m *EnvelopeMux) listen(ctx context.Context, c *channel) error {
 			if !ok {
 				return errors.New("msg chan: channel closed")
 			}
-			if err := m.handleMessage(ctx, msg, c); err != nil {
+			if err := m.recoverHandler(ctx, msg, c, func() error {
+				return m.handleMessage(correlationContext(receivedAtContext(ctx, c, msg), c, &msg.Envelope), msg, c)
+			}); err != nil {
 				return err
 			}
 		case not, ok := <-c.NotChan():
 			if !ok {
 				return errors.New("not chan: channel closed")
 			}
-			if err := m.handleNotification(ctx, not); err != nil {
+			if err := m.recoverHandler(ctx, not, c, func() error {
+				return m.handleNotification(correlationContext(receivedAtContext(ctx, c, not), c, &not.Envelope), not)
+			}); err != nil {
 				return err
 			}
 		case reqCmd, ok := <-c.ReqCmdChan():
 			if !ok {
 				return errors.New("req cmd chan: channel closed")
 			}
-			if err := m.handleRequestCommand(ctx, reqCmd, c); err != nil {
+			if err := m.recoverHandler(ctx, reqCmd, c, func() error {
+				return m.handleRequestCommand(correlationContext(receivedAtContext(ctx, c, reqCmd), c, &reqCmd.Envelope), reqCmd, c)
+			}); err != nil {
 				return err
 			}
 		case respCmd, ok := <-c.RespCmdChan():
 			if !ok {
 				return errors.New("resp cmd chan: channel closed")
 			}
-			if err := m.handleResponseCommand(ctx, respCmd, c); err != nil {
+			if err := m.recoverHandler(ctx, respCmd, c, func() error {
+				return m.handleResponseCommand(correlationContext(receivedAtContext(ctx, c, respCmd), c, &respCmd.Envelope), respCmd, c)
+			}); err != nil {
 				return err
 			}
 		}
@@ -73,15 +95,78 @@ func (m *EnvelopeMux) listen(ctx context.Context, c *channel) error {
 	return ctx.Err()
 }
 
+// recoverHandler executes the handling of the envelope, recovering from panics in the handlers for keeping the
+// session alive. The panic is logged and, for request commands, a failure response is sent to the command sender.
+func (m *EnvelopeMux) recoverHandler(ctx context.Context, e envelope, s Sender, handle func() error) (err error) {
+	if m.noRecover {
+		return handle()
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		log.Printf("mux: panic handling the envelope '%v': %v\n%s", envelopeOf(e).ID, r, debug.Stack())
+		if cmd, ok := e.(*RequestCommand); ok && cmd.ID != "" {
+			err = s.SendResponseCommand(ctx, cmd.FailureResponse(&Reason{
+				Code:        ReasonCodeCommandProcessingError,
+				Description: "An unexpected error occurred while processing the command",
+			}))
+		}
+	}()
+	return handle()
+}
+
+// DisablePanicRecovery disables the recovery from panics in the handlers, which are recovered by default for keeping
+// the session alive. It may be useful for debugging, since the panics are propagated.
+func (m *EnvelopeMux) DisablePanicRecovery() {
+	m.noRecover = true
+}
+
+// DefaultCommandResponse enables sending a failure response for the request commands not matched by any handler,
+// instead of ignoring them. It avoids the command senders waiting for a response until a timeout.
+func (m *EnvelopeMux) DefaultCommandResponse() {
+	m.defaultCmdResponse = true
+}
+
 func (m *EnvelopeMux) handleMessage(ctx context.Context, msg *Message, s Sender) error {
+	if err := validateDocument(msg.Type, msg.Content); err != nil {
+		if msg.ID == "" {
+			return nil
+		}
+		return NotifyFailed(ctx, s, msg, validationReason(err, ReasonCodeValidationError))
+	}
+
+	handlerFunc := m.dispatchMessage
+	for i := len(m.msgMiddlewares) - 1; i >= 0; i-- {
+		handlerFunc = m.msgMiddlewares[i](handlerFunc)
+	}
+	return handlerFunc(ctx, msg, s)
+}
+
+func (m *EnvelopeMux) dispatchMessage(ctx context.Context, msg *Message, s Sender) error {
 	for _, h := range m.msgHandlers {
 		if !h.Match(msg) {
 			continue
 		}
 		if err := h.Handle(ctx, msg, s); err != nil {
+			if m.deadLetter != nil && IsRoutingMiss(err) {
+				return m.handleDeadLetter(ctx, msg)
+			}
 			return fmt.Errorf("handle message: %w", err)
 		}
-		break
+		return nil
+	}
+	if m.deadLetter != nil {
+		return m.handleDeadLetter(ctx, msg)
+	}
+	return nil
+}
+
+func (m *EnvelopeMux) handleDeadLetter(ctx context.Context, msg *Message) error {
+	if err := m.deadLetter(ctx, msg); err != nil {
+		return fmt.Errorf("dead letter: %w", err)
 	}
 	return nil
 }
@@ -100,6 +185,14 @@ func (m *EnvelopeMux) handleNotification(ctx context.Context, not *Notification)
 }
 
 func (m *EnvelopeMux) handleRequestCommand(ctx context.Context, cmd *RequestCommand, s Sender) error {
+	if cmd.Type != nil {
+		if err := validateDocument(*cmd.Type, cmd.Resource); err != nil {
+			return s.SendResponseCommand(
+				ctx,
+				cmd.FailureResponse(validationReason(err, ReasonCodeValidationInvalidResource)))
+		}
+	}
+
 	for _, h := range m.reqCmdHandlers {
 		if !h.Match(cmd) {
 			continue
@@ -107,7 +200,14 @@ func (m *EnvelopeMux) handleRequestCommand(ctx context.Context, cmd *RequestComm
 		if err := h.Handle(ctx, cmd, s); err != nil {
 			return fmt.Errorf("handle command: %w", err)
 		}
-		break
+		return nil
+	}
+
+	if m.defaultCmdResponse && cmd.ID != "" {
+		return s.SendResponseCommand(ctx, cmd.FailureResponse(&Reason{
+			Code:        ReasonCodeCommandResourceNotSupported,
+			Description: "There's no handler for the command",
+		}))
 	}
 	return nil
 }
@@ -139,6 +239,15 @@ func (m *EnvelopeMux) MessageHandler(handler MessageHandler) {
 	m.msgHandlers = append(m.msgHandlers, handler)
 }
 
+// MessageMiddleware allows the registration of a MessageMiddleware, which wraps the dispatching of all received
+// messages to the registered handlers. The middlewares are executed in the registration order.
+func (m *EnvelopeMux) MessageMiddleware(middleware MessageMiddleware) {
+	if middleware == nil {
+		panic("nil middleware")
+	}
+	m.msgMiddlewares = append(m.msgMiddlewares, middleware)
+}
+
 func (m *EnvelopeMux) NotificationHandlerFunc(predicate NotificationPredicate, f NotificationHandlerFunc) {
 	m.NotificationHandler(&notificationHandler{
 		predicate:   predicate,
@@ -161,6 +270,15 @@ func (m *EnvelopeMux) RequestCommandHandler(handler RequestCommandHandler) {
 	m.reqCmdHandlers = append(m.reqCmdHandlers, handler)
 }
 
+// RequestCommandRouter allows the registration of a CommandRouter for handling the received commands that matches
+// its routes. Note that the registration order matters, since the receiving process stops when the first match occurs.
+func (m *EnvelopeMux) RequestCommandRouter(router *CommandRouter) {
+	if router == nil {
+		panic("nil router")
+	}
+	m.RequestCommandHandler(&commandRouterHandler{router: router})
+}
+
 func (m *EnvelopeMux) ResponseCommandHandlerFunc(predicate ResponseCommandPredicate, f ResponseCommandHandlerFunc) {
 	m.ResponseCommandHandler(&responseCommandHandler{
 		predicate:   predicate,
@@ -172,6 +290,79 @@ func (m *EnvelopeMux) ResponseCommandHandler(handler ResponseCommandHandler) {
 	m.respCmdHandlers = append(m.respCmdHandlers, handler)
 }
 
+// HandlerKind is the kind of envelope processed by a handler registered in the EnvelopeMux.
+type HandlerKind string
+
+const (
+	HandlerKindMessage         = HandlerKind("message")
+	HandlerKindNotification    = HandlerKind("notification")
+	HandlerKindRequestCommand  = HandlerKind("reqcmd")
+	HandlerKindResponseCommand = HandlerKind("respcmd")
+)
+
+// HandlerDescriptor describes a handler registered in the EnvelopeMux, for debugging purposes.
+type HandlerDescriptor struct {
+	// Kind is the kind of envelope processed by the handler.
+	Kind HandlerKind
+	// Index is the registration index of the handler between the handlers of the same kind, which is the order of the
+	// predicate evaluation.
+	Index int
+	// Predicate is a human-readable description of the handler predicate, like the predicate function name.
+	Predicate string
+}
+
+// Describe returns the descriptors of the registered handlers, grouped by kind in the registration order.
+func (m *EnvelopeMux) Describe() []HandlerDescriptor {
+	var descriptors []HandlerDescriptor
+	for i, h := range m.msgHandlers {
+		var p interface{} = h
+		if mh, ok := h.(*messageHandler); ok {
+			p = mh.predicate
+		}
+		descriptors = append(descriptors, HandlerDescriptor{HandlerKindMessage, i, describePredicate(p)})
+	}
+	for i, h := range m.notHandlers {
+		var p interface{} = h
+		if nh, ok := h.(*notificationHandler); ok {
+			p = nh.predicate
+		}
+		descriptors = append(descriptors, HandlerDescriptor{HandlerKindNotification, i, describePredicate(p)})
+	}
+	for i, h := range m.reqCmdHandlers {
+		var p interface{} = h
+		if ch, ok := h.(*requestCommandHandler); ok {
+			p = ch.predicate
+		}
+		descriptors = append(descriptors, HandlerDescriptor{HandlerKindRequestCommand, i, describePredicate(p)})
+	}
+	for i, h := range m.respCmdHandlers {
+		var p interface{} = h
+		if ch, ok := h.(*responseCommandHandler); ok {
+			p = ch.predicate
+		}
+		descriptors = append(descriptors, HandlerDescriptor{HandlerKindResponseCommand, i, describePredicate(p)})
+	}
+	return descriptors
+}
+
+// describePredicate returns the function name for predicate functions or the type name for custom handlers.
+func describePredicate(p interface{}) string {
+	if _, ok := p.(*commandRouterHandler); ok {
+		return "command router"
+	}
+	v := reflect.ValueOf(p)
+	if v.Kind() != reflect.Func {
+		return fmt.Sprintf("%T", p)
+	}
+	if v.IsNil() {
+		return "any"
+	}
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+	return "unknown"
+}
+
 // MessageHandler defines a handler for processing Message instances received from a channel.
 type MessageHandler interface {
 	// Match indicates if the specified Message should be handled by the instance.
@@ -188,6 +379,38 @@ type MessagePredicate func(msg *Message) bool
 // MessageHandlerFunc defines an action to be executed to a Message.
 type MessageHandlerFunc func(ctx context.Context, msg *Message, s Sender) error
 
+// MessageMiddleware defines a function that wraps a MessageHandlerFunc, allowing the execution of actions before or
+// after the message handling.
+type MessageMiddleware func(next MessageHandlerFunc) MessageHandlerFunc
+
+// NotifyFailed sends a 'failed' notification with the specified reason to the sender of the original message.
+func NotifyFailed(ctx context.Context, s NotificationSender, original *Message, reason *Reason) error {
+	return s.SendNotification(ctx, original.FailedNotification(reason))
+}
+
+// notifyFailedMiddleware sends a 'failed' notification when the message handling returns a ReasonError, stopping
+// the error propagation.
+func notifyFailedMiddleware(next MessageHandlerFunc) MessageHandlerFunc {
+	return func(ctx context.Context, msg *Message, s Sender) error {
+		err := next(ctx, msg, s)
+		var reasonErr *ReasonError
+		if err == nil || msg.ID == "" || !errors.As(err, &reasonErr) {
+			return err
+		}
+		return NotifyFailed(ctx, s, msg, ReasonFromError(err))
+	}
+}
+
+// validationReason creates a Reason for the document validation error, using the specified code if the error is not
+// a ReasonError.
+func validationReason(err error, code int) *Reason {
+	var reasonErr *ReasonError
+	if errors.As(err, &reasonErr) && reasonErr.Reason != nil {
+		return reasonErr.Reason
+	}
+	return &Reason{Code: code, Description: err.Error()}
+}
+
 type messageHandler struct {
 	predicate   MessagePredicate
 	handlerFunc MessageHandlerFunc
@@ -246,12 +469,83 @@ type RequestCommandHandler interface {
 	Handle(ctx context.Context, cmd *RequestCommand, s Sender) error
 }
 
+// RequireRole wraps the specified RequestCommandHandlerFunc, allowing its execution only if the session remote node
+// domain role, obtained from the context, satisfies the required role. Otherwise, a failure response with the
+// ReasonCodeAuthorizationError code is sent to the command sender.
+func RequireRole(role DomainRole, inner RequestCommandHandlerFunc) RequestCommandHandlerFunc {
+	if inner == nil {
+		panic("nil handler func")
+	}
+	return func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+		if r, ok := ContextDomainRole(ctx); !ok || !r.Satisfies(role) {
+			return s.SendResponseCommand(
+				ctx,
+				cmd.FailureResponse(&Reason{
+					Code:        ReasonCodeAuthorizationError,
+					Description: fmt.Sprintf("The '%v' role is required", role),
+				}))
+		}
+		return inner(ctx, cmd, s)
+	}
+}
+
+// retryable is implemented by errors that indicate if the failed operation can be retried, like transient failures
+// of downstream services.
+type retryable interface {
+	Retryable() bool
+}
+
+func isRetryable(err error) bool {
+	var r retryable
+	return errors.As(err, &r) && r.Retryable()
+}
+
+// RetryMiddleware creates a RequestCommandMiddleware that re-executes the handler when it returns a retryable error,
+// which is an error that implements a Retryable() bool method returning true.
+// The handler is executed up to maxAttempts times, waiting between the attempts the duration returned by the backoff
+// function for the attempt number, starting at 1. If the attempts are exhausted, a failure response with the reason
+// of the last error is sent to the command sender. Other errors are returned without retrying.
+func RetryMiddleware(maxAttempts int, backoff func(attempt int) time.Duration) RequestCommandMiddleware {
+	if maxAttempts <= 0 {
+		panic("maxAttempts must be positive")
+	}
+	return func(next RequestCommandHandlerFunc) RequestCommandHandlerFunc {
+		if next == nil {
+			panic("nil handler func")
+		}
+		return func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+			var err error
+			for attempt := 1; attempt <= maxAttempts; attempt++ {
+				if err = next(ctx, cmd, s); err == nil || !isRetryable(err) {
+					return err
+				}
+				if attempt == maxAttempts || backoff == nil {
+					continue
+				}
+
+				timer := time.NewTimer(backoff(attempt))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+			return s.SendResponseCommand(ctx, cmd.FailureResponse(ReasonFromError(err)))
+		}
+	}
+}
+
 // RequestCommandPredicate defines an expression for checking if the specified RequestCommand satisfies a condition.
 type RequestCommandPredicate func(cmd *RequestCommand) bool
 
 // RequestCommandHandlerFunc defines an action to be executed to a RequestCommand.
 type RequestCommandHandlerFunc func(ctx context.Context, cmd *RequestCommand, s Sender) error
 
+// RequestCommandMiddleware defines a function that wraps a RequestCommandHandlerFunc, allowing the execution of
+// actions before or after the command handling.
+type RequestCommandMiddleware func(next RequestCommandHandlerFunc) RequestCommandHandlerFunc
+
 type requestCommandHandler struct {
 	predicate   RequestCommandPredicate
 	handlerFunc RequestCommandHandlerFunc
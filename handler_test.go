@@ -0,0 +1,432 @@
+package lime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type senderMock struct {
+	envelopes []envelope
+}
+
+func (s *senderMock) SendMessage(_ context.Context, msg *Message) error {
+	s.envelopes = append(s.envelopes, msg)
+	return nil
+}
+
+func (s *senderMock) SendNotification(_ context.Context, not *Notification) error {
+	s.envelopes = append(s.envelopes, not)
+	return nil
+}
+
+func (s *senderMock) SendRequestCommand(_ context.Context, cmd *RequestCommand) error {
+	s.envelopes = append(s.envelopes, cmd)
+	return nil
+}
+
+func (s *senderMock) SendResponseCommand(_ context.Context, cmd *ResponseCommand) error {
+	s.envelopes = append(s.envelopes, cmd)
+	return nil
+}
+
+func TestNotifyFailed(t *testing.T) {
+	// Arrange
+	s := &senderMock{}
+	msg := createMessage()
+	msg.SetFromString("golang@limeprotocol.org/client")
+	reason := &Reason{Code: ReasonCodeMessageUnsupportedContentType, Description: "Unsupported content"}
+
+	// Act
+	err := NotifyFailed(context.Background(), s, msg, reason)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.Len(t, s.envelopes, 1) {
+		not := s.envelopes[0].(*Notification)
+		assert.Equal(t, msg.ID, not.ID)
+		assert.Equal(t, msg.Sender(), not.To)
+		assert.Equal(t, NotificationEventFailed, not.Event)
+		assert.Equal(t, reason, not.Reason)
+	}
+}
+
+func TestEnvelopeMux_MessageMiddleware_NotifyFailedOnReasonError(t *testing.T) {
+	// Arrange
+	s := &senderMock{}
+	mux := &EnvelopeMux{}
+	mux.MessageMiddleware(notifyFailedMiddleware)
+	mux.MessageHandlerFunc(
+		func(*Message) bool {
+			return true
+		},
+		func(ctx context.Context, msg *Message, s Sender) error {
+			return fmt.Errorf("handler: %w", NewReasonError(ReasonCodeMessageProcessingError, "Processing failed"))
+		})
+	msg := createMessage()
+
+	// Act
+	err := mux.handleMessage(context.Background(), msg, s)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.Len(t, s.envelopes, 1) {
+		not := s.envelopes[0].(*Notification)
+		assert.Equal(t, msg.ID, not.ID)
+		assert.Equal(t, NotificationEventFailed, not.Event)
+		assert.Equal(t, &Reason{Code: ReasonCodeMessageProcessingError, Description: "Processing failed"}, not.Reason)
+	}
+}
+
+func TestEnvelopeMux_MessageMiddleware_PropagateOtherErrors(t *testing.T) {
+	// Arrange
+	s := &senderMock{}
+	mux := &EnvelopeMux{}
+	mux.MessageMiddleware(notifyFailedMiddleware)
+	mux.MessageHandlerFunc(
+		func(*Message) bool {
+			return true
+		},
+		func(ctx context.Context, msg *Message, s Sender) error {
+			return errors.New("unexpected error")
+		})
+
+	// Act
+	err := mux.handleMessage(context.Background(), createMessage(), s)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Empty(t, s.envelopes)
+}
+
+func mediaTypeTestValidated() MediaType {
+	return MediaType{"application", "x-lime-validated", "json"}
+}
+
+func registerTestValidator() {
+	RegisterDocumentValidator(mediaTypeTestValidated(), func(d Document) error {
+		doc, ok := d.(*JsonDocument)
+		if !ok {
+			return errors.New("unexpected document type")
+		}
+		if _, ok := (*doc)["name"]; !ok {
+			return errors.New("the name property is required")
+		}
+		return nil
+	})
+}
+
+func TestEnvelopeMux_HandleMessage_WhenDocumentInvalid(t *testing.T) {
+	// Arrange
+	registerTestValidator()
+	s := &senderMock{}
+	mux := &EnvelopeMux{}
+	handled := false
+	mux.MessageHandlerFunc(nil, func(ctx context.Context, msg *Message, s Sender) error {
+		handled = true
+		return nil
+	})
+	msg := createMessage()
+	msg.SetFromString("golang@limeprotocol.org/client")
+	msg.Content = &JsonDocument{"address": "Main street"}
+	msg.Type = mediaTypeTestValidated()
+
+	// Act
+	err := mux.handleMessage(context.Background(), msg, s)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.False(t, handled)
+	if assert.Len(t, s.envelopes, 1) {
+		not := s.envelopes[0].(*Notification)
+		assert.Equal(t, msg.ID, not.ID)
+		assert.Equal(t, msg.Sender(), not.To)
+		assert.Equal(t, NotificationEventFailed, not.Event)
+		assert.Equal(t, &Reason{Code: ReasonCodeValidationError, Description: "the name property is required"}, not.Reason)
+	}
+}
+
+func TestEnvelopeMux_HandleMessage_WhenDocumentValid(t *testing.T) {
+	// Arrange
+	registerTestValidator()
+	s := &senderMock{}
+	mux := &EnvelopeMux{}
+	handled := false
+	mux.MessageHandlerFunc(nil, func(ctx context.Context, msg *Message, s Sender) error {
+		handled = true
+		return nil
+	})
+	msg := createMessage()
+	msg.Content = &JsonDocument{"name": "John Doe"}
+	msg.Type = mediaTypeTestValidated()
+
+	// Act
+	err := mux.handleMessage(context.Background(), msg, s)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, handled)
+	assert.Empty(t, s.envelopes)
+}
+
+func TestEnvelopeMux_HandleRequestCommand_WhenDocumentInvalid(t *testing.T) {
+	// Arrange
+	registerTestValidator()
+	s := &senderMock{}
+	mux := &EnvelopeMux{}
+	handled := false
+	mux.RequestCommandHandlerFunc(nil, func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+		handled = true
+		return nil
+	})
+	cmd := createGetPingCommand()
+	cmd.Method = CommandMethodSet
+	cmd.Resource = &JsonDocument{"address": "Main street"}
+	mt := mediaTypeTestValidated()
+	cmd.Type = &mt
+
+	// Act
+	err := mux.handleRequestCommand(context.Background(), cmd, s)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.False(t, handled)
+	if assert.Len(t, s.envelopes, 1) {
+		resp := s.envelopes[0].(*ResponseCommand)
+		assert.Equal(t, cmd.ID, resp.ID)
+		assert.Equal(t, CommandStatusFailure, resp.Status)
+		assert.Equal(t, &Reason{Code: ReasonCodeValidationInvalidResource, Description: "the name property is required"}, resp.Reason)
+	}
+}
+
+func TestEnvelopeMux_HandleRequestCommand_WhenNoURI(t *testing.T) {
+	// Arrange
+	s := &senderMock{}
+	b := NewServerBuilder().
+		AutoReplyPings().
+		RequestCommandHandlerFunc(
+			func(cmd *RequestCommand) bool {
+				return cmd.URI.Path() == "/presence"
+			},
+			func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+				return s.SendResponseCommand(ctx, cmd.SuccessResponse())
+			}).
+		RequestCommandsHandlerFunc(
+			func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+				return s.SendResponseCommand(
+					ctx,
+					cmd.FailureResponse(&Reason{Code: ReasonCodeValidationInvalidURI, Description: cmd.URI.String()}))
+			})
+	var cmd RequestCommand
+	err := json.Unmarshal([]byte(`{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","method":"get"}`), &cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	err = b.mux.handleRequestCommand(context.Background(), &cmd, s)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Nil(t, cmd.URI)
+	if assert.Len(t, s.envelopes, 1) {
+		resp := s.envelopes[0].(*ResponseCommand)
+		assert.Equal(t, CommandStatusFailure, resp.Status)
+		assert.Equal(t, &Reason{Code: ReasonCodeValidationInvalidURI}, resp.Reason)
+	}
+}
+
+func TestRequireRole_WhenRoleSatisfied(t *testing.T) {
+	// Arrange
+	s := &senderMock{}
+	called := false
+	h := RequireRole(DomainRoleAuthority, func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+		called = true
+		return s.SendResponseCommand(ctx, cmd.SuccessResponse())
+	})
+	ctx := sessionContext(context.Background(), &channel{remoteRole: DomainRoleRootAuthority})
+	cmd := createGetPingCommand()
+
+	// Act
+	err := h(ctx, cmd, s)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, called)
+	if assert.Len(t, s.envelopes, 1) {
+		resp := s.envelopes[0].(*ResponseCommand)
+		assert.Equal(t, CommandStatusSuccess, resp.Status)
+	}
+}
+
+func TestRequireRole_WhenRoleNotSatisfied(t *testing.T) {
+	// Arrange
+	s := &senderMock{}
+	called := false
+	h := RequireRole(DomainRoleAuthority, func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+		called = true
+		return nil
+	})
+	ctx := sessionContext(context.Background(), &channel{remoteRole: DomainRoleMember})
+	cmd := createGetPingCommand()
+
+	// Act
+	err := h(ctx, cmd, s)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.False(t, called)
+	if assert.Len(t, s.envelopes, 1) {
+		resp := s.envelopes[0].(*ResponseCommand)
+		assert.Equal(t, cmd.ID, resp.ID)
+		assert.Equal(t, CommandStatusFailure, resp.Status)
+		assert.Equal(t, &Reason{Code: ReasonCodeAuthorizationError, Description: "The 'authority' role is required"}, resp.Reason)
+	}
+}
+
+func TestRequireRole_WhenNoRole(t *testing.T) {
+	// Arrange
+	s := &senderMock{}
+	called := false
+	h := RequireRole(DomainRoleMember, func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+		called = true
+		return nil
+	})
+	cmd := createGetPingCommand()
+
+	// Act
+	err := h(context.Background(), cmd, s)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.False(t, called)
+	if assert.Len(t, s.envelopes, 1) {
+		assert.Equal(t, CommandStatusFailure, s.envelopes[0].(*ResponseCommand).Status)
+	}
+}
+
+type retryableErrorMock struct {
+	retryable bool
+}
+
+func (e *retryableErrorMock) Error() string {
+	return "downstream service unavailable"
+}
+
+func (e *retryableErrorMock) Retryable() bool {
+	return e.retryable
+}
+
+func TestRetryMiddleware_WhenHandlerFailsTwiceThenSucceeds(t *testing.T) {
+	// Arrange
+	s := &senderMock{}
+	attempts := 0
+	var backoffs []int
+	h := RetryMiddleware(3, func(attempt int) time.Duration {
+		backoffs = append(backoffs, attempt)
+		return time.Millisecond
+	})(func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+		attempts++
+		if attempts < 3 {
+			return &retryableErrorMock{retryable: true}
+		}
+		return s.SendResponseCommand(ctx, cmd.SuccessResponse())
+	})
+	cmd := createGetPingCommand()
+
+	// Act
+	err := h(context.Background(), cmd, s)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []int{1, 2}, backoffs)
+	if assert.Len(t, s.envelopes, 1) {
+		resp := s.envelopes[0].(*ResponseCommand)
+		assert.Equal(t, CommandStatusSuccess, resp.Status)
+	}
+}
+
+func TestRetryMiddleware_WhenAttemptsExhausted(t *testing.T) {
+	// Arrange
+	s := &senderMock{}
+	attempts := 0
+	h := RetryMiddleware(2, nil)(func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+		attempts++
+		return fmt.Errorf("handler: %w", &retryableErrorMock{retryable: true})
+	})
+	cmd := createGetPingCommand()
+
+	// Act
+	err := h(context.Background(), cmd, s)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	if assert.Len(t, s.envelopes, 1) {
+		resp := s.envelopes[0].(*ResponseCommand)
+		assert.Equal(t, cmd.ID, resp.ID)
+		assert.Equal(t, CommandStatusFailure, resp.Status)
+		assert.Equal(t, ReasonCodeGeneralError, resp.Reason.Code)
+	}
+}
+
+func TestRetryMiddleware_WhenErrorIsNotRetryable(t *testing.T) {
+	// Arrange
+	s := &senderMock{}
+	attempts := 0
+	expected := &retryableErrorMock{retryable: false}
+	h := RetryMiddleware(3, nil)(func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+		attempts++
+		return expected
+	})
+	cmd := createGetPingCommand()
+
+	// Act
+	err := h(context.Background(), cmd, s)
+
+	// Assert
+	assert.ErrorIs(t, err, expected)
+	assert.Equal(t, 1, attempts)
+	assert.Empty(t, s.envelopes)
+}
+
+func isTextMessage(msg *Message) bool {
+	return msg.Type == MediaTypeTextPlain()
+}
+
+func TestEnvelopeMux_Describe(t *testing.T) {
+	// Arrange
+	mux := &EnvelopeMux{}
+	mux.MessageHandlerFunc(isTextMessage, func(ctx context.Context, msg *Message, s Sender) error {
+		return nil
+	})
+	mux.MessageHandlerFunc(nil, func(ctx context.Context, msg *Message, s Sender) error {
+		return nil
+	})
+	mux.NotificationHandlerFunc(func(not *Notification) bool {
+		return not.Event == NotificationEventFailed
+	}, func(ctx context.Context, not *Notification) error {
+		return nil
+	})
+	mux.RequestCommandRouter(NewCommandRouter())
+	mux.ResponseCommandHandlerFunc(nil, func(ctx context.Context, cmd *ResponseCommand, s Sender) error {
+		return nil
+	})
+
+	// Act
+	descriptors := mux.Describe()
+
+	// Assert
+	assert.Equal(t, []HandlerDescriptor{
+		{Kind: HandlerKindMessage, Index: 0, Predicate: "github.com/takenet/lime-go.isTextMessage"},
+		{Kind: HandlerKindMessage, Index: 1, Predicate: "any"},
+		{Kind: HandlerKindNotification, Index: 0, Predicate: "github.com/takenet/lime-go.TestEnvelopeMux_Describe.func3"},
+		{Kind: HandlerKindRequestCommand, Index: 0, Predicate: "command router"},
+		{Kind: HandlerKindResponseCommand, Index: 0, Predicate: "any"},
+	}, descriptors)
+}
@@ -34,12 +34,16 @@ func (t *inProcessTransport) Close() error {
 	return nil
 }
 
-func (t *inProcessTransport) Send(_ context.Context, e envelope) error {
+func (t *inProcessTransport) Send(ctx context.Context, e envelope) error {
 	if !t.Connected() {
 		return errors.New("transport is closed")
 	}
-	t.remote.envChan <- e
-	return nil
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("send: %w", ctx.Err())
+	case t.remote.envChan <- e:
+		return nil
+	}
 }
 
 func (t *inProcessTransport) Receive(ctx context.Context) (envelope, error) {
@@ -110,6 +114,11 @@ func (t *inProcessTransport) RemoteAddr() net.Addr {
 	return t.remote.addr
 }
 
+// PeerInfo returns false, since the in-process transports have no peer identity information.
+func (t *inProcessTransport) PeerInfo() (PeerInfo, bool) {
+	return PeerInfo{}, false
+}
+
 type inProcessTransportListener struct {
 	addr       InProcessAddr
 	transports chan *inProcessTransport
@@ -130,7 +139,9 @@ func NewInProcessTransportListener(addr InProcessAddr) TransportListener {
 func (l *inProcessTransportListener) Close() error {
 	l.closedMu.Lock()
 	defer l.closedMu.Unlock()
+	inProcListenersMu.Lock()
 	delete(inProcListeners, l.addr)
+	inProcListenersMu.Unlock()
 	l.closed = true
 	l.done <- true
 	return nil
@@ -146,6 +157,10 @@ func (l *inProcessTransportListener) Listen(_ context.Context, addr net.Addr) er
 		return fmt.Errorf("empty in process address %s", inProcAddr)
 	}
 
+	l.closedMu.Lock()
+	defer l.closedMu.Unlock()
+	inProcListenersMu.Lock()
+	defer inProcListenersMu.Unlock()
 	if _, ok := inProcListeners[inProcAddr]; ok {
 		return fmt.Errorf("a listerer is already active on address %s", inProcAddr)
 	}
@@ -169,6 +184,13 @@ func (l *inProcessTransportListener) Accept(ctx context.Context) (Transport, err
 	}
 }
 
+func (l *inProcessTransportListener) Addr() net.Addr {
+	if !l.listening() {
+		return nil
+	}
+	return l.addr
+}
+
 func (l *inProcessTransportListener) listening() bool {
 	l.closedMu.RLock()
 	defer l.closedMu.RUnlock()
@@ -185,11 +207,16 @@ func (l *inProcessTransportListener) newClient(addr InProcessAddr, bufferSize in
 	return client
 }
 
-var inProcListeners = make(map[InProcessAddr]*inProcessTransportListener)
+var (
+	inProcListeners   = make(map[InProcessAddr]*inProcessTransportListener)
+	inProcListenersMu sync.RWMutex
+)
 
 // DialInProcess creates a new in process transport connection to the specified path.
 func DialInProcess(addr InProcessAddr, bufferSize int) (Transport, error) {
+	inProcListenersMu.RLock()
 	l := inProcListeners[addr]
+	inProcListenersMu.RUnlock()
 	if l == nil {
 		return nil, fmt.Errorf("in process connection refused on %s address", addr)
 	}
@@ -150,3 +150,16 @@ func TestInProcessTransport_Receive_Session(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, s, received)
 }
+
+func TestInProcessTransport_PeerInfo(t *testing.T) {
+	// Arrange
+	client, server := newInProcessTransportPair("localhost", 1)
+	defer silentClose(client)
+
+	// Act
+	info, ok := server.PeerInfo()
+
+	// Assert
+	assert.False(t, ok)
+	assert.Zero(t, info)
+}
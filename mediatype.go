@@ -31,6 +31,17 @@ func (m MediaType) IsJson() bool {
 	return m.Suffix == "json"
 }
 
+// IsMsgPack indicates if the MIME represents a MessagePack type.
+func (m MediaType) IsMsgPack() bool {
+	return m.Suffix == "msgpack"
+}
+
+// isNonJsonSyntax indicates if the MIME declares a structured syntax suffix other than JSON, like '+msgpack' or
+// '+xml', which values cannot be decoded from JSON.
+func (m MediaType) isNonJsonSyntax() bool {
+	return m.Suffix != "" && !m.IsJson()
+}
+
 func (m MediaType) String() string {
 	if m == (MediaType{}) {
 		return ""
@@ -76,6 +87,7 @@ func (m *MediaType) UnmarshalText(text []byte) error {
 var mediaTypeApplicationJson = MediaType{MediaTypeApplication, "json", ""}
 var mediaTypeTextPlain = MediaType{MediaTypeText, "plain", ""}
 var documentFactories = map[MediaType]func() Document{}
+var documentValidators = map[MediaType]func(Document) error{}
 
 func MediaTypeTextPlain() MediaType {
 	return mediaTypeTextPlain
@@ -92,6 +104,26 @@ func RegisterDocumentFactory(f func() Document) {
 	documentFactories[d.MediaType()] = f
 }
 
+// RegisterDocumentValidator allow the registration of a validation function for the documents of the specified media
+// type. The validator is executed by the EnvelopeMux for the messages content and request commands resource before
+// dispatching them to the handlers. Invalid messages are replied with a 'failed' notification and invalid commands with
+// a failure response, with the reason of the validator error, if it is a ReasonError.
+func RegisterDocumentValidator(t MediaType, v func(Document) error) {
+	if v == nil {
+		panic("nil validator")
+	}
+	documentValidators[t] = v
+}
+
+// validateDocument executes the registered validator for the document media type, if any.
+func validateDocument(t MediaType, d Document) error {
+	v, ok := documentValidators[t]
+	if !ok || d == nil {
+		return nil
+	}
+	return v(d)
+}
+
 func GetDocumentFactory(t MediaType) (func() Document, error) {
 	// Check for a specific document factory for the media type
 	factory, ok := documentFactories[t]
@@ -111,7 +143,22 @@ func GetDocumentFactory(t MediaType) (func() Document, error) {
 	return factory, nil
 }
 
+// UnmarshalDocument deserializes the JSON value to a Document of the specified media type.
+// If there's no factory registered for the type, the generic JsonDocument and TextDocument types are used for JSON
+// and text types, respectively. For other types or if the value is not compatible with the generic types, the value
+// is deserialized to a RawDocument.
+// Types with a structured syntax suffix other than JSON, like '+msgpack', are always deserialized to a RawDocument,
+// even if there's a registered factory, since its values are not encoded as JSON.
 func UnmarshalDocument(d *json.RawMessage, t MediaType) (Document, error) {
+	if t.isNonJsonSyntax() {
+		return newRawDocument(d, t), nil
+	}
+
+	_, registered := documentFactories[t]
+	if !registered && !t.IsJson() && t.Type != MediaTypeText {
+		return newRawDocument(d, t), nil
+	}
+
 	factory, err := GetDocumentFactory(t)
 	if err != nil {
 		return nil, err
@@ -120,8 +167,17 @@ func UnmarshalDocument(d *json.RawMessage, t MediaType) (Document, error) {
 	document := factory()
 	err = json.Unmarshal(*d, &document)
 	if err != nil {
+		if !registered {
+			return newRawDocument(d, t), nil
+		}
 		return nil, err
 	}
 
 	return document, nil
 }
+
+func newRawDocument(d *json.RawMessage, t MediaType) *RawDocument {
+	value := make(json.RawMessage, len(*d))
+	copy(value, *d)
+	return &RawDocument{Type: t, Value: value}
+}
@@ -1,6 +1,7 @@
 package lime
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 )
@@ -110,3 +111,119 @@ func (msg *Message) FailedNotification(reason *Reason) *Notification {
 	not.Reason = reason
 	return not
 }
+
+// MessageBuilder is a helper for building Message envelopes.
+type MessageBuilder struct {
+	msg Message
+}
+
+// NewMessageBuilder creates a new MessageBuilder, which is a helper for building Message envelopes.
+func NewMessageBuilder() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+// ID sets the message identifier. Messages without id are not notified by the destination.
+func (b *MessageBuilder) ID(id string) *MessageBuilder {
+	b.msg.ID = id
+	return b
+}
+
+// NewID sets a new unique identifier for the message.
+func (b *MessageBuilder) NewID() *MessageBuilder {
+	b.msg.ID = NewEnvelopeID()
+	return b
+}
+
+// To sets the destination node of the message.
+func (b *MessageBuilder) To(to Node) *MessageBuilder {
+	b.msg.To = to
+	return b
+}
+
+// From sets the originator node of the message.
+func (b *MessageBuilder) From(from Node) *MessageBuilder {
+	b.msg.From = from
+	return b
+}
+
+// Metadata adds a metadata key-value pair to the message.
+func (b *MessageBuilder) Metadata(key string, value string) *MessageBuilder {
+	b.msg.SetMetadataKeyValue(key, value)
+	return b
+}
+
+// Content sets the message content document, along with its media type.
+func (b *MessageBuilder) Content(d Document) *MessageBuilder {
+	if d == nil {
+		panic("nil content")
+	}
+	b.msg.SetContent(d)
+	return b
+}
+
+// Text sets a plain text document as the message content.
+func (b *MessageBuilder) Text(text string) *MessageBuilder {
+	d := TextDocument(text)
+	return b.Content(&d)
+}
+
+// Build creates a new instance of Message. It panics if the content is not defined.
+func (b *MessageBuilder) Build() *Message {
+	if b.msg.Content == nil {
+		panic("the message content is not defined")
+	}
+	msg := b.msg
+	if b.msg.Metadata != nil {
+		msg.Metadata = make(map[string]string, len(b.msg.Metadata))
+		for k, v := range b.msg.Metadata {
+			msg.Metadata[k] = v
+		}
+	}
+	return &msg
+}
+
+// TextMessage creates a new Message with a plain text content to the specified destination, with a new id.
+func TextMessage(to Node, text string) *Message {
+	return NewMessageBuilder().NewID().To(to).Text(text).Build()
+}
+
+// MulticastResult is the result of sending a copy of a message to a single recipient.
+type MulticastResult struct {
+	// To is the recipient of the message copy.
+	To Node
+	// ID is the identifier of the message copy, which is used for correlating the notifications sent by the
+	// recipient. It is empty if the original message has no id.
+	ID string
+	// Err is the error returned by the sender, if any.
+	Err error
+}
+
+// MulticastMessage sends a copy of the message to each of the specified recipients through the sender, returning the
+// result for each recipient in the same order.
+// If the message has an id, each copy receives a new one, so the notifications of each recipient can be correlated.
+// A failure in sending to a recipient doesn't stop the sending to the remaining ones, unless the context is done.
+func MulticastMessage(ctx context.Context, s MessageSender, msg *Message, recipients []Node) []MulticastResult {
+	results := make([]MulticastResult, len(recipients))
+	for i, to := range recipients {
+		results[i].To = to
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		c := *msg
+		c.To = to
+		if msg.ID != "" {
+			c.ID = NewEnvelopeID()
+		}
+		if msg.Metadata != nil {
+			c.Metadata = make(map[string]string, len(msg.Metadata))
+			for k, v := range msg.Metadata {
+				c.Metadata[k] = v
+			}
+		}
+		results[i].ID = c.ID
+		results[i].Err = s.SendMessage(ctx, &c)
+	}
+	return results
+}
@@ -1,9 +1,15 @@
 package lime
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"log"
 	"testing"
+	"time"
 )
 
 func createMessage() *Message {
@@ -222,3 +228,184 @@ func TestMessage_UnmarshalJSON_ApplicationUnknownJson(t *testing.T) {
 	}
 	assert.Equal(t, JsonDocument{"property1": "value1", "property2": 2.0, "property3": map[string]interface{}{"subproperty1": "subvalue1"}, "property4": false, "property5": 12.3}, *d)
 }
+
+func TestMessage_UnmarshalJSON_ApplicationUnknown(t *testing.T) {
+	// Arrange
+	j := []byte(`{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"application/x-unknown","content":{"property1":"value1","property2":[1,2]}}`)
+	var m Message
+
+	// Act
+	err := json.Unmarshal(j, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	assert.Equal(t, MediaType{"application", "x-unknown", ""}, m.Type)
+	d, ok := m.Content.(*RawDocument)
+	if !assert.True(t, ok) {
+		t.Fatal()
+	}
+	assert.Equal(t, MediaType{"application", "x-unknown", ""}, d.MediaType())
+	assert.Equal(t, `{"property1":"value1","property2":[1,2]}`, string(d.Value))
+}
+
+func TestMessage_UnmarshalJSON_TextUnknownWithObject(t *testing.T) {
+	// Arrange
+	j := []byte(`{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"text/x-unknown","content":{"text":"Hello world"}}`)
+	var m Message
+
+	// Act
+	err := json.Unmarshal(j, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	d, ok := m.Content.(*RawDocument)
+	if !assert.True(t, ok) {
+		t.Fatal()
+	}
+	assert.Equal(t, MediaType{"text", "x-unknown", ""}, d.Type)
+	assert.Equal(t, `{"text":"Hello world"}`, string(d.Value))
+}
+
+func TestMessage_MarshalJSON_RawDocument(t *testing.T) {
+	// Arrange
+	m := createMessage()
+	m.SetContent(&RawDocument{Type: MediaType{"application", "x-unknown", ""}, Value: json.RawMessage(`{"property1":"value1"}`)})
+
+	// Act
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Assert
+	assert.JSONEq(t, `{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"application/x-unknown","content":{"property1":"value1"}}`, string(b))
+}
+
+func TestMessageBuilder_Build(t *testing.T) {
+	// Arrange
+	to := Node{Identity: Identity{Name: "golang", Domain: "limeprotocol.org"}, Instance: "default"}
+	from := Node{Identity: Identity{Name: "postmaster", Domain: "limeprotocol.org"}, Instance: "server1"}
+	d := JsonDocument{"text": "Hello world"}
+
+	// Act
+	msg := NewMessageBuilder().
+		ID("4609d0a3-00eb-4e16-9d44-27d115c6eb31").
+		To(to).
+		From(from).
+		Metadata("key", "value").
+		Content(&d).
+		Build()
+
+	// Assert
+	assert.Equal(t, "4609d0a3-00eb-4e16-9d44-27d115c6eb31", msg.ID)
+	assert.Equal(t, to, msg.To)
+	assert.Equal(t, from, msg.From)
+	assert.Equal(t, map[string]string{"key": "value"}, msg.Metadata)
+	assert.Equal(t, MediaTypeApplicationJson(), msg.Type)
+	assert.Equal(t, &d, msg.Content)
+}
+
+func TestMessageBuilder_Build_WhenContentIsNotDefined(t *testing.T) {
+	// Arrange
+	b := NewMessageBuilder().NewID()
+
+	// Act & Assert
+	assert.Panics(t, func() {
+		b.Build()
+	})
+}
+
+func TestTextMessage(t *testing.T) {
+	// Arrange
+	to := Node{Identity: Identity{Name: "golang", Domain: "limeprotocol.org"}, Instance: "default"}
+
+	// Act
+	msg := TextMessage(to, "Hello world")
+
+	// Assert
+	assert.NotEmpty(t, msg.ID)
+	assert.Equal(t, to, msg.To)
+	assert.Equal(t, MediaTypeTextPlain(), msg.Type)
+	var d TextDocument = "Hello world"
+	assert.Equal(t, &d, msg.Content)
+}
+
+// domainSender sends messages through the client of the destination domain.
+type domainSender map[string]*Client
+
+func (s domainSender) SendMessage(ctx context.Context, msg *Message) error {
+	client, ok := s[msg.To.Domain]
+	if !ok {
+		return fmt.Errorf("unknown domain '%v'", msg.To.Domain)
+	}
+	return client.SendMessage(ctx, msg)
+}
+
+func TestMulticastMessage_WhenThreeServers(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	domains := []string{"server1.com", "server2.com", "server3.com"}
+	msgChan := make(chan *Message, len(domains))
+	sender := domainSender{}
+	var recipients []Node
+	for _, domain := range domains {
+		addr := InProcessAddr(domain)
+		server := NewServerBuilder().
+			ListenInProcess(addr).
+			EnableGuestAuthentication().
+			MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+				msgChan <- msg
+				return nil
+			}).
+			Build()
+		defer silentClose(server)
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+				log.Println(err)
+			}
+		}()
+		time.Sleep(16 * time.Millisecond)
+		client := NewClientBuilder().
+			UseInProcess(addr, 1).
+			Build()
+		defer silentClose(client)
+		sender[domain] = client
+		recipients = append(recipients, Node{Identity: Identity{Name: "golang", Domain: domain}})
+	}
+	recipients = append(recipients, Node{Identity: Identity{Name: "golang", Domain: "unknown.com"}})
+	msg := createMessage()
+
+	// Act
+	results := MulticastMessage(ctx, sender, msg, recipients)
+
+	// Assert
+	assert.Len(t, results, 4)
+	ids := make(map[string]Node)
+	for i, r := range results {
+		assert.Equal(t, recipients[i], r.To)
+		assert.NotEmpty(t, r.ID)
+		assert.NotEqual(t, msg.ID, r.ID)
+		ids[r.ID] = r.To
+	}
+	assert.NoError(t, results[0].Err)
+	assert.NoError(t, results[1].Err)
+	assert.NoError(t, results[2].Err)
+	assert.EqualError(t, results[3].Err, "unknown domain 'unknown.com'")
+	for range domains {
+		select {
+		case <-ctx.Done():
+			assert.FailNow(t, "receive message timeout")
+		case actual := <-msgChan:
+			assert.Equal(t, ids[actual.ID], actual.To)
+			assert.Equal(t, msg.Content, actual.Content)
+		}
+	}
+	assert.Equal(t, "4609d0a3-00eb-4e16-9d44-27d115c6eb31", msg.ID)
+	assert.Equal(t, "limeprotocol.org", msg.To.Domain)
+}
@@ -27,6 +27,18 @@ func (not *Notification) SetFailed(reason *Reason) *Notification {
 	return not
 }
 
+// Validate checks if the notification event is valid and if the reason is present in 'failed' notifications, as
+// required by the protocol specification.
+func (not *Notification) Validate() error {
+	if err := not.Event.Validate(); err != nil {
+		return err
+	}
+	if not.Event == NotificationEventFailed && not.Reason == nil {
+		return errors.New("the reason is required in failed notifications")
+	}
+	return nil
+}
+
 func (not Notification) MarshalJSON() ([]byte, error) {
 	raw, err := not.toRawEnvelope()
 	if err != nil {
@@ -108,7 +120,7 @@ func (e *NotificationEvent) Validate() error {
 		return nil
 	}
 
-	return fmt.Errorf("invalid notification event '%v'", e)
+	return fmt.Errorf("invalid notification event '%v'", *e)
 }
 
 func (e NotificationEvent) MarshalText() ([]byte, error) {
@@ -128,3 +140,53 @@ func (e *NotificationEvent) UnmarshalText(text []byte) error {
 	*e = event
 	return nil
 }
+
+// NotificationBuilder is a helper for building Notification envelopes.
+type NotificationBuilder struct {
+	not Notification
+}
+
+// NewNotificationBuilder creates a new NotificationBuilder, which is a helper for building Notification envelopes.
+func NewNotificationBuilder() *NotificationBuilder {
+	return &NotificationBuilder{}
+}
+
+// ID sets the notification identifier, which should be the id of the related message.
+func (b *NotificationBuilder) ID(id string) *NotificationBuilder {
+	b.not.ID = id
+	return b
+}
+
+// To sets the destination node of the notification, which is usually the originator of the related message.
+func (b *NotificationBuilder) To(to Node) *NotificationBuilder {
+	b.not.To = to
+	return b
+}
+
+// From sets the originator node of the notification.
+func (b *NotificationBuilder) From(from Node) *NotificationBuilder {
+	b.not.From = from
+	return b
+}
+
+// Event sets the notification event.
+func (b *NotificationBuilder) Event(event NotificationEvent) *NotificationBuilder {
+	b.not.Event = event
+	return b
+}
+
+// Reason sets the reason of the notification, which is required for 'failed' events.
+func (b *NotificationBuilder) Reason(reason *Reason) *NotificationBuilder {
+	b.not.Reason = reason
+	return b
+}
+
+// Build creates a new instance of Notification. It panics if the notification is invalid, like a 'failed' event
+// without a reason.
+func (b *NotificationBuilder) Build() *Notification {
+	if err := b.not.Validate(); err != nil {
+		panic(err)
+	}
+	not := b.not
+	return &not
+}
@@ -1,5 +1,10 @@
 package lime
 
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
 func createNotification() *Notification {
 	n := Notification{}
 	n.ID = "4609d0a3-00eb-4e16-9d44-27d115c6eb31"
@@ -10,3 +15,42 @@ func createNotification() *Notification {
 	n.Event = NotificationEventReceived
 	return &n
 }
+
+func TestNotificationBuilder_Build_WhenReceived(t *testing.T) {
+	// Arrange
+	to := Node{Identity: Identity{Name: "golang", Domain: "limeprotocol.org"}, Instance: "default"}
+
+	// Act
+	not := NewNotificationBuilder().
+		ID("4609d0a3-00eb-4e16-9d44-27d115c6eb31").
+		To(to).
+		Event(NotificationEventReceived).
+		Build()
+
+	// Assert
+	assert.Equal(t, createNotification(), not)
+}
+
+func TestNotificationBuilder_Build_WhenFailedWithoutReason(t *testing.T) {
+	// Arrange
+	b := NewNotificationBuilder().
+		ID("4609d0a3-00eb-4e16-9d44-27d115c6eb31").
+		Event(NotificationEventFailed)
+
+	// Act & Assert
+	assert.Panics(t, func() {
+		b.Build()
+	})
+}
+
+func TestNotification_Validate_WhenEventIsInvalid(t *testing.T) {
+	// Arrange
+	not := createNotification()
+	not.Event = "unknown"
+
+	// Act
+	err := not.Validate()
+
+	// Assert
+	assert.EqualError(t, err, "invalid notification event 'unknown'")
+}
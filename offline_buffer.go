@@ -0,0 +1,72 @@
+package lime
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// ErrOfflineBufferOverflow indicates that a message was dropped from the offline buffer of the client, since the
+// buffer was full.
+var ErrOfflineBufferOverflow = errors.New("client: offline buffer overflow")
+
+// bufferOffline adds the message to the offline buffer if the client doesn't have an established session,
+// returning false if the message should be sent right away.
+// When the buffer is full, the oldest message is dropped.
+func (c *Client) bufferOffline(msg *Message) bool {
+	c.offlineMu.Lock()
+	defer c.offlineMu.Unlock()
+
+	if c.offlineClosed || c.channelOK() {
+		return false
+	}
+
+	if len(c.offline) >= c.config.OfflineBufferSize {
+		dropped := c.offline[0]
+		c.offline = append(c.offline[:0], c.offline[1:]...)
+		c.reportOfflineDrop(dropped, ErrOfflineBufferOverflow)
+	}
+	c.offline = append(c.offline, msg)
+	return true
+}
+
+// setChannel sets the established channel of the client, sending the messages of the offline buffer through it
+// before, in the order they were buffered.
+func (c *Client) setChannel(ctx context.Context, channel *ClientChannel) {
+	if c.config.OfflineBufferSize > 0 {
+		// The lock is held until the channel is set, so the messages sent in the meantime are also buffered
+		c.offlineMu.Lock()
+		defer c.offlineMu.Unlock()
+
+		for _, msg := range c.offline {
+			if err := channel.SendMessage(ctx, msg); err != nil {
+				c.reportOfflineDrop(msg, err)
+			}
+		}
+		c.offline = c.offline[:0]
+	}
+
+	c.mu.Lock()
+	c.channel = channel
+	c.mu.Unlock()
+}
+
+// discardOffline reports the messages that were not sent before the client was closed.
+func (c *Client) discardOffline() {
+	c.offlineMu.Lock()
+	defer c.offlineMu.Unlock()
+
+	c.offlineClosed = true
+	for _, msg := range c.offline {
+		c.reportOfflineDrop(msg, errClientClosed)
+	}
+	c.offline = nil
+}
+
+func (c *Client) reportOfflineDrop(msg *Message, err error) {
+	if c.config.OnOfflineDrop != nil {
+		c.config.OnOfflineDrop(msg, err)
+	} else {
+		log.Printf("client: offline buffer: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package lime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrProxyProtocol indicates that the PROXY protocol header of a connection is missing or invalid.
+var ErrProxyProtocol = errors.New("lime: invalid proxy protocol header")
+
+// proxyHeaderTimeout is the maximum time for reading the PROXY protocol header when the remote address is requested
+// before any read operation.
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyV1MaxLength is the maximum length of a PROXY protocol v1 header, including the CRLF.
+const proxyV1MaxLength = 107
+
+// proxyV2Signature is the signature that starts a PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyConn is a connection that reads the PROXY protocol header sent by a load balancer before the application
+// data, replacing the remote address by the address of the original client.
+// The header is read on the first read operation or remote address request.
+type proxyConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	once       sync.Once
+	remoteAddr net.Addr // remoteAddr is the original client address, if informed in the header
+	err        error    // err is the header reading error, if any
+}
+
+func newProxyConn(conn net.Conn) *proxyConn {
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the original client address informed in the PROXY protocol header or, if not informed, the
+// address of the connection peer.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(func() {
+		// There's no caller deadline when the header is read from here
+		_ = c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		defer func() {
+			_ = c.Conn.SetReadDeadline(time.Time{})
+		}()
+		c.readHeader()
+	})
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) readHeader() {
+	b, err := c.reader.Peek(1)
+	if err != nil {
+		c.err = fmt.Errorf("%w: %v", ErrProxyProtocol, err)
+		return
+	}
+	switch b[0] {
+	case 'P':
+		c.remoteAddr, err = readProxyV1Header(c.reader)
+	case proxyV2Signature[0]:
+		c.remoteAddr, err = readProxyV2Header(c.reader)
+	default:
+		err = errors.New("missing header")
+	}
+	if err != nil {
+		c.err = fmt.Errorf("%w: %v", ErrProxyProtocol, err)
+	}
+}
+
+// readProxyV1Header reads a header in the human-readable format, like 'PROXY TCP4 192.0.2.1 192.0.2.2 56324 443'.
+func readProxyV1Header(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == proxyV1MaxLength {
+			return nil, errors.New("v1 header is too long")
+		}
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, errors.New("invalid v1 header")
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+		if len(fields) != 6 {
+			return nil, errors.New("invalid v1 header")
+		}
+		ip := net.ParseIP(fields[2])
+		port, err := strconv.ParseUint(fields[4], 10, 16)
+		if ip == nil || err != nil {
+			return nil, errors.New("invalid v1 source address")
+		}
+		return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported v1 protocol '%v'", fields[1])
+	}
+}
+
+// readProxyV2Header reads a header in the binary format.
+func readProxyV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[:12], proxyV2Signature) {
+		return nil, errors.New("invalid v2 signature")
+	}
+	if header[12]>>4 != 2 {
+		return nil, errors.New("unsupported v2 version")
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	// The LOCAL command is used by health checks of the load balancer, which has no original client
+	if header[12]&0x0F == 0 {
+		return nil, nil
+	}
+
+	switch header[13] >> 4 {
+	case 1: // AF_INET
+		if len(payload) < 12 {
+			return nil, errors.New("invalid v2 ipv4 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}, nil
+	case 2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, errors.New("invalid v2 ipv6 addresses")
+		}
+		return &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
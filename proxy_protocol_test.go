@@ -0,0 +1,116 @@
+package lime
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"net"
+	"testing"
+	"time"
+)
+
+func createProxyProtocolListener(t testing.TB, addr net.Addr) TransportListener {
+	listener := NewTCPTransportListener(&TCPConfig{ProxyProtocol: true})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+func sendWithHeader(t testing.TB, addr net.Addr, header []byte, e envelope) net.Conn {
+	conn, err := net.Dial(addr.Network(), addr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = conn.Write(append(header, b...)); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestTCPTransport_ProxyProtocol_V1(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	listener := createProxyProtocolListener(t, addr)
+	defer silentClose(listener)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	m := createMessage()
+	conn := sendWithHeader(t, addr, []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"), m)
+	defer silentClose(conn)
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(server)
+
+	// Act
+	actual, err := server.Receive(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, m, actual)
+	assert.Equal(t, "192.0.2.1:56324", server.RemoteAddr().String())
+}
+
+func TestTCPTransport_ProxyProtocol_V2(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	listener := createProxyProtocolListener(t, addr)
+	defer silentClose(listener)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x21, 0x21, 0, 36) // v2 PROXY command, TCP over IPv6
+	header = append(header, net.ParseIP("2001:db8::1")...)
+	header = append(header, net.ParseIP("2001:db8::2")...)
+	header = append(header, 0xDC, 0x04, 0x01, 0xBB) // ports 56324 and 443
+	m := createMessage()
+	conn := sendWithHeader(t, addr, header, m)
+	defer silentClose(conn)
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(server)
+
+	// Act
+	remoteAddr := server.RemoteAddr()
+
+	// Assert
+	assert.Equal(t, "[2001:db8::1]:56324", remoteAddr.String())
+	actual, err := server.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, m, actual)
+}
+
+func TestTCPTransport_ProxyProtocol_WhenHeaderIsMissing(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	listener := createProxyProtocolListener(t, addr)
+	defer silentClose(listener)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	conn := sendWithHeader(t, addr, nil, createMessage())
+	defer silentClose(conn)
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(server)
+
+	// Act
+	actual, err := server.Receive(ctx)
+
+	// Assert
+	assert.Nil(t, actual)
+	assert.ErrorIs(t, err, ErrProxyProtocol)
+}
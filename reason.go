@@ -0,0 +1,205 @@
+package lime
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reason codes defined by the LIME protocol specification.
+const (
+	// ReasonCodeGeneralError indicates a general error.
+	ReasonCodeGeneralError = 1
+
+	// ReasonCodeSessionError indicates a general session error.
+	ReasonCodeSessionError = 11
+	// ReasonCodeSessionRegistrationError indicates that the session registration has failed.
+	ReasonCodeSessionRegistrationError = 12
+	// ReasonCodeSessionAuthenticationFailed indicates that the session authentication has failed.
+	ReasonCodeSessionAuthenticationFailed = 13
+	// ReasonCodeSessionUnregisterFailed indicates that an error occurred while unregistering the session.
+	ReasonCodeSessionUnregisterFailed = 14
+	// ReasonCodeSessionInvalidActionForState indicates that the required action is invalid for the current session state.
+	ReasonCodeSessionInvalidActionForState = 15
+	// ReasonCodeSessionNegotiationTimeout indicates that the session negotiation has timed out.
+	ReasonCodeSessionNegotiationTimeout = 16
+	// ReasonCodeSessionNegotiationInvalidOptions indicates an invalid selected negotiation option.
+	ReasonCodeSessionNegotiationInvalidOptions = 17
+	// ReasonCodeSessionInvalidSessionModeRequested indicates an invalid session mode requested.
+	ReasonCodeSessionInvalidSessionModeRequested = 18
+
+	// ReasonCodeValidationError indicates a general validation error.
+	ReasonCodeValidationError = 21
+	// ReasonCodeValidationEmptyDocument indicates that the envelope document is null.
+	ReasonCodeValidationEmptyDocument = 22
+	// ReasonCodeValidationInvalidResource indicates that the envelope resource is invalid.
+	ReasonCodeValidationInvalidResource = 23
+	// ReasonCodeValidationInvalidStatus indicates that the command status is invalid.
+	ReasonCodeValidationInvalidStatus = 24
+	// ReasonCodeValidationInvalidIdentity indicates that the request identity is invalid.
+	ReasonCodeValidationInvalidIdentity = 25
+	// ReasonCodeValidationInvalidRecipients indicates that the envelope originator or destination is invalid.
+	ReasonCodeValidationInvalidRecipients = 26
+	// ReasonCodeValidationInvalidMethod indicates that the command method is invalid.
+	ReasonCodeValidationInvalidMethod = 27
+	// ReasonCodeValidationInvalidURI indicates that the command URI format is invalid.
+	ReasonCodeValidationInvalidURI = 28
+
+	// ReasonCodeAuthorizationError indicates a general authorization error.
+	ReasonCodeAuthorizationError = 31
+	// ReasonCodeAuthorizationUnauthorizedSender indicates that the sender is not authorized to send messages to the
+	// destination.
+	ReasonCodeAuthorizationUnauthorizedSender = 32
+	// ReasonCodeAuthorizationDestinationNotFound indicates that the destination doesn't have an active account.
+	ReasonCodeAuthorizationDestinationNotFound = 33
+	// ReasonCodeAuthorizationQuotaThresholdExceeded indicates that the quota threshold was exceeded.
+	ReasonCodeAuthorizationQuotaThresholdExceeded = 34
+
+	// ReasonCodeRoutingError indicates a general routing error.
+	ReasonCodeRoutingError = 41
+	// ReasonCodeRoutingDestinationNotFound indicates that the message destination was not found.
+	ReasonCodeRoutingDestinationNotFound = 42
+	// ReasonCodeRoutingGatewayNotFound indicates that the message destination gateway was not found.
+	ReasonCodeRoutingGatewayNotFound = 43
+	// ReasonCodeRoutingRouteNotFound indicates that a route to the message destination was not found.
+	ReasonCodeRoutingRouteNotFound = 44
+
+	// ReasonCodeDispatchError indicates a general dispatch error.
+	ReasonCodeDispatchError = 51
+
+	// ReasonCodeCommandProcessingError indicates a general command processing error.
+	ReasonCodeCommandProcessingError = 61
+	// ReasonCodeCommandResourceNotSupported indicates that there's no command processor available for the resource.
+	ReasonCodeCommandResourceNotSupported = 62
+	// ReasonCodeCommandMethodNotSupported indicates that the command method is not supported.
+	ReasonCodeCommandMethodNotSupported = 63
+	// ReasonCodeCommandInvalidArgument indicates that the command method has an invalid argument value.
+	ReasonCodeCommandInvalidArgument = 64
+	// ReasonCodeCommandInvalidSessionMode indicates that the requested command is not valid for the current session
+	// mode.
+	ReasonCodeCommandInvalidSessionMode = 65
+	// ReasonCodeCommandNotAllowed indicates that the command method was not allowed.
+	ReasonCodeCommandNotAllowed = 66
+	// ReasonCodeCommandResourceNotFound indicates that the command resource was not found.
+	ReasonCodeCommandResourceNotFound = 67
+
+	// ReasonCodeMessageProcessingError indicates a general message processing error.
+	ReasonCodeMessageProcessingError = 71
+	// ReasonCodeMessageUnsupportedContentType indicates that the message content type is not supported.
+	ReasonCodeMessageUnsupportedContentType = 72
+
+	// ReasonCodeGatewayError indicates a general gateway processing error.
+	ReasonCodeGatewayError = 81
+	// ReasonCodeGatewayContentTypeNotSupported indicates that the content type is not supported by the gateway.
+	ReasonCodeGatewayContentTypeNotSupported = 82
+	// ReasonCodeGatewayDestinationNotFound indicates that the message destination was not found on the gateway.
+	ReasonCodeGatewayDestinationNotFound = 83
+	// ReasonCodeGatewayNotSupported indicates that the functionality is not supported by the gateway.
+	ReasonCodeGatewayNotSupported = 84
+
+	// ReasonCodeApplicationError indicates a general application processing error.
+	ReasonCodeApplicationError = 101
+)
+
+// ReasonCategory returns the category of the reason code, as defined by the LIME protocol specification.
+// The codes are grouped in ranges of ten values (the session codes are from 11 to 19, the validation codes from 21 to
+// 29 and so on), except for the application codes, which are from 101 onwards. An empty string is returned if the code
+// doesn't belong to any category.
+func ReasonCategory(code int) string {
+	switch {
+	case code >= 1 && code <= 9:
+		return "general"
+	case code >= 11 && code <= 19:
+		return "session"
+	case code >= 21 && code <= 29:
+		return "validation"
+	case code >= 31 && code <= 39:
+		return "authorization"
+	case code >= 41 && code <= 49:
+		return "routing"
+	case code >= 51 && code <= 59:
+		return "dispatch"
+	case code >= 61 && code <= 69:
+		return "command"
+	case code >= 71 && code <= 79:
+		return "message"
+	case code >= 81 && code <= 89:
+		return "gateway"
+	case code >= 101:
+		return "application"
+	default:
+		return ""
+	}
+}
+
+// Validate checks if the reason code belongs to one of the categories defined by the protocol specification.
+func (r Reason) Validate() error {
+	if ReasonCategory(r.Code) == "" {
+		return fmt.Errorf("reason code %v is out of the specified ranges", r.Code)
+	}
+	return nil
+}
+
+var (
+	// ErrNotFound indicates that a requested resource was not found.
+	ErrNotFound = errors.New("lime: resource not found")
+	// ErrUnauthorized indicates that the originator is not authorized to perform the requested action.
+	ErrUnauthorized = errors.New("lime: unauthorized")
+	// ErrValidation indicates that the received envelope or its document is invalid.
+	ErrValidation = errors.New("lime: validation failed")
+	// ErrRouteNotFound indicates that there's no route to the destination of a message, like an offline or unknown
+	// node.
+	ErrRouteNotFound = errors.New("lime: route not found")
+)
+
+// IsRoutingMiss indicates if the error returned by a message handler means that the message destination couldn't be
+// reached, making it undeliverable.
+func IsRoutingMiss(err error) bool {
+	return errors.Is(err, ErrRouteNotFound)
+}
+
+// ReasonError is an error that carries a Reason value, allowing handlers to define the reason that should be sent to
+// the remote party in failure responses and notifications.
+type ReasonError struct {
+	Reason *Reason
+}
+
+// NewReasonError creates a new ReasonError with the specified code and description.
+func NewReasonError(code int, description string) *ReasonError {
+	return &ReasonError{Reason: &Reason{Code: code, Description: description}}
+}
+
+func (e *ReasonError) Error() string {
+	if e.Reason == nil {
+		return "lime: unknown reason"
+	}
+	return fmt.Sprintf("lime: %v", e.Reason)
+}
+
+// ReasonFromError creates a Reason value for the specified error.
+// If the error is (or wraps) a ReasonError, its reason is returned. The well-known ErrNotFound, ErrUnauthorized,
+// ErrValidation and ErrRouteNotFound errors are mapped to its corresponding reason codes and any other error is mapped to
+// ReasonCodeGeneralError.
+func ReasonFromError(err error) *Reason {
+	if err == nil {
+		return nil
+	}
+
+	var reasonErr *ReasonError
+	if errors.As(err, &reasonErr) && reasonErr.Reason != nil {
+		return reasonErr.Reason
+	}
+
+	code := ReasonCodeGeneralError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		code = ReasonCodeCommandResourceNotFound
+	case errors.Is(err, ErrUnauthorized):
+		code = ReasonCodeAuthorizationError
+	case errors.Is(err, ErrValidation):
+		code = ReasonCodeValidationError
+	case errors.Is(err, ErrRouteNotFound):
+		code = ReasonCodeRoutingDestinationNotFound
+	}
+
+	return &Reason{Code: code, Description: err.Error()}
+}
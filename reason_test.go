@@ -0,0 +1,102 @@
+package lime
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReasonFromError_SentinelErrors(t *testing.T) {
+	// Arrange
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{ErrNotFound, ReasonCodeCommandResourceNotFound},
+		{fmt.Errorf("get friend: %w", ErrNotFound), ReasonCodeCommandResourceNotFound},
+		{ErrUnauthorized, ReasonCodeAuthorizationError},
+		{ErrValidation, ReasonCodeValidationError},
+		{ErrRouteNotFound, ReasonCodeRoutingDestinationNotFound},
+		{errors.New("something went wrong"), ReasonCodeGeneralError},
+	}
+
+	for _, c := range cases {
+		// Act
+		reason := ReasonFromError(c.err)
+
+		// Assert
+		assert.Equal(t, c.code, reason.Code)
+		assert.Equal(t, c.err.Error(), reason.Description)
+	}
+}
+
+func TestReasonFromError_ReasonError(t *testing.T) {
+	// Arrange
+	err := fmt.Errorf("handler: %w", NewReasonError(ReasonCodeCommandNotAllowed, "Not allowed"))
+
+	// Act
+	reason := ReasonFromError(err)
+
+	// Assert
+	assert.Equal(t, &Reason{Code: ReasonCodeCommandNotAllowed, Description: "Not allowed"}, reason)
+}
+
+func TestRequestCommand_FailureResponseFromError(t *testing.T) {
+	// Arrange
+	cmd := createGetPingCommand()
+
+	// Act
+	respCmd := cmd.FailureResponseFromError(ErrNotFound)
+
+	// Assert
+	assert.Equal(t, cmd.ID, respCmd.ID)
+	assert.Equal(t, CommandStatusFailure, respCmd.Status)
+	assert.Equal(t, ReasonCodeCommandResourceNotFound, respCmd.Reason.Code)
+}
+
+func TestReasonCategory(t *testing.T) {
+	// Arrange
+	cases := []struct {
+		code     int
+		category string
+	}{
+		{ReasonCodeGeneralError, "general"},
+		{ReasonCodeSessionAuthenticationFailed, "session"},
+		{ReasonCodeValidationInvalidURI, "validation"},
+		{ReasonCodeAuthorizationError, "authorization"},
+		{ReasonCodeRoutingDestinationNotFound, "routing"},
+		{ReasonCodeDispatchError, "dispatch"},
+		{ReasonCodeCommandResourceNotFound, "command"},
+		{ReasonCodeMessageUnsupportedContentType, "message"},
+		{ReasonCodeGatewayNotSupported, "gateway"},
+		{ReasonCodeApplicationError, "application"},
+		{250, "application"},
+		{0, ""},
+		{10, ""},
+		{95, ""},
+		{-1, ""},
+	}
+
+	for _, c := range cases {
+		// Act
+		category := ReasonCategory(c.code)
+
+		// Assert
+		assert.Equal(t, c.category, category, "code %v", c.code)
+	}
+}
+
+func TestReason_Validate(t *testing.T) {
+	// Arrange
+	valid := Reason{Code: ReasonCodeSessionError, Description: "Session error"}
+	invalid := Reason{Code: 90, Description: "Unknown error"}
+
+	// Act
+	validErr := valid.Validate()
+	invalidErr := invalid.Validate()
+
+	// Assert
+	assert.NoError(t, validErr)
+	assert.Error(t, invalidErr)
+}
@@ -0,0 +1,37 @@
+package lime
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// ReconnectJitter defines the randomization applied to the intervals between the client reconnection attempts.
+// The randomization avoids many clients reconnecting at the same time after a server restart, which causes load
+// spikes in the server.
+type ReconnectJitter int
+
+const (
+	// ReconnectJitterNone uses the computed intervals without randomization.
+	ReconnectJitterNone = ReconnectJitter(iota)
+	// ReconnectJitterEqual keeps half of the computed interval and randomizes the other half.
+	ReconnectJitterEqual
+	// ReconnectJitterFull uses a random interval between zero and the computed interval.
+	ReconnectJitterFull
+)
+
+// reconnectInterval returns the interval to wait before the next reconnection attempt, after the specified number
+// of failed attempts. The interval grows quadratically and is randomized accordingly to the jitter mode.
+func reconnectInterval(attempt int, jitter ReconnectJitter, rnd *rand.Rand) time.Duration {
+	interval := time.Duration(math.Pow(float64(attempt), 2)*100) * time.Millisecond
+
+	switch jitter {
+	case ReconnectJitterEqual:
+		half := interval / 2
+		return interval - half + time.Duration(rnd.Int63n(int64(half)+1))
+	case ReconnectJitterFull:
+		return time.Duration(rnd.Int63n(int64(interval) + 1))
+	default:
+		return interval
+	}
+}
@@ -0,0 +1,59 @@
+package lime
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestReconnectInterval_WhenJitterNone(t *testing.T) {
+	// Arrange
+	rnd := rand.New(rand.NewSource(1))
+
+	// Act
+	interval := reconnectInterval(3, ReconnectJitterNone, rnd)
+
+	// Assert
+	assert.Equal(t, 900*time.Millisecond, interval)
+}
+
+func TestReconnectInterval_WhenJitterEqual(t *testing.T) {
+	// Arrange
+	rnd := rand.New(rand.NewSource(1))
+
+	// Act & Assert
+	for i := 0; i < 100; i++ {
+		interval := reconnectInterval(3, ReconnectJitterEqual, rnd)
+		assert.GreaterOrEqual(t, interval, 450*time.Millisecond)
+		assert.LessOrEqual(t, interval, 900*time.Millisecond)
+	}
+}
+
+func TestReconnectInterval_WhenJitterFull(t *testing.T) {
+	// Arrange
+	const clients = 10
+	intervals := make(map[time.Duration]struct{}, clients)
+
+	// Act
+	for i := 0; i < clients; i++ {
+		rnd := rand.New(rand.NewSource(int64(i)))
+		interval := reconnectInterval(3, ReconnectJitterFull, rnd)
+		assert.GreaterOrEqual(t, interval, time.Duration(0))
+		assert.LessOrEqual(t, interval, 900*time.Millisecond)
+		intervals[interval] = struct{}{}
+	}
+
+	// Assert
+	assert.Greater(t, len(intervals), clients/2)
+}
+
+func TestReconnectInterval_WhenFirstAttempt(t *testing.T) {
+	// Arrange
+	rnd := rand.New(rand.NewSource(1))
+
+	// Act & Assert
+	for _, jitter := range []ReconnectJitter{ReconnectJitterNone, ReconnectJitterEqual, ReconnectJitterFull} {
+		assert.Zero(t, reconnectInterval(0, jitter, rnd))
+	}
+}
@@ -0,0 +1,138 @@
+package lime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// recoverableDecoder decodes JSON objects from a stream, skipping the malformed and oversized ones.
+// The stream is split by tracking the nesting of the object braces, outside the JSON strings, so a decoding failure
+// doesn't affect the following objects.
+type recoverableDecoder struct {
+	reader  *bufio.Reader
+	limit   int64
+	strict  bool
+	onError func(err error, skipped int)
+	buf     []byte
+	size    int // size is the length of the last decoded object
+}
+
+func newRecoverableDecoder(r io.Reader, limit int64, strict bool, onError func(err error, skipped int)) *recoverableDecoder {
+	return &recoverableDecoder{
+		reader:  bufio.NewReader(r),
+		limit:   limit,
+		strict:  strict,
+		onError: onError,
+	}
+}
+
+// Decode reads the next valid JSON object of the stream and stores it in the value pointed by v.
+// Only the errors of the underlying reader are returned.
+func (d *recoverableDecoder) Decode(v interface{}) error {
+	for {
+		frame, err := d.readFrame()
+		if err != nil {
+			return err
+		}
+		if frame == nil {
+			continue
+		}
+
+		// Decodes to a new value, since a failure may leave it partially filled
+		target := reflect.New(reflect.TypeOf(v).Elem())
+		decoder := json.NewDecoder(bytes.NewReader(frame))
+		if d.strict {
+			decoder.DisallowUnknownFields()
+		}
+		if err = decoder.Decode(target.Interface()); err != nil {
+			d.skip(fmt.Errorf("%w: %v", ErrMalformedFrame, err), len(frame))
+			continue
+		}
+		reflect.ValueOf(v).Elem().Set(target.Elem())
+		d.size = len(frame)
+		return nil
+	}
+}
+
+// readFrame reads the next JSON object of the stream. The data before the object start is skipped.
+// It returns a nil frame if the object exceeds the limit.
+func (d *recoverableDecoder) readFrame() ([]byte, error) {
+	skipped := 0
+	for {
+		c, err := d.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == '{' {
+			break
+		}
+		if !isJSONSpace(c) {
+			skipped++
+		}
+	}
+	if skipped > 0 {
+		d.skip(fmt.Errorf("%w: unexpected data before the envelope", ErrMalformedFrame), skipped)
+	}
+
+	d.buf = append(d.buf[:0], '{')
+	size := int64(1)
+	oversized := false
+	depth := 1
+	inString, escaped := false, false
+
+	for depth > 0 {
+		c, err := d.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		size++
+		if !oversized {
+			if d.limit > 0 && size > d.limit {
+				oversized = true
+				d.buf = d.buf[:0]
+			} else {
+				d.buf = append(d.buf, c)
+			}
+		}
+
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		}
+	}
+
+	if oversized {
+		d.skip(fmt.Errorf("%w: the envelope has %v bytes", ErrReadLimitExceeded, size), int(size))
+		return nil, nil
+	}
+	return d.buf, nil
+}
+
+// discard reports the last decoded object as skipped, for objects that are valid JSON but cannot be used by the
+// caller, like the ones that are not envelopes.
+func (d *recoverableDecoder) discard(err error) {
+	d.skip(err, d.size)
+}
+
+func (d *recoverableDecoder) skip(err error, skipped int) {
+	if d.onError != nil {
+		d.onError(err, skipped)
+	}
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
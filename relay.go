@@ -0,0 +1,117 @@
+package lime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// RelayChannel defines a channel which its envelopes can be relayed to another channel.
+// It is implemented by both the ClientChannel and ServerChannel types.
+type RelayChannel interface {
+	Sender
+	MsgChan() <-chan *Message
+	NotChan() <-chan *Notification
+	ReqCmdChan() <-chan *RequestCommand
+	RespCmdChan() <-chan *ResponseCommand
+	RcvDone() <-chan struct{}
+	LocalNode() Node
+	RemoteNode() Node
+}
+
+// Relay forwards the messages, notifications and commands received from the channel a to the channel b and
+// vice versa, until one of the channels is done or the context is canceled.
+// The addresses of the envelopes are rewritten when relayed: envelopes without the originator have the From value
+// set to the remote node of the source channel and envelopes without the destination or addressed to the local node
+// of the source channel have the To value set to the remote node of the destination channel.
+// It returns nil if one of the channels is done, or an error in case of sending failures or context cancellation.
+// Note that the channels should not be consumed by other listeners, like an EnvelopeMux, while being relayed.
+func Relay(ctx context.Context, a, b RelayChannel) error {
+	if ctx == nil {
+		panic("nil context")
+	}
+	if a == nil || b == nil {
+		panic("nil channel")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errChan := make(chan error, 2)
+	go func() {
+		defer cancel()
+		errChan <- relay(ctx, a, b)
+	}()
+	go func() {
+		defer cancel()
+		errChan <- relay(ctx, b, a)
+	}()
+
+	err := <-errChan
+	<-errChan
+	if err != nil {
+		return fmt.Errorf("relay: %w", err)
+	}
+	return nil
+}
+
+// relay forwards the envelopes received from the src channel to the dst channel.
+func relay(ctx context.Context, src, dst RelayChannel) error {
+	for {
+		select {
+		case <-ctx.Done():
+			// The context is canceled when the other direction is done
+			select {
+			case <-src.RcvDone():
+				return nil
+			case <-dst.RcvDone():
+				return nil
+			default:
+				return ctx.Err()
+			}
+		case <-src.RcvDone():
+			return nil
+		case msg, ok := <-src.MsgChan():
+			if !ok {
+				return errors.New("msg chan: channel closed")
+			}
+			relayAddresses(&msg.Envelope, src, dst)
+			if err := dst.SendMessage(ctx, msg); err != nil {
+				return err
+			}
+		case not, ok := <-src.NotChan():
+			if !ok {
+				return errors.New("not chan: channel closed")
+			}
+			relayAddresses(&not.Envelope, src, dst)
+			if err := dst.SendNotification(ctx, not); err != nil {
+				return err
+			}
+		case reqCmd, ok := <-src.ReqCmdChan():
+			if !ok {
+				return errors.New("req cmd chan: channel closed")
+			}
+			relayAddresses(&reqCmd.Envelope, src, dst)
+			if err := dst.SendRequestCommand(ctx, reqCmd); err != nil {
+				return err
+			}
+		case respCmd, ok := <-src.RespCmdChan():
+			if !ok {
+				return errors.New("resp cmd chan: channel closed")
+			}
+			relayAddresses(&respCmd.Envelope, src, dst)
+			if err := dst.SendResponseCommand(ctx, respCmd); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func relayAddresses(env *Envelope, src, dst RelayChannel) {
+	if env.From == (Node{}) {
+		env.From = src.RemoteNode()
+	}
+	if env.To == (Node{}) || env.To == src.LocalNode() {
+		env.To = dst.RemoteNode()
+	}
+}
@@ -0,0 +1,59 @@
+package lime
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"testing"
+	"time"
+)
+
+func TestRelay_Message(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	relayNode := Node{Identity: Identity{Name: "relay", Domain: "limeprotocol.org"}, Instance: "server1"}
+	nodeA := Node{Identity: Identity{Name: "a", Domain: "limeprotocol.org"}, Instance: "home"}
+	nodeB := Node{Identity: Identity{Name: "b", Domain: "limeprotocol.org"}, Instance: "home"}
+	clientA, serverA := newInProcessTransportPair("a", 1)
+	clientB, serverB := newInProcessTransportPair("b", 1)
+	channelA := newChannel(clientA, 1)
+	defer silentClose(channelA)
+	relayA := newChannel(serverA, 1)
+	defer silentClose(relayA)
+	relayA.localNode = relayNode
+	relayA.remoteNode = nodeA
+	relayB := newChannel(clientB, 1)
+	defer silentClose(relayB)
+	relayB.localNode = relayNode
+	relayB.remoteNode = nodeB
+	channelB := newChannel(serverB, 1)
+	defer silentClose(channelB)
+	for _, c := range []*channel{channelA, relayA, relayB, channelB} {
+		c.setState(SessionStateEstablished)
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- Relay(ctx, relayA, relayB)
+	}()
+	msg := createMessage()
+	msg.To = Node{}
+
+	// Act
+	err := channelA.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive message timeout")
+	case actual := <-channelB.MsgChan():
+		assert.Equal(t, msg.ID, actual.ID)
+		assert.Equal(t, nodeA, actual.From)
+		assert.Equal(t, nodeB, actual.To)
+		assert.Equal(t, msg.Content, actual.Content)
+	}
+	_ = channelB.Close()
+	assert.NoError(t, <-errChan)
+}
@@ -0,0 +1,73 @@
+package lime
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// MetadataKeyNonce is the metadata key of the unique value included in the signed envelopes, for replay protection.
+	MetadataKeyNonce = "#nonce"
+	// MetadataKeyTimestamp is the metadata key of the signing timestamp of the envelopes, in the RFC 3339 format.
+	MetadataKeyTimestamp = "#timestamp"
+)
+
+type replayKey struct {
+	node  Node
+	nonce string
+}
+
+// replayCache is a set of the nonces seen in the signed envelopes, keyed by the remote node.
+// The nonces are kept in buckets of the window duration by the envelope timestamp, and the buckets are evicted when
+// the timestamps of its nonces are no longer accepted.
+// It is safe for concurrent use.
+type replayCache struct {
+	window  time.Duration
+	buckets map[int64]map[replayKey]struct{}
+	mu      sync.Mutex
+}
+
+func newReplayCache(window time.Duration) *replayCache {
+	if window <= 0 {
+		panic("window must be positive")
+	}
+	return &replayCache{
+		window:  window,
+		buckets: make(map[int64]map[replayKey]struct{}),
+	}
+}
+
+// add includes the nonce in the cache, returning false if the timestamp is out of the window or if the nonce was
+// already seen for the node.
+func (c *replayCache) add(node Node, nonce string, timestamp time.Time, now time.Time) bool {
+	if nonce == "" || timestamp.Before(now.Add(-c.window)) || timestamp.After(now.Add(c.window)) {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The oldest accepted timestamp belongs to the bucket before the current one
+	current := now.UnixNano() / int64(c.window)
+	for b := range c.buckets {
+		if b < current-1 {
+			delete(c.buckets, b)
+		}
+	}
+
+	key := replayKey{node: node, nonce: nonce}
+	for _, bucket := range c.buckets {
+		if _, ok := bucket[key]; ok {
+			return false
+		}
+	}
+
+	b := timestamp.UnixNano() / int64(c.window)
+	bucket, ok := c.buckets[b]
+	if !ok {
+		bucket = make(map[replayKey]struct{})
+		c.buckets[b] = bucket
+	}
+	bucket[key] = struct{}{}
+	return true
+}
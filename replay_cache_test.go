@@ -0,0 +1,80 @@
+package lime
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestReplayCache_Add_WhenFresh(t *testing.T) {
+	// Arrange
+	c := newReplayCache(time.Minute)
+	now := time.Now()
+	node := Node{Identity{"golang", "limeprotocol.org"}, "default"}
+
+	// Act
+	ok := c.add(node, NewEnvelopeID(), now.Add(-time.Second), now)
+
+	// Assert
+	assert.True(t, ok)
+}
+
+func TestReplayCache_Add_WhenReplayed(t *testing.T) {
+	// Arrange
+	c := newReplayCache(time.Minute)
+	now := time.Now()
+	node := Node{Identity{"golang", "limeprotocol.org"}, "default"}
+	nonce := NewEnvelopeID()
+	c.add(node, nonce, now.Add(-time.Second), now)
+
+	// Act
+	ok := c.add(node, nonce, now.Add(-time.Second), now.Add(time.Second))
+
+	// Assert
+	assert.False(t, ok)
+}
+
+func TestReplayCache_Add_WhenReplayedByOtherNode(t *testing.T) {
+	// Arrange
+	c := newReplayCache(time.Minute)
+	now := time.Now()
+	nonce := NewEnvelopeID()
+	c.add(Node{Identity{"golang", "limeprotocol.org"}, "default"}, nonce, now, now)
+
+	// Act
+	ok := c.add(Node{Identity{"rust", "limeprotocol.org"}, "default"}, nonce, now, now)
+
+	// Assert
+	assert.True(t, ok)
+}
+
+func TestReplayCache_Add_WhenOutOfWindow(t *testing.T) {
+	// Arrange
+	c := newReplayCache(time.Minute)
+	now := time.Now()
+	node := Node{Identity{"golang", "limeprotocol.org"}, "default"}
+
+	// Act
+	old := c.add(node, NewEnvelopeID(), now.Add(-2*time.Minute), now)
+	future := c.add(node, NewEnvelopeID(), now.Add(2*time.Minute), now)
+
+	// Assert
+	assert.False(t, old)
+	assert.False(t, future)
+}
+
+func TestReplayCache_Add_EvictsExpiredBuckets(t *testing.T) {
+	// Arrange
+	c := newReplayCache(time.Minute)
+	now := time.Now()
+	node := Node{Identity{"golang", "limeprotocol.org"}, "default"}
+	c.add(node, NewEnvelopeID(), now, now)
+
+	// Act
+	later := now.Add(5 * time.Minute)
+	ok := c.add(node, NewEnvelopeID(), later, later)
+
+	// Assert
+	assert.True(t, ok)
+	assert.Len(t, c.buckets, 1)
+}
@@ -0,0 +1,108 @@
+package lime
+
+import (
+	"context"
+	"strings"
+)
+
+// RouteMatch checks if the provided path matches the route template, returning the values of the template parameters.
+// A template parameter is a path segment enclosed by braces, like in '/friends/{nickname}'.
+// For instance, the path '/friends/john' matches the previous template, with the value 'john' for the 'nickname'
+// parameter.
+func RouteMatch(template string, path string) (map[string]string, bool) {
+	templateSegments := strings.Split(strings.Trim(template, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+
+	if len(templateSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+
+	for i, s := range templateSegments {
+		if len(s) > 2 && strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			params[s[1:len(s)-1]] = pathSegments[i]
+			continue
+		}
+
+		if s != pathSegments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// CommandRouter dispatches the received commands by its method and URI path, using route templates like
+// '/friends/{nickname}'. It should be registered in an EnvelopeMux through the RequestCommandRouter method.
+// The extracted template parameters are available to the handlers through the ContextRouteParams function.
+// Avoid instantiating it directly, use the NewCommandRouter() function instead.
+type CommandRouter struct {
+	routes []commandRoute
+}
+
+type commandRoute struct {
+	method      CommandMethod
+	template    string
+	handlerFunc RequestCommandHandlerFunc
+}
+
+// NewCommandRouter creates a new instance of CommandRouter.
+func NewCommandRouter() *CommandRouter {
+	return &CommandRouter{}
+}
+
+// Handle registers a function for handling commands with the specified method and an URI path that matches the
+// template. Note that the registration order matters, since the routing stops when the first match occurs.
+func (r *CommandRouter) Handle(method CommandMethod, template string, f RequestCommandHandlerFunc) *CommandRouter {
+	if f == nil {
+		panic("nil handler func")
+	}
+	r.routes = append(r.routes, commandRoute{
+		method:      method,
+		template:    template,
+		handlerFunc: f,
+	})
+	return r
+}
+
+// commandRouterHandler adapts a CommandRouter to the RequestCommandHandler interface.
+type commandRouterHandler struct {
+	router *CommandRouter
+}
+
+func (h *commandRouterHandler) Match(cmd *RequestCommand) bool {
+	_, _, ok := h.router.route(cmd)
+	return ok
+}
+
+func (h *commandRouterHandler) Handle(ctx context.Context, cmd *RequestCommand, s Sender) error {
+	route, params, ok := h.router.route(cmd)
+	if !ok {
+		return nil
+	}
+	return route.handlerFunc(context.WithValue(ctx, contextKeyRouteParams, params), cmd, s)
+}
+
+func (r *CommandRouter) route(cmd *RequestCommand) (*commandRoute, map[string]string, bool) {
+	if cmd == nil || cmd.URI == nil {
+		return nil, nil, false
+	}
+
+	path := cmd.URI.Path()
+
+	for i := range r.routes {
+		route := &r.routes[i]
+		if route.method != cmd.Method {
+			continue
+		}
+		if params, ok := RouteMatch(route.template, path); ok {
+			return route, params, true
+		}
+	}
+
+	return nil, nil, false
+}
@@ -0,0 +1,79 @@
+package lime
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRouteMatch_WithParameter(t *testing.T) {
+	// Act
+	params, ok := RouteMatch("/friends/{nickname}", "/friends/john")
+
+	// Assert
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"nickname": "john"}, params)
+}
+
+func TestRouteMatch_WithoutParameter(t *testing.T) {
+	// Act
+	params, ok := RouteMatch("/friends", "/friends")
+
+	// Assert
+	assert.True(t, ok)
+	assert.Empty(t, params)
+}
+
+func TestRouteMatch_WhenSegmentsDiffer(t *testing.T) {
+	// Act
+	_, ok1 := RouteMatch("/friends/{nickname}", "/friends")
+	_, ok2 := RouteMatch("/friends/{nickname}", "/contacts/john")
+	_, ok3 := RouteMatch("/friends/{nickname}", "/friends/john/photo")
+
+	// Assert
+	assert.False(t, ok1)
+	assert.False(t, ok2)
+	assert.False(t, ok3)
+}
+
+func TestCommandRouter_Handle_ExtractParams(t *testing.T) {
+	// Arrange
+	var actual map[string]string
+	router := NewCommandRouter().
+		Handle(CommandMethodGet, "/friends", func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+			assert.Fail(t, "unexpected route")
+			return nil
+		}).
+		Handle(CommandMethodDelete, "/friends/{nickname}", func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+			actual, _ = ContextRouteParams(ctx)
+			return nil
+		})
+	mux := &EnvelopeMux{}
+	mux.RequestCommandRouter(router)
+	cmd := &RequestCommand{}
+	cmd.SetURIString("/friends/john").SetMethod(CommandMethodDelete).SetID(NewEnvelopeID())
+
+	// Act
+	err := mux.handleRequestCommand(context.Background(), cmd, nil)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"nickname": "john"}, actual)
+}
+
+func TestCommandRouter_Match_WhenMethodDiffers(t *testing.T) {
+	// Arrange
+	router := NewCommandRouter().
+		Handle(CommandMethodGet, "/friends/{nickname}", func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+			return nil
+		})
+	handler := &commandRouterHandler{router: router}
+	cmd := &RequestCommand{}
+	cmd.SetURIString("/friends/john").SetMethod(CommandMethodSet)
+
+	// Act
+	match := handler.Match(cmd)
+
+	// Assert
+	assert.False(t, match)
+}
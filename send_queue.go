@@ -0,0 +1,110 @@
+package lime
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+var errClientClosed = errors.New("client: closed")
+
+// EnqueueMessage adds the message to the send queue of the client, which sends it asynchronously.
+// The messages are sent in the order they were enqueued and the failures are reported to the
+// ClientConfig.OnSendError function. If the queue is full, the call blocks until there's space or the context
+// is canceled. It requires the queue to be enabled through the ClientConfig.SendQueueSize value.
+func (c *Client) EnqueueMessage(ctx context.Context, msg *Message) error {
+	if msg == nil {
+		panic("nil message")
+	}
+	if c.sendQueue == nil {
+		return errors.New("client: the send queue is not enabled")
+	}
+
+	// The read lock is held while enqueuing, so the queue is not discarded before the message is added to it
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+	if c.sendClosed {
+		return errClientClosed
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.sendClosing:
+		return errClientClosed
+	case c.sendQueue <- msg:
+		return nil
+	}
+}
+
+func (c *Client) startSender() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.sendQueue = make(chan *Message, c.config.SendQueueSize)
+	c.sendCancel = cancel
+	c.sendDone = make(chan struct{})
+	c.sendClosing = make(chan struct{})
+
+	go func() {
+		defer close(c.sendDone)
+
+		for {
+			select {
+			case <-ctx.Done():
+				c.discardQueue()
+				return
+			case msg := <-c.sendQueue:
+				c.sendQueued(ctx, msg)
+			}
+		}
+	}()
+}
+
+func (c *Client) stopSender() {
+	if c.sendCancel == nil {
+		return
+	}
+	// The concurrent calls await for the first one to stop the queue
+	c.sendStop.Do(func() {
+		// Releases the calls blocked by a full queue before awaiting for the lock
+		close(c.sendClosing)
+		c.sendMu.Lock()
+		c.sendClosed = true
+		c.sendMu.Unlock()
+
+		// The messages enqueued until now are sent or reported as discarded by the goroutine
+		c.sendCancel()
+		<-c.sendDone
+	})
+}
+
+func (c *Client) sendQueued(ctx context.Context, msg *Message) {
+	if c.config.SendTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.SendTimeout)
+		defer cancel()
+	}
+
+	if err := c.SendMessage(ctx, msg); err != nil {
+		c.reportSendError(msg, err)
+	}
+}
+
+// discardQueue reports the messages that were not sent before the client was closed.
+func (c *Client) discardQueue() {
+	for {
+		select {
+		case msg := <-c.sendQueue:
+			c.reportSendError(msg, errClientClosed)
+		default:
+			return
+		}
+	}
+}
+
+func (c *Client) reportSendError(msg *Message, err error) {
+	if c.config.OnSendError != nil {
+		c.config.OnSendError(msg, err)
+	} else {
+		log.Printf("client: send queue: %v", err)
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"os"
 	"reflect"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -24,8 +26,12 @@ type Server struct {
 	mux           *EnvelopeMux
 	listeners     []BoundListener
 	mu            sync.Mutex
-	transportChan chan Transport
+	transportChan chan acceptedTransport
 	shutdown      context.CancelFunc
+	hsSlots       chan struct{} // hsSlots limits the number of concurrent session establishments, if not nil
+	shedSlots     chan struct{} // shedSlots limits the number of transports being rejected, if not nil
+	replays       *replayCache  // replays holds the nonces of the received signed envelopes, if not nil
+	sessions      SessionStore  // sessions holds the established session channels
 }
 
 // NewServer creates a new instance of the Server type.
@@ -39,12 +45,29 @@ func NewServer(config *ServerConfig, mux *EnvelopeMux, listeners ...BoundListene
 	if len(listeners) == 0 {
 		panic("empty listeners")
 	}
-	return &Server{
+	srv := &Server{
 		config:        config,
 		mux:           mux,
 		listeners:     listeners,
-		transportChan: make(chan Transport, config.Backlog),
+		transportChan: make(chan acceptedTransport, config.Backlog),
 	}
+	if config.MaxConcurrentHandshakes > 0 {
+		srv.hsSlots = make(chan struct{}, config.MaxConcurrentHandshakes)
+	}
+	if config.OnOverload != nil {
+		srv.shedSlots = make(chan struct{}, maxConcurrentSheds)
+	}
+	if config.ReplayWindow > 0 {
+		srv.replays = newReplayCache(config.ReplayWindow)
+	}
+	if config.DeadLetter != nil {
+		mux.deadLetter = config.DeadLetter
+	}
+	srv.sessions = config.SessionStore
+	if srv.sessions == nil {
+		srv.sessions = NewMemorySessionStore()
+	}
+	return srv
 }
 
 // ListenAndServe starts listening for new connections in the registered transport listeners.
@@ -72,7 +95,7 @@ func (srv *Server) ListenAndServe() error {
 		listener := l
 
 		eg.Go(func() error {
-			return acceptTransports(ctx, listener.Listener, srv.transportChan)
+			return srv.acceptTransports(ctx, listener)
 		})
 	}
 
@@ -89,16 +112,40 @@ func (srv *Server) ListenAndServe() error {
 	return err
 }
 
-func acceptTransports(ctx context.Context, listener TransportListener, c chan<- Transport) error {
+// acceptBatchSize defines the maximum number of transports accepted from a listener at once.
+const acceptBatchSize = 16
+
+// acceptedTransport is a transport accepted by one of the server listeners.
+type acceptedTransport struct {
+	transport    Transport
+	listenerName string
+}
+
+func (srv *Server) acceptTransports(ctx context.Context, listener BoundListener) error {
 	for {
-		transport, err := listener.Accept(ctx)
+		transports, err := AcceptN(ctx, listener.Listener, acceptBatchSize)
 		if err != nil {
 			return err
 		}
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case c <- transport:
+		for i, transport := range transports {
+			t := acceptedTransport{transport: transport, listenerName: listener.Name}
+			if srv.config.OnOverload != nil {
+				// Sheds the transport instead of waiting when the backlog is full
+				select {
+				case srv.transportChan <- t:
+				default:
+					srv.shedTransport(ctx, t)
+				}
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				for _, t := range transports[i:] {
+					_ = t.Close()
+				}
+				return ctx.Err()
+			case srv.transportChan <- t:
+			}
 		}
 	}
 }
@@ -109,7 +156,36 @@ func (srv *Server) consumeTransports(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case t := <-srv.transportChan:
-			c := NewServerChannel(t, srv.config.ChannelBufferSize, srv.config.Node, uuid.NewString())
+			if srv.config.OnOverload != nil {
+				if !srv.tryAcquireHandshakeSlot() {
+					srv.shedTransport(ctx, t)
+					continue
+				}
+			} else if !srv.acquireHandshakeSlot(ctx) {
+				_ = t.transport.Close()
+				return
+			}
+			c := NewServerChannel(t.transport, srv.config.ChannelBufferSize, srv.config.Node, srv.newSessionID())
+			c.listenerName = t.listenerName
+			c.enforceFrom = srv.config.EnforceFromAddress
+			c.rejectFrom = srv.config.RejectFromAddressMismatch
+			c.dropExpired = srv.config.DropExpiredEnvelopes
+			c.notifyExpired = srv.config.NotifyExpiredMessages
+			c.validateSessionID = srv.config.SessionIDValidator
+			c.maxAuthAttempts = srv.config.MaxAuthAttempts
+			c.echoWatchdog = srv.config.EchoWatchdog
+			c.correlationKey = srv.config.CorrelationKey
+			c.verifier = srv.config.Verifier
+			c.replays = srv.replays
+			if srv.config.ContinueOnSession {
+				c.onSession = func(ses *Session) {
+					go srv.handleContinuedSession(ctx, c, ses)
+				}
+			}
+			if srv.config.OnDuplicateEnvelope != nil {
+				c.rcvCmdIDs = newEnvelopeIDCache(defaultEnvelopeIDCacheSize)
+				c.onDupEnvelope = srv.config.OnDuplicateEnvelope
+			}
 			go func() {
 				srv.handleChannel(ctx, c)
 			}()
@@ -117,44 +193,284 @@ func (srv *Server) consumeTransports(ctx context.Context) {
 	}
 }
 
-func (srv *Server) handleChannel(ctx context.Context, c *ServerChannel) {
-	err := c.EstablishSession(
-		ctx,
-		srv.config.CompOpts,
-		srv.config.EncryptOpts,
-		srv.config.SchemeOpts,
-		srv.config.Authenticate,
-		srv.config.Register,
-	)
+// newSessionID returns the id for a new session, from the SessionIDGenerator function if defined.
+func (srv *Server) newSessionID() string {
+	if srv.config.SessionIDGenerator != nil {
+		if id := srv.config.SessionIDGenerator(); id != "" {
+			return id
+		}
+	}
+	return uuid.NewString()
+}
+
+func (srv *Server) acquireHandshakeSlot(ctx context.Context) bool {
+	if srv.hsSlots == nil {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case srv.hsSlots <- struct{}{}:
+		return true
+	}
+}
 
+func (srv *Server) tryAcquireHandshakeSlot() bool {
+	if srv.hsSlots == nil {
+		return true
+	}
+	select {
+	case srv.hsSlots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// shedTimeout is the maximum time for rejecting a transport when the server is overloaded.
+const shedTimeout = time.Second
+
+// maxConcurrentSheds is the maximum number of transports being rejected at once when the server is overloaded.
+const maxConcurrentSheds = 64
+
+// shedTransport rejects a transport when the server is overloaded, failing the session with the reason returned by
+// the OnOverload function. The new session sent by the client is received before the failed one is sent, so the
+// client receives it as the response of its establishment attempt.
+// If there are already maxConcurrentSheds transports being rejected, the transport is closed without a session.
+func (srv *Server) shedTransport(ctx context.Context, t acceptedTransport) {
+	reason := srv.config.OnOverload()
+	if reason == nil {
+		_ = t.transport.Close()
+		return
+	}
+
+	select {
+	case srv.shedSlots <- struct{}{}:
+	default:
+		_ = t.transport.Close()
+		return
+	}
+
+	go func() {
+		defer func() {
+			_ = t.transport.Close()
+			<-srv.shedSlots
+		}()
+
+		ctx, cancel := context.WithTimeout(ctx, shedTimeout)
+		defer cancel()
+
+		if _, err := t.transport.Receive(ctx); err != nil {
+			return
+		}
+		ses := &Session{
+			Envelope: Envelope{
+				ID:   uuid.NewString(),
+				From: srv.config.Node,
+			},
+			State:  SessionStateFailed,
+			Reason: reason,
+		}
+		if err := t.transport.Send(ctx, ses); err != nil {
+			log.Printf("server: shed transport: %v\n", err)
+		}
+	}()
+}
+
+func (srv *Server) releaseHandshakeSlot() {
+	if srv.hsSlots != nil {
+		<-srv.hsSlots
+	}
+}
+
+func (srv *Server) handleChannel(ctx context.Context, c *ServerChannel) {
+	err := srv.establishChannel(ctx, c)
+	srv.releaseHandshakeSlot()
 	if err != nil {
 		log.Printf("server: establish: %v\n", err)
 		return
 	}
 
+	srv.sessions.Add(c)
+
+	// The callback must return before the listener starts, since it may send envelopes that are expected to be
+	// delivered before the handlers output.
 	established := srv.config.Established
 	if established != nil {
 		established(c.sessionID, c)
 	}
 
 	defer func() {
+		srv.sessions.Remove(c.sessionID)
+
+		if err == nil {
+			err = c.receiveErr()
+		}
+		if err == nil && c.State() == SessionStateEstablished && !c.transport.Connected() {
+			err = errors.New("server: the transport was closed before the session was finished")
+		}
+
 		if c.Established() {
 			// Do not use the shared context since it could be canceled
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 			defer cancel()
-			_ = c.FinishSession(ctx)
+			if finishErr := c.FinishSession(ctx); err == nil {
+				err = finishErr
+			}
 		}
 
 		finished := srv.config.Finished
 		if finished != nil {
-			finished(c.sessionID)
+			finished(c.sessionID, c.failedReason(), err)
 		}
 	}()
 
 	if err = srv.mux.ListenServer(ctx, c); err != nil {
 		log.Printf("server: listen: %v\n", err)
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			// The server is closing, so the session is finished gracefully
+			err = nil
+		}
 		return
 	}
+
+	// The listener stops when a session envelope is received, like a 'finishing' request from the node
+	if ses, ok := c.receivedSession(); ok {
+		if err = srv.handleSession(ctx, c, ses); err != nil {
+			log.Printf("server: session: %v\n", err)
+		}
+	}
+}
+
+// handleContinuedSession handles a session envelope received from the node when the ContinueOnSession option is
+// enabled. Since the listener keeps running, the session is only finished if requested by the node and there's no
+// session handler, or if the handler finishes it.
+func (srv *Server) handleContinuedSession(ctx context.Context, c *ServerChannel, ses *Session) {
+	if err := srv.handleSession(ctx, c, ses); err != nil {
+		log.Printf("server: session: %v\n", err)
+		return
+	}
+	if srv.config.SessionHandler == nil && ses.State == SessionStateFinishing && c.Established() {
+		if err := c.FinishSession(ctx); err != nil {
+			log.Printf("server: session: %v\n", err)
+		}
+	}
+}
+
+// handleSession handles a session envelope received from the node in an established session.
+// The node is only allowed to request the session finishing, which is replied with a 'finished' session after the
+// handling, if the session is still established. Other states fail the session.
+func (srv *Server) handleSession(ctx context.Context, c *ServerChannel, ses *Session) error {
+	if srv.config.SessionHandler != nil {
+		return srv.config.SessionHandler(sessionContext(ctx, c.channel), ses, c)
+	}
+	if ses.State == SessionStateFinishing {
+		return nil
+	}
+	return c.FailSession(ctx, &Reason{
+		Code:        ReasonCodeSessionInvalidActionForState,
+		Description: fmt.Sprintf("The '%v' state is not allowed in an established session", ses.State),
+	})
+}
+
+func (srv *Server) establishChannel(ctx context.Context, c *ServerChannel) error {
+	estCtx, cancel := ctx, context.CancelFunc(func() {})
+	if srv.config.EstablishTimeout > 0 {
+		estCtx, cancel = context.WithTimeout(ctx, srv.config.EstablishTimeout)
+	}
+	defer cancel()
+
+	err := c.EstablishSession(
+		estCtx,
+		srv.config.CompOpts,
+		srv.config.EncryptOpts,
+		srv.config.SchemeOpts,
+		srv.config.Authenticate,
+		srv.config.Register,
+	)
+
+	if err != nil && ctx.Err() == nil && errors.Is(estCtx.Err(), context.DeadlineExceeded) {
+		// Do not use the establishment context since it is expired
+		failCtx, failCancel := context.WithTimeout(context.Background(), time.Second)
+		defer failCancel()
+		failErr := c.FailSession(failCtx, &Reason{
+			Code:        ReasonCodeSessionNegotiationTimeout,
+			Description: "The session establishment timed out",
+		})
+		if failErr != nil {
+			_ = c.Close()
+		}
+	}
+
+	return err
+}
+
+// Addrs returns the effective addresses of the server transport listeners.
+// For listeners that are not started yet, the configured address is returned.
+func (srv *Server) Addrs() []net.Addr {
+	addrs := make([]net.Addr, 0, len(srv.listeners))
+	for _, l := range srv.listeners {
+		if addr := l.Listener.Addr(); addr != nil {
+			addrs = append(addrs, addr)
+		} else {
+			addrs = append(addrs, l.Addr)
+		}
+	}
+	return addrs
+}
+
+// SessionStore returns the store of the established session channels of the server, which allows the lookup of the
+// channels by the remote node.
+func (srv *Server) SessionStore() SessionStore {
+	return srv.sessions
+}
+
+// Broadcast sends the message to all the established sessions of the server, except the session of the sender.
+// The sender session is identified from the context, for messages received by the handlers, or by the message From
+// value. The errors of each recipient are aggregated in the returned error.
+func (srv *Server) Broadcast(ctx context.Context, msg *Message) error {
+	if msg == nil {
+		panic("nil message")
+	}
+	senderID, _ := ContextSessionID(ctx)
+	var err error
+	for _, c := range srv.sessions.All() {
+		if c.ID() == senderID || (msg.From != Node{} && c.RemoteNode() == msg.From) {
+			continue
+		}
+		if sendErr := c.SendMessage(ctx, msg); sendErr != nil {
+			err = multierr.Append(err, fmt.Errorf("broadcast to '%v': %w", c.RemoteNode(), sendErr))
+		}
+	}
+	return err
+}
+
+// Send delivers the envelope to the established session of the specified node.
+// If the node has no instance, the envelope is delivered to any session of the node identity.
+// An error that wraps ErrRouteNotFound is returned if there's no session for the node.
+// The value should be a *Message, *Notification, *RequestCommand or *ResponseCommand, otherwise an error is returned.
+func (srv *Server) Send(ctx context.Context, n Node, e interface{}) error {
+	c, ok := srv.sessions.Get(n)
+	if !ok {
+		return fmt.Errorf("send to '%v': %w", n, ErrRouteNotFound)
+	}
+	var err error
+	switch v := e.(type) {
+	case *Message:
+		err = c.SendMessage(ctx, v)
+	case *Notification:
+		err = c.SendNotification(ctx, v)
+	case *RequestCommand:
+		err = c.SendRequestCommand(ctx, v)
+	case *ResponseCommand:
+		err = c.SendResponseCommand(ctx, v)
+	default:
+		err = fmt.Errorf("unsupported type %T", e)
+	}
+	if err != nil {
+		return fmt.Errorf("send to '%v': %w", n, err)
+	}
+	return nil
 }
 
 // Close stops the server by closing the transport listeners and all active sessions.
@@ -184,8 +500,8 @@ func (srv *Server) Close() error {
 // ServerConfig define the configurations for a Server instance.
 type ServerConfig struct {
 	Node              Node                   // Node represents the server's address.
-	CompOpts          []SessionCompression   // CompOpts defines the compression options to be used in the session negotiation.
-	EncryptOpts       []SessionEncryption    // EncryptOpts defines the encryption options to be used in the session negotiation.
+	CompOpts          []SessionCompression   // CompOpts defines the compression options to be used in the session negotiation, in the server preference order.
+	EncryptOpts       []SessionEncryption    // EncryptOpts defines the encryption options to be used in the session negotiation, in the server preference order.
 	SchemeOpts        []AuthenticationScheme // SchemeOpts defines the authentication schemes that should be presented to the clients during session establishment.
 	Backlog           int                    // Backlog defines the size of the listener's pending connections queue.
 	ChannelBufferSize int                    // ChannelBufferSize determines the internal envelope buffer size for the channels.
@@ -198,9 +514,93 @@ type ServerConfig struct {
 	// to the session.
 	Register func(ctx context.Context, candidate Node, c *ServerChannel) (Node, error)
 	// Established is called when a session with a node is established.
+	// It is called synchronously before the server starts handling the envelopes received from the node, so any
+	// envelope sent through the channel from within it, like a welcome message, is delivered to the node before the
+	// envelopes produced by the handlers.
 	Established func(sessionID string, c *ServerChannel)
 	// Finished is called when an established session with a node is finished.
-	Finished func(sessionID string)
+	// The reason is defined if the session was failed, and the err is defined if the session was terminated by an
+	// error, like a transport failure. Both are nil for a graceful finish.
+	Finished func(sessionID string, reason *Reason, err error)
+	// SessionHandler is called when a session envelope is received from the node in an established session, like a
+	// 'finishing' request. The handler may finish or fail the session through the channel, otherwise the session is
+	// finished by the server after the handler returns.
+	SessionHandler func(ctx context.Context, ses *Session, c *ServerChannel) error
+	// ContinueOnSession indicates if the server should keep handling the envelopes of an established session after
+	// receiving a session envelope from the node, like renegotiation requests. When enabled, the session envelopes
+	// are dispatched to the SessionHandler in a separate goroutine, and the session is only finished if the handler
+	// does it. Without a handler, a 'finishing' request still finishes the session.
+	ContinueOnSession bool
+	// EnforceFromAddress indicates if the originator address of the envelopes received in established sessions should
+	// match the session remote node. When enabled, envelopes with a mismatched From address are corrected to the
+	// registered node, unless RejectFromAddressMismatch is also enabled.
+	EnforceFromAddress bool
+	// RejectFromAddressMismatch indicates that the session should be failed, instead of the address being corrected,
+	// when an envelope with a mismatched From address is received. It is only used if EnforceFromAddress is enabled.
+	RejectFromAddressMismatch bool
+	// DropExpiredEnvelopes indicates if the received messages and request commands with an expiration timestamp in the
+	// past should be discarded before being handled.
+	DropExpiredEnvelopes bool
+	// NotifyExpiredMessages indicates if a 'failed' notification should be sent to the originator of the discarded
+	// expired messages. It is only used if DropExpiredEnvelopes is enabled.
+	NotifyExpiredMessages bool
+	// EstablishTimeout defines the maximum duration for the establishment of a session with a client.
+	// When the timeout expires, the session is failed and the transport is closed.
+	// A zero value means no timeout, other than the server lifetime.
+	EstablishTimeout time.Duration
+	// OnDuplicateEnvelope is called when a request command with the same id of a recently received one is received
+	// in a session, which may indicate a retry or duplication by the remote party.
+	// The function is called synchronously by the session receiver goroutine, so it should not block.
+	OnDuplicateEnvelope func(id string)
+	// MaxConcurrentHandshakes defines the maximum number of session establishments that can run concurrently.
+	// The accepted transports exceeding the limit are queued until a running establishment completes, or rejected
+	// if the OnOverload function is defined.
+	// A zero value means no limit.
+	MaxConcurrentHandshakes int
+	// OnOverload is called when a transport is accepted while the server is overloaded, which is when the Backlog
+	// queue is full or when the MaxConcurrentHandshakes limit is reached. If defined, the transport is rejected
+	// instead of being queued, receiving a 'failed' session with the returned reason, like a "server busy"
+	// description. If it returns nil, or if too many transports are already being rejected, the transport is closed
+	// without a session.
+	// The function is called by the goroutines that accept and consume the transports, so it should not block.
+	OnOverload func() *Reason
+	// SessionIDGenerator is called for assigning the id of each new session, allowing the use of ids provided by an
+	// external source, like a federation store. If not defined or if it returns an empty string, a random UUID is used.
+	// The function is called by the goroutine that consumes the accepted transports, so it should not block.
+	SessionIDGenerator func() string
+	// SessionIDValidator is called during the session establishment for validating the id assigned to the session,
+	// allowing the validation against an external store, like for preventing replays.
+	// If it returns an error, the session is failed with the reason of the error, if it is a ReasonError, or
+	// with a generic session error reason otherwise.
+	SessionIDValidator func(ctx context.Context, id string) error
+	// MaxAuthAttempts defines the maximum number of authentication attempts of a client during the session
+	// establishment, including the authentication round trips. When it is reached without a successful
+	// authentication, the session is failed. A zero value means no limit.
+	MaxAuthAttempts int
+	// EchoWatchdog indicates if the watchdog notifications sent by the clients should be echoed back, allowing the
+	// clients to detect unresponsive connections. See the Client.EnableWatchdog method.
+	EchoWatchdog bool
+	// CorrelationKey is the metadata key used for propagating correlation ids, for distributed tracing.
+	// If defined, the ids found in the received envelopes are available to the handlers through the
+	// ContextCorrelationID function and the ids of the context are added to the sent envelopes.
+	CorrelationKey string
+	// Verifier verifies the signature of the envelopes received from the clients, which should be signed through the
+	// ClientConfig.Signer value. Messages and request commands without a valid signature are rejected with a
+	// failure notification and response, respectively, while the other envelopes are discarded.
+	Verifier Verifier
+	// ReplayWindow defines the maximum difference between the signing timestamp of the received envelopes and the
+	// current time. The signed envelopes out of the window or with a nonce that was already received from the same
+	// node are rejected, like the envelopes with an invalid signature. It requires the Verifier to be defined.
+	// A zero value disables the replay protection.
+	ReplayWindow time.Duration
+	// DeadLetter is called for the received messages that can't be delivered, which are the messages not matched by
+	// any handler and the ones whose handler returns an error that wraps ErrRouteNotFound. It allows the messages to be
+	// persisted or bounced. If a ReasonError is returned, a 'failed' notification is sent to the message sender
+	// when the AutoNotifyFailed middleware is enabled; other errors finish the session, like the handler errors.
+	DeadLetter func(ctx context.Context, msg *Message) error
+	// SessionStore holds the established session channels, which are added and removed by the server when the
+	// sessions are established and finished. If not defined, a MemorySessionStore is used.
+	SessionStore SessionStore
 }
 
 var defaultServerConfig = NewServerConfig()
@@ -296,6 +696,36 @@ func (b *ServerBuilder) MessageHandler(handler MessageHandler) *ServerBuilder {
 	return b
 }
 
+// MessageHandlers allows the registration of many MessageHandler instances at once, in the slice order.
+// Note that the registration order matters, since the receiving process stops when the first predicate match occurs.
+func (b *ServerBuilder) MessageHandlers(handlers []MessageHandler) *ServerBuilder {
+	for _, h := range handlers {
+		b.mux.MessageHandler(h)
+	}
+	return b
+}
+
+// MessageMiddleware allows the registration of a middleware that wraps the handling of all received messages.
+// The middlewares are executed in the registration order.
+func (b *ServerBuilder) MessageMiddleware(middleware MessageMiddleware) *ServerBuilder {
+	b.mux.MessageMiddleware(middleware)
+	return b
+}
+
+// DisablePanicRecovery disables the recovery from panics in the handlers, which are recovered by default for
+// keeping the session alive. It may be useful for debugging.
+func (b *ServerBuilder) DisablePanicRecovery() *ServerBuilder {
+	b.mux.DisablePanicRecovery()
+	return b
+}
+
+// DefaultCommandResponse enables sending a failure response for the received request commands that are not matched
+// by any handler, instead of ignoring them.
+func (b *ServerBuilder) DefaultCommandResponse() *ServerBuilder {
+	b.mux.DefaultCommandResponse()
+	return b
+}
+
 // NotificationHandlerFunc allows the registration of a function for handling received notifications that matches
 // the specified predicate. Note that the registration order matters, since the receiving process stops when
 // the first predicate match occurs.
@@ -340,6 +770,54 @@ func (b *ServerBuilder) RequestCommandHandler(handler RequestCommandHandler) *Se
 	return b
 }
 
+// RequestCommandRouter allows the registration of a CommandRouter for handling received commands that matches its
+// routes. Note that the registration order matters, since the receiving process stops when the first match occurs.
+func (b *ServerBuilder) RequestCommandRouter(router *CommandRouter) *ServerBuilder {
+	b.mux.RequestCommandRouter(router)
+	return b
+}
+
+// RequestCommandRoutes allows the registration of many command routes at once, like from a generated routing table.
+// The map keys are composed by the command method and the route template, separated by a space, like
+// 'get /friends/{nickname}'. The routes are registered in a CommandRouter in the lexical order of the method and
+// template, which makes the routes with literal segments to be evaluated before the routes with template parameters
+// in the same position, like '/friends/me' before '/friends/{nickname}'.
+// It panics if a key is not in the expected format or has an invalid method.
+func (b *ServerBuilder) RequestCommandRoutes(routes map[string]RequestCommandHandlerFunc) *ServerBuilder {
+	parsed := make([]commandRoute, 0, len(routes))
+	for k, f := range routes {
+		method, template, ok := parseRouteKey(k)
+		if !ok {
+			panic(fmt.Sprintf("invalid route key '%v'", k))
+		}
+		parsed = append(parsed, commandRoute{method: method, template: template, handlerFunc: f})
+	}
+	sort.Slice(parsed, func(i, j int) bool {
+		if parsed[i].method != parsed[j].method {
+			return parsed[i].method < parsed[j].method
+		}
+		return parsed[i].template < parsed[j].template
+	})
+
+	router := NewCommandRouter()
+	for _, r := range parsed {
+		router.Handle(r.method, r.template, r.handlerFunc)
+	}
+	return b.RequestCommandRouter(router)
+}
+
+func parseRouteKey(key string) (CommandMethod, string, bool) {
+	values := strings.Fields(key)
+	if len(values) != 2 {
+		return "", "", false
+	}
+	method := CommandMethod(strings.ToLower(values[0]))
+	if err := method.Validate(); err != nil {
+		return "", "", false
+	}
+	return method, values[1], true
+}
+
 // AutoReplyPings adds a RequestCommandHandler handler to automatically reply ping requests from the remote node.
 func (b *ServerBuilder) AutoReplyPings() *ServerBuilder {
 	return b.RequestCommandHandlerFunc(
@@ -353,6 +831,79 @@ func (b *ServerBuilder) AutoReplyPings() *ServerBuilder {
 		})
 }
 
+// Echo configures the server to send the received messages back to its senders and to automatically reply the
+// ping requests, which is useful as a test harness or for demonstrations. The echoed messages have the same content
+// of the received ones, with a new id if the received message has one.
+func (b *ServerBuilder) Echo() *ServerBuilder {
+	return b.
+		AutoReplyPings().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			echoMsg := &Message{}
+			if msg.ID != "" {
+				echoMsg.ID = NewEnvelopeID()
+			}
+			echoMsg.SetContent(msg.Content).SetTo(msg.From)
+			return s.SendMessage(ctx, echoMsg)
+		})
+}
+
+// EchoWatchdog enables the echo of the watchdog notifications sent by the clients.
+func (b *ServerBuilder) EchoWatchdog() *ServerBuilder {
+	b.config.EchoWatchdog = true
+	return b
+}
+
+// CorrelationKey sets the metadata key used for propagating correlation ids.
+func (b *ServerBuilder) CorrelationKey(key string) *ServerBuilder {
+	b.config.CorrelationKey = key
+	return b
+}
+
+// Verifier sets the Verifier for the signature of the envelopes received from the clients.
+func (b *ServerBuilder) Verifier(verifier Verifier) *ServerBuilder {
+	b.config.Verifier = verifier
+	return b
+}
+
+// ReplayWindow enables the rejection of replayed signed envelopes, accepting only the timestamps within the window.
+func (b *ServerBuilder) ReplayWindow(window time.Duration) *ServerBuilder {
+	b.config.ReplayWindow = window
+	return b
+}
+
+// DeadLetter sets the function for handling the received messages that can't be delivered.
+func (b *ServerBuilder) DeadLetter(f func(ctx context.Context, msg *Message) error) *ServerBuilder {
+	b.config.DeadLetter = f
+	return b
+}
+
+// SessionStore sets the store of the established session channels.
+func (b *ServerBuilder) SessionStore(store SessionStore) *ServerBuilder {
+	b.config.SessionStore = store
+	return b
+}
+
+// AutoNotifyReceived adds a MessageMiddleware to automatically send a 'received' notification to the sender of each
+// message that has an id, before the message handlers are executed.
+func (b *ServerBuilder) AutoNotifyReceived() *ServerBuilder {
+	return b.MessageMiddleware(func(next MessageHandlerFunc) MessageHandlerFunc {
+		return func(ctx context.Context, msg *Message, s Sender) error {
+			if msg.ID != "" {
+				if err := s.SendNotification(ctx, msg.Notification(NotificationEventReceived)); err != nil {
+					return err
+				}
+			}
+			return next(ctx, msg, s)
+		}
+	})
+}
+
+// AutoNotifyFailed adds a MessageMiddleware to automatically send a 'failed' notification to the sender of a message
+// when its handler returns a ReasonError. The notification reason is obtained from the error, which is not propagated.
+func (b *ServerBuilder) AutoNotifyFailed() *ServerBuilder {
+	return b.MessageMiddleware(notifyFailedMiddleware)
+}
+
 // ResponseCommandHandlerFunc allows the registration of a function for handling received commands that matches
 // the specified predicate. Note that the registration order matters, since the receiving process stops when
 // the first predicate match occurs.
@@ -375,6 +926,15 @@ func (b *ServerBuilder) ResponseCommandHandler(handler ResponseCommandHandler) *
 	return b
 }
 
+// FederationLink registers the handlers for forwarding the messages and notifications addressed to other domains to
+// the upstream server of the specified link.
+// Note that the local session channels should be added to the link when established, for receiving the envelopes
+// from the upstream.
+func (b *ServerBuilder) FederationLink(link *FederationLink) *ServerBuilder {
+	link.RegisterHandlers(b.mux)
+	return b
+}
+
 // ListenTCP adds a new TCP transport listener with the specified configuration.
 // This method can be called multiple times.
 func (b *ServerBuilder) ListenTCP(addr *net.TCPAddr, config *TCPConfig) *ServerBuilder {
@@ -383,6 +943,15 @@ func (b *ServerBuilder) ListenTCP(addr *net.TCPAddr, config *TCPConfig) *ServerB
 	return b
 }
 
+// ListenUnix adds a new transport listener in the Unix domain socket of the specified path, with the TCP transport
+// configuration. The socket file is removed when the server is closed.
+// This method can be called multiple times.
+func (b *ServerBuilder) ListenUnix(path string, config *TCPConfig) *ServerBuilder {
+	listener := NewTCPTransportListener(config)
+	b.listeners = append(b.listeners, NewBoundListener(listener, &net.UnixAddr{Name: path, Net: "unix"}))
+	return b
+}
+
 // ListenWebsocket adds a new Websocket transport listener with the specified configuration.
 // This method can be called multiple times.
 func (b *ServerBuilder) ListenWebsocket(addr *net.TCPAddr, config *WebsocketConfig) *ServerBuilder {
@@ -391,6 +960,30 @@ func (b *ServerBuilder) ListenWebsocket(addr *net.TCPAddr, config *WebsocketConf
 	return b
 }
 
+// ListenTCPAddr adds a new TCP transport listener in the specified 'host:port' address with the specified
+// configuration. The host can be a hostname or an IP address, using the bracket notation for IPv6 addresses,
+// like '[::1]:55321'. It panics if the address cannot be resolved.
+// This method can be called multiple times.
+func (b *ServerBuilder) ListenTCPAddr(addr string, config *TCPConfig) *ServerBuilder {
+	return b.ListenTCP(resolveTCPAddr(addr), config)
+}
+
+// ListenWebsocketAddr adds a new Websocket transport listener in the specified 'host:port' address with the
+// specified configuration. The host can be a hostname or an IP address, using the bracket notation for IPv6
+// addresses, like '[::1]:8080'. It panics if the address cannot be resolved.
+// This method can be called multiple times.
+func (b *ServerBuilder) ListenWebsocketAddr(addr string, config *WebsocketConfig) *ServerBuilder {
+	return b.ListenWebsocket(resolveTCPAddr(addr), config)
+}
+
+func resolveTCPAddr(addr string) *net.TCPAddr {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		panic(fmt.Errorf("invalid addr: %w", err))
+	}
+	return tcpAddr
+}
+
 // ListenInProcess adds a new in-process transport listener with the specified configuration.
 // This method can be called multiple times.
 func (b *ServerBuilder) ListenInProcess(addr InProcessAddr) *ServerBuilder {
@@ -399,7 +992,16 @@ func (b *ServerBuilder) ListenInProcess(addr InProcessAddr) *ServerBuilder {
 	return b
 }
 
+// Listen adds the specified bound listener, like a named listener created by the NewNamedBoundListener function.
+// This method can be called multiple times.
+func (b *ServerBuilder) Listen(listener BoundListener) *ServerBuilder {
+	b.listeners = append(b.listeners, listener)
+	return b
+}
+
 // CompressionOptions defines the compression options to be used in the session negotiation.
+// The options should be informed in the server preference order, which is used when presenting the options to the
+// client and when the client sends back more than one supported option.
 func (b *ServerBuilder) CompressionOptions(compOpts ...SessionCompression) *ServerBuilder {
 	if len(compOpts) == 0 {
 		panic("empty compOpts")
@@ -409,6 +1011,8 @@ func (b *ServerBuilder) CompressionOptions(compOpts ...SessionCompression) *Serv
 }
 
 // EncryptionOptions defines the encryption options to be used in the session negotiation.
+// The options should be informed in the server preference order, which is used when presenting the options to the
+// client and when the client sends back more than one supported option.
 func (b *ServerBuilder) EncryptionOptions(encryptOpts ...SessionEncryption) *ServerBuilder {
 	if len(encryptOpts) == 0 {
 		panic("empty encryptOpts")
@@ -503,18 +1107,101 @@ func (b *ServerBuilder) Register(register func(ctx context.Context, candidate No
 	return b
 }
 
-// Established is called when a session with a node is established.
+// Established is called when a session with a node is established, before the server starts handling the envelopes
+// received from the node.
 func (b *ServerBuilder) Established(established func(sessionID string, c *ServerChannel)) *ServerBuilder {
 	b.config.Established = established
 	return b
 }
 
-// Finished is called when an established session with a node is finished.
-func (b *ServerBuilder) Finished(finished func(sessionID string)) *ServerBuilder {
+// Finished is called when an established session with a node is finished, with the failure reason and the error
+// that terminated the session, if any.
+func (b *ServerBuilder) Finished(finished func(sessionID string, reason *Reason, err error)) *ServerBuilder {
 	b.config.Finished = finished
 	return b
 }
 
+// SessionHandler is called when a session envelope is received from the node in an established session, like a
+// 'finishing' request, before the session is finished by the server.
+func (b *ServerBuilder) SessionHandler(handler func(ctx context.Context, ses *Session, c *ServerChannel) error) *ServerBuilder {
+	b.config.SessionHandler = handler
+	return b
+}
+
+// ContinueOnSession keeps the server handling the envelopes of an established session after receiving a session
+// envelope from the node, which is dispatched to the SessionHandler without finishing the session.
+func (b *ServerBuilder) ContinueOnSession() *ServerBuilder {
+	b.config.ContinueOnSession = true
+	return b
+}
+
+// EnforceFromAddress enables the enforcement of the originator address of the received envelopes, which should
+// match the session remote node. If reject is true, the session is failed when a mismatched From address is received;
+// otherwise, the address is corrected to the registered node.
+func (b *ServerBuilder) EnforceFromAddress(reject bool) *ServerBuilder {
+	b.config.EnforceFromAddress = true
+	b.config.RejectFromAddressMismatch = reject
+	return b
+}
+
+// DropExpiredEnvelopes enables the discarding of received messages and request commands with an expiration
+// timestamp in the past. If notify is true, a 'failed' notification is sent to the originator of discarded messages.
+func (b *ServerBuilder) DropExpiredEnvelopes(notify bool) *ServerBuilder {
+	b.config.DropExpiredEnvelopes = true
+	b.config.NotifyExpiredMessages = notify
+	return b
+}
+
+// EstablishTimeout sets the maximum duration for the establishment of a session with a client.
+func (b *ServerBuilder) EstablishTimeout(timeout time.Duration) *ServerBuilder {
+	b.config.EstablishTimeout = timeout
+	return b
+}
+
+// MaxConcurrentHandshakes sets the maximum number of session establishments that can run concurrently.
+func (b *ServerBuilder) MaxConcurrentHandshakes(n int) *ServerBuilder {
+	b.config.MaxConcurrentHandshakes = n
+	return b
+}
+
+// Backlog sets the size of the queue of accepted transports awaiting for the session establishment.
+func (b *ServerBuilder) Backlog(n int) *ServerBuilder {
+	b.config.Backlog = n
+	return b
+}
+
+// OnOverload enables the rejection of the transports accepted while the server is overloaded, failing their sessions
+// with the reason returned by the function.
+func (b *ServerBuilder) OnOverload(f func() *Reason) *ServerBuilder {
+	b.config.OnOverload = f
+	return b
+}
+
+// MaxAuthAttempts sets the maximum number of authentication attempts of a client during the session establishment.
+func (b *ServerBuilder) MaxAuthAttempts(n int) *ServerBuilder {
+	b.config.MaxAuthAttempts = n
+	return b
+}
+
+// SessionIDGenerator sets a function for assigning the id of the new sessions.
+func (b *ServerBuilder) SessionIDGenerator(generator func() string) *ServerBuilder {
+	b.config.SessionIDGenerator = generator
+	return b
+}
+
+// SessionIDValidator sets a function for validating the id assigned to the sessions during its establishment.
+func (b *ServerBuilder) SessionIDValidator(validator func(ctx context.Context, id string) error) *ServerBuilder {
+	b.config.SessionIDValidator = validator
+	return b
+}
+
+// OnDuplicateEnvelope sets a function to be called when a request command with the same id of a recently received one
+// is received in a session.
+func (b *ServerBuilder) OnDuplicateEnvelope(onDuplicateEnvelope func(id string)) *ServerBuilder {
+	b.config.OnDuplicateEnvelope = onDuplicateEnvelope
+	return b
+}
+
 // Build creates a new instance of Server.
 func (b *ServerBuilder) Build() *Server {
 	b.config.Authenticate = buildAuthenticate(b.plainAuth, b.keyAuth, b.externalAuth)
@@ -568,6 +1255,9 @@ func buildAuthenticate(plainAuth PlainAuthenticator, keyAuth KeyAuthenticator, e
 type BoundListener struct {
 	Listener TransportListener
 	Addr     net.Addr
+	// Name is an optional label of the listener, for identifying the ingress of the sessions.
+	// It is available to the handlers through the ContextListenerName function.
+	Name string
 }
 
 func NewBoundListener(listener TransportListener, addr net.Addr) BoundListener {
@@ -583,6 +1273,16 @@ func NewBoundListener(listener TransportListener, addr net.Addr) BoundListener {
 	}
 }
 
+// NewNamedBoundListener creates a BoundListener with the specified name.
+func NewNamedBoundListener(name string, listener TransportListener, addr net.Addr) BoundListener {
+	if name == "" {
+		panic("empty name")
+	}
+	l := NewBoundListener(listener, addr)
+	l.Name = name
+	return l
+}
+
 // ErrServerClosed is returned by the Server's ListenAndServe,
 // method after a call to Close.
 var ErrServerClosed = errors.New("lime: Server closed")
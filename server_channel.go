@@ -2,6 +2,7 @@ package lime
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"reflect"
@@ -9,6 +10,10 @@ import (
 
 type ServerChannel struct {
 	*channel
+	// validateSessionID is called during the session establishment for validating the assigned session id, if not nil.
+	validateSessionID func(ctx context.Context, id string) error
+	// maxAuthAttempts limits the number of authentication attempts during the session establishment, if positive.
+	maxAuthAttempts int
 }
 
 func NewServerChannel(t Transport, bufferSize int, serverNode Node, sessionID string) *ServerChannel {
@@ -27,6 +32,40 @@ func NewServerChannel(t Transport, bufferSize int, serverNode Node, sessionID st
 	return &ServerChannel{channel: c}
 }
 
+// DomainRole returns the domain role of the remote node, assigned by the authentication during the session
+// establishment. It is empty if the session is not authenticated.
+func (c *ServerChannel) DomainRole() DomainRole {
+	return c.remoteRole
+}
+
+// ListenerName returns the name of the server listener that accepted the channel transport.
+// It is empty if the channel was not created by a Server or if the listener is not named.
+func (c *ServerChannel) ListenerName() string {
+	return c.listenerName
+}
+
+// ServerName returns the server name requested by the client through the transport, like the TLS server name
+// indication (SNI) of the TCP transport. It returns an empty string if the transport does not support it or if no
+// name was requested by the client.
+// It can be used during the session registration for assigning a domain that matches the requested host.
+func (c *ServerChannel) ServerName() string {
+	if t, ok := c.transport.(serverNameTransport); ok {
+		return t.ServerName()
+	}
+	return ""
+}
+
+// tlsStateTransport is implemented by transports that expose the state of the TLS connection.
+type tlsStateTransport interface {
+	// ConnectionState returns the TLS connection state, or false if the transport is not encrypted with TLS.
+	ConnectionState() (tls.ConnectionState, bool)
+}
+
+// serverNameTransport is implemented by transports that are aware of the server name requested by the client.
+type serverNameTransport interface {
+	ServerName() string
+}
+
 // receiveNewSession receives a new session envelope from the client node.
 func (c *ServerChannel) receiveNewSession(ctx context.Context) (*Session, error) {
 	if err := c.ensureState(SessionStateNew, "receive new session"); err != nil {
@@ -171,6 +210,25 @@ const (
 	DomainRoleRootAuthority = DomainRole("rootAuthority") // The identity is an authority of the domain and its subdomains.
 )
 
+// rank returns the privilege level of the role, for comparison purposes.
+func (r DomainRole) rank() int {
+	switch r {
+	case DomainRoleMember:
+		return 1
+	case DomainRoleAuthority:
+		return 2
+	case DomainRoleRootAuthority:
+		return 3
+	}
+	return 0
+}
+
+// Satisfies indicates if the role has at least the privileges of the required role, considering that an authority
+// has the privileges of a member and a root authority has the privileges of an authority.
+func (r DomainRole) Satisfies(required DomainRole) bool {
+	return r.rank() >= required.rank()
+}
+
 // AuthenticationResult represents the result of a session authentication.
 type AuthenticationResult struct {
 	Role      DomainRole
@@ -225,11 +283,21 @@ func (c *ServerChannel) EstablishSession(
 
 	if ses.ID != "" {
 		return c.FailSession(ctx, &Reason{
-			Code:        1,
+			Code:        ReasonCodeSessionError,
 			Description: "Invalid session id",
 		})
 	}
 
+	if c.validateSessionID != nil {
+		if err := c.validateSessionID(ctx, c.sessionID); err != nil {
+			var reasonErr *ReasonError
+			if !errors.As(err, &reasonErr) || reasonErr.Reason == nil {
+				reasonErr = NewReasonError(ReasonCodeSessionError, "Invalid session id")
+			}
+			return c.FailSession(ctx, reasonErr.Reason)
+		}
+	}
+
 	if ses.State == SessionStateNew {
 		// Check if there's any transport negotiation option to be presented to the client
 		negCompOpts := make([]SessionCompression, 0)
@@ -262,7 +330,7 @@ func (c *ServerChannel) EstablishSession(
 	// If the channel state is not final at this point, fail the session
 	if c.state != SessionStateEstablished && c.state != SessionStateFailed && c.transport.Connected() {
 		return c.FailSession(ctx, &Reason{
-			Code:        1,
+			Code:        ReasonCodeSessionError,
 			Description: "The session establishment failed",
 		})
 	}
@@ -278,7 +346,7 @@ func (c *ServerChannel) negotiateSession(ctx context.Context, compOpts []Session
 
 	if ses.ID != c.sessionID {
 		return c.FailSession(ctx, &Reason{
-			Code:        1,
+			Code:        ReasonCodeSessionError,
 			Description: "Invalid session id",
 		})
 	}
@@ -293,6 +361,15 @@ func (c *ServerChannel) negotiateSession(ctx context.Context, compOpts []Session
 		encryptOptsMap[v] = struct{}{}
 	}
 
+	// The client may send back a set of supported options instead of a single one,
+	// so the server's most preferred mutually supported option is selected.
+	if ses.Compression == "" {
+		ses.Compression = selectCompression(compOpts, ses.CompressionOptions)
+	}
+	if ses.Encryption == "" {
+		ses.Encryption = selectEncryption(encryptOpts, ses.EncryptionOptions)
+	}
+
 	if ses.State == SessionStateNegotiating && ses.Compression != "" && ses.Encryption != "" {
 		if _, ok := compOptsMap[ses.Compression]; ok {
 			if _, ok := encryptOptsMap[ses.Encryption]; ok {
@@ -318,7 +395,7 @@ func (c *ServerChannel) negotiateSession(ctx context.Context, compOpts []Session
 	}
 
 	return c.FailSession(ctx, &Reason{
-		Code:        1,
+		Code:        ReasonCodeSessionNegotiationInvalidOptions,
 		Description: "An invalid negotiation option was selected",
 	})
 }
@@ -328,6 +405,9 @@ func (c *ServerChannel) authenticateSession(
 	schemeOpts []AuthenticationScheme,
 	authenticate func(context.Context, Identity, Authentication) (*AuthenticationResult, error),
 	register func(context.Context, Node, *ServerChannel) (Node, error)) error {
+	// The transport encryption is already negotiated at this point, so the TLS state is available
+	ctx = transportContext(ctx, c.transport)
+
 	// Convert the slice to a map for lookup
 	schemeOptsMap := make(map[AuthenticationScheme]struct{})
 	for _, v := range schemeOpts {
@@ -339,23 +419,28 @@ func (c *ServerChannel) authenticateSession(
 		return err
 	}
 
+	attempts := 0
 	for c.state == SessionStateAuthenticating {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		if ses.State != SessionStateAuthenticating {
 			return c.FailSession(ctx, &Reason{
-				Code:        1,
+				Code:        ReasonCodeSessionInvalidActionForState,
 				Description: "Invalid session state",
 			})
 		}
 
 		if ses.ID != c.sessionID {
 			return c.FailSession(ctx, &Reason{
-				Code:        1,
+				Code:        ReasonCodeSessionError,
 				Description: "Invalid session id",
 			})
 		}
 		if _, ok := schemeOptsMap[ses.Scheme]; !ok {
 			return c.FailSession(ctx, &Reason{
-				Code:        1,
+				Code:        ReasonCodeSessionAuthenticationFailed,
 				Description: "An invalid authentication scheme was selected",
 			})
 		}
@@ -365,6 +450,7 @@ func (c *ServerChannel) authenticateSession(
 		if err != nil {
 			return err
 		}
+		attempts++
 
 		// If the auth result contains the identity domain role, it has succeeded
 		if authResult.Role != "" && authResult.Role != DomainRoleUnknown {
@@ -372,10 +458,18 @@ func (c *ServerChannel) authenticateSession(
 			if err != nil {
 				return err
 			}
+			c.remoteRole = authResult.Role
 
 			if err = c.sendEstablishedSession(ctx, node); err != nil {
 				return err
 			}
+		} else if c.maxAuthAttempts > 0 && attempts >= c.maxAuthAttempts {
+			if err = c.FailSession(ctx, &Reason{
+				Code:        ReasonCodeSessionAuthenticationFailed,
+				Description: "The maximum number of authentication attempts was exceeded",
+			}); err != nil {
+				return err
+			}
 		} else if authResult.RoundTrip != nil {
 			ses, err = c.sendAuthenticatingRoundTripSession(ctx, authResult.RoundTrip)
 			if err != nil {
@@ -384,7 +478,7 @@ func (c *ServerChannel) authenticateSession(
 
 		} else {
 			if err = c.FailSession(ctx, &Reason{
-				Code:        1,
+				Code:        ReasonCodeSessionAuthenticationFailed,
 				Description: "The session authentication failed",
 			}); err != nil {
 				return err
@@ -437,6 +531,7 @@ func (c *ServerChannel) FailSession(ctx context.Context, reason *Reason) error {
 	}
 	err := c.sendSession(ctx, &ses)
 
+	c.failReason = reason
 	c.setState(SessionStateFailed)
 
 	if err == nil {
@@ -448,6 +543,24 @@ func (c *ServerChannel) FailSession(ctx context.Context, reason *Reason) error {
 	return err
 }
 
+// selectCompression returns the first option from the server preference ordered options that is supported by the
+// client, or an empty value if there's none.
+func selectCompression(serverOpts []SessionCompression, clientOpts []SessionCompression) SessionCompression {
+	if opts := intersect(serverOpts, clientOpts); len(opts) > 0 {
+		return opts[0].(SessionCompression)
+	}
+	return ""
+}
+
+// selectEncryption returns the first option from the server preference ordered options that is supported by the
+// client, or an empty value if there's none.
+func selectEncryption(serverOpts []SessionEncryption, clientOpts []SessionEncryption) SessionEncryption {
+	if opts := intersect(serverOpts, clientOpts); len(opts) > 0 {
+		return opts[0].(SessionEncryption)
+	}
+	return ""
+}
+
 // Source: https://github.com/juliangruber/go-intersect
 func intersect(a interface{}, b interface{}) []interface{} {
 	set := make([]interface{}, 0)
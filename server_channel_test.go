@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
 	"testing"
 	"time"
 )
@@ -66,11 +67,148 @@ func TestServerChannel_EstablishSession_WhenGuest(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, serverNode, c.LocalNode())
 	assert.Equal(t, clientNode, c.RemoteNode())
+	assert.Equal(t, DomainRoleMember, c.DomainRole())
 	assert.Equal(t, SessionStateEstablished, c.state)
 	assert.True(t, c.Established())
 	assert.True(t, c.transport.Connected())
 }
 
+func TestServerChannel_EstablishSession_WhenSessionIDRejected(t *testing.T) {
+	// Arrange
+	client, server := newInProcessTransportPair("localhost", 1)
+	sessionID := "52e59849-19a8-4b2d-86b7-3fa563cdb616"
+	serverNode := Node{
+		Identity: Identity{Name: "postmaster", Domain: "limeprotocol.org"},
+		Instance: "server1",
+	}
+	c := NewServerChannel(server, 1, serverNode, sessionID)
+	defer silentClose(c)
+	blacklist := map[string]bool{sessionID: true}
+	c.validateSessionID = func(_ context.Context, id string) error {
+		if blacklist[id] {
+			return NewReasonError(ReasonCodeSessionError, "Blacklisted session id")
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	sessionChan := make(chan *Session, 1)
+
+	// Act
+	go func() {
+		if err := client.Send(ctx, &Session{State: SessionStateNew}); err != nil {
+			return
+		}
+		env, err := client.Receive(ctx)
+		if err != nil {
+			return
+		}
+		if s, ok := env.(*Session); ok {
+			sessionChan <- s
+		}
+	}()
+	err := c.EstablishSession(
+		ctx,
+		[]SessionCompression{SessionCompressionNone},
+		[]SessionEncryption{SessionEncryptionNone},
+		[]AuthenticationScheme{AuthenticationSchemeGuest},
+		func(context.Context, Identity, Authentication) (*AuthenticationResult, error) {
+			return &AuthenticationResult{Role: DomainRoleMember}, nil
+		},
+		func(_ context.Context, n Node, _ *ServerChannel) (Node, error) {
+			return n, nil
+		},
+	)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, SessionStateFailed, c.state)
+	assert.False(t, c.Established())
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive session timeout")
+	case ses := <-sessionChan:
+		assert.Equal(t, SessionStateFailed, ses.State)
+		assert.Equal(t, sessionID, ses.ID)
+		assert.Equal(t, &Reason{Code: ReasonCodeSessionError, Description: "Blacklisted session id"}, ses.Reason)
+	}
+}
+
+func TestServerChannel_EstablishSession_WhenMaxAuthAttemptsExceeded(t *testing.T) {
+	// Arrange
+	client, server := newInProcessTransportPair("localhost", 1)
+	sessionID := "52e59849-19a8-4b2d-86b7-3fa563cdb616"
+	serverNode := Node{
+		Identity: Identity{Name: "postmaster", Domain: "limeprotocol.org"},
+		Instance: "server1",
+	}
+	c := NewServerChannel(server, 1, serverNode, sessionID)
+	defer silentClose(c)
+	c.maxAuthAttempts = 3
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	clientNode := Node{
+		Identity: Identity{Name: "golang", Domain: "limeprotocol.org"},
+		Instance: "home",
+	}
+	authCount := 0
+	sessionChan := make(chan *Session, 1)
+
+	// Act
+	go func() {
+		if err := client.Send(ctx, &Session{State: SessionStateNew}); err != nil {
+			return
+		}
+		for {
+			env, err := client.Receive(ctx)
+			if err != nil {
+				return
+			}
+			s, ok := env.(*Session)
+			if !ok {
+				return
+			}
+			if s.State != SessionStateAuthenticating {
+				sessionChan <- s
+				return
+			}
+			authSes := &Session{
+				Envelope: Envelope{ID: s.ID, From: clientNode},
+				State:    SessionStateAuthenticating,
+			}
+			authSes.SetAuthentication(&PlainAuthentication{Password: "d3JvbmcgcGFzc3dvcmQ="})
+			if err := client.Send(ctx, authSes); err != nil {
+				return
+			}
+		}
+	}()
+	err := c.EstablishSession(
+		ctx,
+		[]SessionCompression{SessionCompressionNone},
+		[]SessionEncryption{SessionEncryptionNone},
+		[]AuthenticationScheme{AuthenticationSchemePlain},
+		func(context.Context, Identity, Authentication) (*AuthenticationResult, error) {
+			authCount++
+			return &AuthenticationResult{Role: DomainRoleUnknown, RoundTrip: &PlainAuthentication{}}, nil
+		},
+		func(_ context.Context, n Node, _ *ServerChannel) (Node, error) {
+			return n, nil
+		},
+	)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 3, authCount)
+	assert.Equal(t, SessionStateFailed, c.state)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive session timeout")
+	case ses := <-sessionChan:
+		assert.Equal(t, SessionStateFailed, ses.State)
+		assert.Equal(t, ReasonCodeSessionAuthenticationFailed, ses.Reason.Code)
+	}
+}
+
 func TestServerChannel_FinishSession(t *testing.T) {
 	// Arrange
 	client, server := newInProcessTransportPair("localhost", 1)
@@ -179,3 +317,136 @@ func TestServerChannel_FailSession(t *testing.T) {
 	assert.Equal(t, SessionStateFailed, s.State)
 	assert.Equal(t, r, s.Reason)
 }
+
+func TestSelectCompression_ServerPreference(t *testing.T) {
+	// Act
+	comp1 := selectCompression(
+		[]SessionCompression{SessionCompressionGzip, SessionCompressionNone},
+		[]SessionCompression{SessionCompressionNone, SessionCompressionGzip})
+	comp2 := selectCompression(
+		[]SessionCompression{SessionCompressionGzip, SessionCompressionNone},
+		[]SessionCompression{SessionCompressionNone})
+	comp3 := selectCompression(
+		[]SessionCompression{SessionCompressionGzip},
+		[]SessionCompression{SessionCompressionNone})
+
+	// Assert
+	assert.Equal(t, SessionCompressionGzip, comp1)
+	assert.Equal(t, SessionCompressionNone, comp2)
+	assert.Equal(t, SessionCompression(""), comp3)
+}
+
+func TestServerChannel_NegotiateSession_WhenClientSendsOptions(t *testing.T) {
+	// Arrange
+	client, server := newInProcessTransportPair("localhost", 1)
+	sessionID := "52e59849-19a8-4b2d-86b7-3fa563cdb616"
+	serverNode := Node{
+		Identity: Identity{Name: "postmaster", Domain: "limeprotocol.org"},
+		Instance: "server1",
+	}
+	c := NewServerChannel(server, 1, serverNode, sessionID)
+	defer silentClose(c)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	sesChan := make(chan *Session, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			env, err := client.Receive(ctx)
+			if err != nil {
+				return
+			}
+			s := env.(*Session)
+			sesChan <- s
+			if i == 0 {
+				_ = client.Send(ctx, &Session{
+					Envelope:           Envelope{ID: s.ID},
+					State:              SessionStateNegotiating,
+					CompressionOptions: []SessionCompression{SessionCompressionGzip, SessionCompressionNone},
+					EncryptionOptions:  []SessionEncryption{SessionEncryptionTLS, SessionEncryptionNone},
+				})
+			}
+		}
+	}()
+
+	// Act
+	err := c.negotiateSession(
+		ctx,
+		[]SessionCompression{SessionCompressionNone, SessionCompressionGzip},
+		[]SessionEncryption{SessionEncryptionNone, SessionEncryptionTLS})
+
+	// Assert
+	assert.NoError(t, err)
+	options := <-sesChan
+	assert.Equal(t, []SessionCompression{SessionCompressionNone, SessionCompressionGzip}, options.CompressionOptions)
+	assert.Equal(t, []SessionEncryption{SessionEncryptionNone, SessionEncryptionTLS}, options.EncryptionOptions)
+	confirmation := <-sesChan
+	assert.Equal(t, SessionStateNegotiating, confirmation.State)
+	assert.Equal(t, SessionCompressionNone, confirmation.Compression)
+	assert.Equal(t, SessionEncryptionNone, confirmation.Encryption)
+}
+
+func TestServerChannel_WatchState_WhenEstablishing(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	client, server := newInProcessTransportPair("localhost", 1)
+	sessionID := "52e59849-19a8-4b2d-86b7-3fa563cdb616"
+	serverNode := Node{
+		Identity: Identity{Name: "postmaster", Domain: "limeprotocol.org"},
+		Instance: "server1",
+	}
+	c := NewServerChannel(server, 1, serverNode, sessionID)
+	defer silentClose(c)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	clientNode := Node{
+		Identity: Identity{Name: "golang", Domain: "limeprotocol.org"},
+		Instance: "home",
+	}
+	var states []SessionState
+	c.WatchState(func(state SessionState) {
+		states = append(states, state)
+	})
+	go func() {
+		err := client.Send(ctx, &Session{
+			State: SessionStateNew,
+		})
+		if err != nil {
+			return
+		}
+		env, err := client.Receive(ctx)
+		if err != nil {
+			return
+		}
+		s, ok := env.(*Session)
+		if !ok {
+			return
+		}
+		_ = client.Send(ctx, &Session{
+			Envelope:       Envelope{ID: s.ID, From: clientNode},
+			State:          SessionStateAuthenticating,
+			Scheme:         AuthenticationSchemeGuest,
+			Authentication: &GuestAuthentication{},
+		})
+	}()
+
+	// Act
+	err := c.EstablishSession(
+		ctx,
+		[]SessionCompression{SessionCompressionNone},
+		[]SessionEncryption{SessionEncryptionNone},
+		[]AuthenticationScheme{AuthenticationSchemeGuest},
+		func(context.Context, Identity, Authentication) (*AuthenticationResult, error) {
+			return &AuthenticationResult{Role: DomainRoleMember}, nil
+		},
+		func(context.Context, Node, *ServerChannel) (Node, error) {
+			return clientNode, nil
+		},
+	)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]SessionState{SessionStateAuthenticating, SessionStateEstablished},
+		states)
+}
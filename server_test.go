@@ -2,11 +2,16 @@ package lime
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/goleak"
 	"golang.org/x/sync/errgroup"
 	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -79,6 +84,73 @@ func TestServer_ListenAndServe_WithMultipleListeners(t *testing.T) {
 	assert.Error(t, eg.Wait(), ErrServerClosed)
 }
 
+func TestServer_ListenAndServe_WithNamedListeners(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost1")
+	addr2 := InProcessAddr("localhost2")
+	namesChan := make(chan string, 2)
+	srv := NewServerBuilder().
+		Listen(NewNamedBoundListener("public", NewInProcessTransportListener(addr1), addr1)).
+		Listen(NewNamedBoundListener("internal", NewInProcessTransportListener(addr2), addr2)).
+		EnableGuestAuthentication().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			name, _ := ContextListenerName(ctx)
+			namesChan <- name
+			return nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+
+	for _, tc := range []struct {
+		addr InProcessAddr
+		name string
+	}{{addr1, "public"}, {addr2, "internal"}} {
+		client, _ := DialInProcess(tc.addr, 1)
+		channel := NewClientChannel(client, 1)
+		_, _ = channel.EstablishSession(
+			ctx,
+			func([]SessionCompression) SessionCompression {
+				return SessionCompressionNone
+			},
+			func([]SessionEncryption) SessionEncryption {
+				return SessionEncryptionNone
+			},
+			Identity{
+				Name:   NewEnvelopeID(),
+				Domain: "localhost",
+			},
+			func([]AuthenticationScheme, Authentication) Authentication {
+				return &GuestAuthentication{}
+			},
+			"default")
+
+		// Act
+		err := channel.SendMessage(ctx, createMessage())
+
+		// Assert
+		assert.NoError(t, err)
+		select {
+		case <-ctx.Done():
+			assert.FailNow(t, "receive message timeout")
+		case name := <-namesChan:
+			assert.Equal(t, tc.name, name)
+		}
+		silentClose(channel)
+		silentClose(client)
+	}
+}
+
 func TestServer_ListenAndServe_EstablishSession(t *testing.T) {
 	// Arrange
 	defer goleak.VerifyNone(t)
@@ -197,3 +269,1686 @@ func TestServerBuilder_Build(t *testing.T) {
 	//builder := NewServerBuilder().
 
 }
+
+func TestServerBuilder_Established_SendWelcomeMessage(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	welcome := createMessage()
+	welcome.SetNewEnvelopeID()
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Established(func(sessionID string, c *ServerChannel) {
+			msg := *welcome
+			msg.To = c.RemoteNode()
+			_ = c.SendMessage(context.Background(), &msg)
+		}).
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			echo := *msg
+			echo.From = Node{}
+			echo.To = msg.From
+			return s.SendMessage(ctx, &echo)
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client, _ := DialInProcess(addr1, 1)
+	defer silentClose(client)
+	channel := NewClientChannel(client, 2)
+	defer silentClose(channel)
+	_, _ = channel.EstablishSession(
+		ctx,
+		func([]SessionCompression) SessionCompression {
+			return SessionCompressionNone
+		},
+		func([]SessionEncryption) SessionEncryption {
+			return SessionEncryptionNone
+		},
+		Identity{
+			Name:   NewEnvelopeID(),
+			Domain: "localhost",
+		},
+		func([]AuthenticationScheme, Authentication) Authentication {
+			return &GuestAuthentication{}
+		},
+		"default")
+	msg := createMessage()
+
+	// Act
+	err := channel.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	for _, id := range []string{welcome.ID, msg.ID} {
+		select {
+		case <-ctx.Done():
+			assert.FailNow(t, "receive message timeout")
+		case actual := <-channel.MsgChan():
+			assert.Equal(t, id, actual.ID)
+		}
+	}
+}
+
+func TestServer_ListenAndServe_FinishSession(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client, _ := DialInProcess(addr1, 1)
+	defer silentClose(client)
+	channel := NewClientChannel(client, 1)
+	defer silentClose(channel)
+	established, _ := channel.EstablishSession(
+		ctx,
+		func([]SessionCompression) SessionCompression {
+			return SessionCompressionNone
+		},
+		func([]SessionEncryption) SessionEncryption {
+			return SessionEncryptionNone
+		},
+		Identity{
+			Name:   NewEnvelopeID(),
+			Domain: "localhost",
+		},
+		func([]AuthenticationScheme, Authentication) Authentication {
+			return &GuestAuthentication{}
+		},
+		"default")
+
+	// Act
+	ses, err := channel.FinishSession(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, established.ID, ses.ID)
+	assert.Equal(t, SessionStateFinished, ses.State)
+	assert.Equal(t, SessionStateFinished, channel.State())
+	assert.False(t, channel.Established())
+	assert.False(t, client.Connected())
+}
+
+func TestServer_ListenAndServe_WhenUnexpectedSessionState(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client, _ := DialInProcess(addr1, 1)
+	defer silentClose(client)
+	channel := NewClientChannel(client, 1)
+	defer silentClose(channel)
+	established, _ := channel.EstablishSession(
+		ctx,
+		func([]SessionCompression) SessionCompression {
+			return SessionCompressionNone
+		},
+		func([]SessionEncryption) SessionEncryption {
+			return SessionEncryptionNone
+		},
+		Identity{
+			Name:   NewEnvelopeID(),
+			Domain: "localhost",
+		},
+		func([]AuthenticationScheme, Authentication) Authentication {
+			return &GuestAuthentication{}
+		},
+		"default")
+
+	// Act
+	err := channel.SendSession(ctx, &Session{Envelope: Envelope{ID: established.ID}, State: SessionStateNew})
+
+	// Assert
+	assert.NoError(t, err)
+	ses, err := channel.ReceiveSession(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, SessionStateFailed, ses.State)
+	if assert.NotNil(t, ses.Reason) {
+		assert.Equal(t, ReasonCodeSessionInvalidActionForState, ses.Reason.Code)
+	}
+}
+
+func TestServerBuilder_SessionHandler_WhenClientFinishes(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	sesChan := make(chan *Session, 1)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		SessionHandler(func(ctx context.Context, ses *Session, c *ServerChannel) error {
+			sesChan <- ses
+			return c.FinishSession(ctx)
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client, _ := DialInProcess(addr1, 1)
+	defer silentClose(client)
+	channel := NewClientChannel(client, 1)
+	defer silentClose(channel)
+	established, _ := channel.EstablishSession(
+		ctx,
+		func([]SessionCompression) SessionCompression {
+			return SessionCompressionNone
+		},
+		func([]SessionEncryption) SessionEncryption {
+			return SessionEncryptionNone
+		},
+		Identity{
+			Name:   NewEnvelopeID(),
+			Domain: "localhost",
+		},
+		func([]AuthenticationScheme, Authentication) Authentication {
+			return &GuestAuthentication{}
+		},
+		"default")
+
+	// Act
+	ses, err := channel.FinishSession(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, SessionStateFinished, ses.State)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "session handler timeout")
+	case received := <-sesChan:
+		assert.Equal(t, established.ID, received.ID)
+		assert.Equal(t, SessionStateFinishing, received.State)
+	}
+}
+
+func TestServerBuilder_Finished_WhenClientFinishes(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	type finishedArgs struct {
+		sessionID string
+		reason    *Reason
+		err       error
+	}
+	finishedChan := make(chan finishedArgs, 1)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Finished(func(sessionID string, reason *Reason, err error) {
+			finishedChan <- finishedArgs{sessionID, reason, err}
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client, _ := DialInProcess(addr1, 1)
+	defer silentClose(client)
+	channel := NewClientChannel(client, 1)
+	defer silentClose(channel)
+	ses, _ := channel.EstablishSession(
+		ctx,
+		func([]SessionCompression) SessionCompression {
+			return SessionCompressionNone
+		},
+		func([]SessionEncryption) SessionEncryption {
+			return SessionEncryptionNone
+		},
+		Identity{
+			Name:   NewEnvelopeID(),
+			Domain: "localhost",
+		},
+		func([]AuthenticationScheme, Authentication) Authentication {
+			return &GuestAuthentication{}
+		},
+		"default")
+
+	// Act
+	_, err := channel.FinishSession(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "finished timeout")
+	case args := <-finishedChan:
+		assert.Equal(t, ses.ID, args.sessionID)
+		assert.Nil(t, args.reason)
+		assert.NoError(t, args.err)
+	}
+}
+
+func TestServerBuilder_Finished_WhenTransportFails(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	type finishedArgs struct {
+		sessionID string
+		reason    *Reason
+		err       error
+	}
+	finishedChan := make(chan finishedArgs, 1)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Finished(func(sessionID string, reason *Reason, err error) {
+			finishedChan <- finishedArgs{sessionID, reason, err}
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client, _ := DialInProcess(addr1, 1)
+	defer silentClose(client)
+	channel := NewClientChannel(client, 1)
+	defer silentClose(channel)
+	ses, _ := channel.EstablishSession(
+		ctx,
+		func([]SessionCompression) SessionCompression {
+			return SessionCompressionNone
+		},
+		func([]SessionEncryption) SessionEncryption {
+			return SessionEncryptionNone
+		},
+		Identity{
+			Name:   NewEnvelopeID(),
+			Domain: "localhost",
+		},
+		func([]AuthenticationScheme, Authentication) Authentication {
+			return &GuestAuthentication{}
+		},
+		"default")
+
+	// Act
+	err := client.Close()
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "finished timeout")
+	case args := <-finishedChan:
+		assert.Equal(t, ses.ID, args.sessionID)
+		assert.Nil(t, args.reason)
+		assert.Error(t, args.err)
+	}
+}
+
+func TestServerBuilder_AutoNotifyReceived(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	msgChan := make(chan *Message, 2)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		AutoNotifyReceived().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			msgChan <- msg
+			return nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client, _ := DialInProcess(addr1, 1)
+	defer silentClose(client)
+	channel := NewClientChannel(client, 1)
+	defer silentClose(channel)
+	_, _ = channel.EstablishSession(
+		ctx,
+		func([]SessionCompression) SessionCompression {
+			return SessionCompressionNone
+		},
+		func([]SessionEncryption) SessionEncryption {
+			return SessionEncryptionNone
+		},
+		Identity{
+			Name:   NewEnvelopeID(),
+			Domain: "localhost",
+		},
+		func([]AuthenticationScheme, Authentication) Authentication {
+			return &GuestAuthentication{}
+		},
+		"default")
+	msg1 := createMessage()
+	msg2 := createMessage()
+	msg2.SetNewEnvelopeID()
+
+	// Act
+	err1 := channel.SendMessage(ctx, msg1)
+	err2 := channel.SendMessage(ctx, msg2)
+
+	// Assert
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	for _, msg := range []*Message{msg1, msg2} {
+		var not *Notification
+		select {
+		case <-ctx.Done():
+			assert.FailNow(t, "receive notification timeout")
+		case not = <-channel.NotChan():
+		}
+		assert.Equal(t, msg.ID, not.ID)
+		assert.Equal(t, NotificationEventReceived, not.Event)
+		receivedMsg := <-msgChan
+		assert.Equal(t, msg.ID, receivedMsg.ID)
+	}
+}
+
+func TestServerBuilder_AutoNotifyReceived_IgnoreMessagesWithoutID(t *testing.T) {
+	// Arrange
+	called := false
+	b := NewServerBuilder().
+		AutoNotifyReceived().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			called = true
+			return nil
+		})
+	msg := createMessage()
+	msg.ID = ""
+
+	// Act
+	err := b.mux.handleMessage(context.Background(), msg, nil)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, called)
+}
+
+func TestServer_OnDuplicateEnvelope(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	dupChan := make(chan string, 2)
+	cmdChan := make(chan *RequestCommand, 3)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		OnDuplicateEnvelope(func(id string) {
+			dupChan <- id
+		}).
+		RequestCommandsHandlerFunc(func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+			cmdChan <- cmd
+			return nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client, _ := DialInProcess(addr1, 1)
+	defer silentClose(client)
+	channel := NewClientChannel(client, 1)
+	defer silentClose(channel)
+	_, _ = channel.EstablishSession(
+		ctx,
+		func([]SessionCompression) SessionCompression {
+			return SessionCompressionNone
+		},
+		func([]SessionEncryption) SessionEncryption {
+			return SessionEncryptionNone
+		},
+		Identity{
+			Name:   NewEnvelopeID(),
+			Domain: "localhost",
+		},
+		func([]AuthenticationScheme, Authentication) Authentication {
+			return &GuestAuthentication{}
+		},
+		"default")
+	cmd := createGetPingCommand()
+	otherCmd := createGetPingCommand()
+	otherCmd.SetNewEnvelopeID()
+
+	// Act
+	_ = channel.SendRequestCommand(ctx, cmd)
+	_ = channel.SendRequestCommand(ctx, cmd)
+	_ = channel.SendRequestCommand(ctx, otherCmd)
+
+	// Assert
+	for i := 0; i < 3; i++ {
+		select {
+		case <-ctx.Done():
+			assert.FailNow(t, "receive command timeout")
+		case <-cmdChan:
+		}
+	}
+	assert.Len(t, dupChan, 1)
+	assert.Equal(t, cmd.ID, <-dupChan)
+}
+
+func TestServerBuilder_ListenTCPAddr_IPv6(t *testing.T) {
+	// Arrange
+	b := NewServerBuilder()
+
+	// Act
+	b.ListenTCPAddr("[::1]:0", nil)
+
+	// Assert
+	if assert.Len(t, b.listeners, 1) {
+		addr := b.listeners[0].Addr.(*net.TCPAddr)
+		assert.True(t, addr.IP.Equal(net.IPv6loopback))
+		assert.Equal(t, 0, addr.Port)
+		listener := b.listeners[0].Listener
+		assert.NoError(t, listener.Listen(context.Background(), addr))
+		assert.NoError(t, listener.Close())
+	}
+}
+
+func TestServerBuilder_ListenWebsocketAddr_Hostname(t *testing.T) {
+	// Arrange
+	b := NewServerBuilder()
+
+	// Act
+	b.ListenWebsocketAddr("localhost:8080", nil)
+
+	// Assert
+	if assert.Len(t, b.listeners, 1) {
+		addr := b.listeners[0].Addr.(*net.TCPAddr)
+		assert.True(t, addr.IP.IsLoopback())
+		assert.Equal(t, 8080, addr.Port)
+	}
+}
+
+func TestServerBuilder_ListenTCPAddr_Invalid(t *testing.T) {
+	// Arrange
+	b := NewServerBuilder()
+
+	// Act / Assert
+	assert.Panics(t, func() {
+		b.ListenTCPAddr("localhost", nil)
+	})
+}
+
+func TestServer_Addrs_WhenListeningOnPortZero(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	srv := NewServerBuilder().
+		ListenTCPAddr("127.0.0.1:0", nil).
+		ListenWebsocketAddr("127.0.0.1:0", nil).
+		Build()
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+
+	// Act
+	addrs := srv.Addrs()
+
+	// Assert
+	if assert.Len(t, addrs, 2) {
+		for _, addr := range addrs {
+			assert.NotZero(t, addr.(*net.TCPAddr).Port)
+		}
+	}
+	assert.NoError(t, srv.Close())
+	assert.ErrorIs(t, eg.Wait(), ErrServerClosed)
+}
+
+func TestServer_Register_WithServerName(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	addr1 := createLocalhostTCPAddress().(*net.TCPAddr)
+	domains := map[string]string{
+		"chat.example.com":  "chat.example.com",
+		"admin.example.com": "admin.example.com",
+	}
+	helloChan := make(chan string, len(domains))
+	srv := NewServerBuilder().
+		ListenTCP(addr1, &TCPConfig{
+			TLSConfig: &tls.Config{
+				GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+					return createCertificate(info.ServerName)
+				},
+			},
+			OnClientHello: func(info *tls.ClientHelloInfo) {
+				helloChan <- info.ServerName
+			},
+		}).
+		EnableGuestAuthentication().
+		Register(func(ctx context.Context, candidate Node, c *ServerChannel) (Node, error) {
+			return Node{
+				Identity: Identity{Name: candidate.Name, Domain: domains[c.ServerName()]},
+				Instance: candidate.Instance,
+			}, nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+
+	for serverName, domain := range domains {
+		client, err := DialTcp(ctx, addr1, &TCPConfig{TLSConfig: &tls.Config{ServerName: serverName, InsecureSkipVerify: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		channel := NewClientChannel(client, 1)
+
+		// Act
+		ses, err := channel.EstablishSession(
+			ctx,
+			func([]SessionCompression) SessionCompression {
+				return SessionCompressionNone
+			},
+			func([]SessionEncryption) SessionEncryption {
+				return SessionEncryptionTLS
+			},
+			Identity{
+				Name:   NewEnvelopeID(),
+				Domain: "localhost",
+			},
+			func([]AuthenticationScheme, Authentication) Authentication {
+				return &GuestAuthentication{}
+			},
+			"default")
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, SessionStateEstablished, ses.State)
+		assert.Equal(t, domain, channel.LocalNode().Domain)
+		select {
+		case <-ctx.Done():
+			assert.FailNow(t, "client hello timeout")
+		case hello := <-helloChan:
+			assert.Equal(t, serverName, hello)
+		}
+		_, _ = channel.FinishSession(ctx)
+		silentClose(channel)
+	}
+}
+
+func TestServer_ListenAndServe_AuthenticateWithRemoteAddr(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	addr1 := createLocalhostTCPAddress().(*net.TCPAddr)
+	srv := NewServerBuilder().
+		ListenTCP(addr1, &TCPConfig{
+			TLSConfig: &tls.Config{
+				GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+					return createCertificate("127.0.0.1")
+				},
+			},
+		}).
+		EnableGuestAuthentication().
+		Build()
+	defer silentClose(srv)
+	deniedIP := net.IPv4(127, 0, 0, 1)
+	var remoteAddr net.Addr
+	var tlsState *tls.ConnectionState
+	authenticate := srv.config.Authenticate
+	srv.config.Authenticate = func(ctx context.Context, identity Identity, a Authentication) (*AuthenticationResult, error) {
+		remoteAddr, _ = ContextRemoteAddr(ctx)
+		tlsState, _ = ContextTLSConnectionState(ctx)
+		if addr, ok := remoteAddr.(*net.TCPAddr); ok && addr.IP.Equal(deniedIP) {
+			return &AuthenticationResult{Role: DomainRoleUnknown}, nil
+		}
+		return authenticate(ctx, identity, a)
+	}
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client := createClientTCPTransportTLS(t, addr1)
+	defer silentClose(client)
+	channel := NewClientChannel(client, 1)
+	defer silentClose(channel)
+
+	// Act
+	ses, err := channel.EstablishSession(
+		ctx,
+		func([]SessionCompression) SessionCompression {
+			return SessionCompressionNone
+		},
+		func([]SessionEncryption) SessionEncryption {
+			return SessionEncryptionTLS
+		},
+		Identity{
+			Name:   NewEnvelopeID(),
+			Domain: "localhost",
+		},
+		func([]AuthenticationScheme, Authentication) Authentication {
+			return &GuestAuthentication{}
+		},
+		"default")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, SessionStateFailed, ses.State)
+	if assert.IsType(t, &net.TCPAddr{}, remoteAddr) {
+		assert.True(t, deniedIP.Equal(remoteAddr.(*net.TCPAddr).IP))
+	}
+	if assert.NotNil(t, tlsState) {
+		assert.True(t, tlsState.HandshakeComplete)
+	}
+}
+
+func TestServer_ListenAndServe_EstablishTimeout(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		EstablishTimeout(50 * time.Millisecond).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client, _ := DialInProcess(addr1, 1)
+	defer silentClose(client)
+
+	// Act
+	env, err := client.Receive(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.IsType(t, &Session{}, env) {
+		ses := env.(*Session)
+		assert.Equal(t, SessionStateFailed, ses.State)
+		assert.Equal(t, ReasonCodeSessionNegotiationTimeout, ses.Reason.Code)
+	}
+	_, err = client.Receive(ctx)
+	assert.Error(t, err)
+	assert.NoError(t, ctx.Err())
+}
+
+func TestServer_ListenAndServe_MaxConcurrentHandshakes(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		MaxConcurrentHandshakes(2).
+		Build()
+	defer silentClose(srv)
+	var inFlight, maxInFlight int32
+	authenticate := srv.config.Authenticate
+	srv.config.Authenticate = func(ctx context.Context, identity Identity, a Authentication) (*AuthenticationResult, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return authenticate(ctx, identity, a)
+	}
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	var channels []*ClientChannel
+	for i := 0; i < 8; i++ {
+		client, err := DialInProcess(addr1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		channel := NewClientChannel(client, 1)
+		defer silentClose(channel)
+		channels = append(channels, channel)
+	}
+
+	// Act
+	clientEg, _ := errgroup.WithContext(ctx)
+	for _, c := range channels {
+		channel := c
+		clientEg.Go(func() error {
+			_, err := channel.EstablishSession(
+				ctx,
+				NoneCompressionSelector,
+				NoneEncryptionSelector,
+				Identity{Name: NewEnvelopeID(), Domain: "localhost"},
+				GuestAuthenticator,
+				"default",
+			)
+			return err
+		})
+	}
+	err := clientEg.Wait()
+
+	// Assert
+	assert.NoError(t, err)
+	for _, c := range channels {
+		assert.True(t, c.Established())
+	}
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(2))
+	assert.Greater(t, atomic.LoadInt32(&maxInFlight), int32(0))
+}
+
+func TestServerBuilder_MessageHandlers(t *testing.T) {
+	// Arrange
+	h1 := &messageHandler{handlerFunc: func(context.Context, *Message, Sender) error { return nil }}
+	h2 := &messageHandler{handlerFunc: func(context.Context, *Message, Sender) error { return nil }}
+	h3 := &messageHandler{handlerFunc: func(context.Context, *Message, Sender) error { return nil }}
+	b := NewServerBuilder().MessagesHandlerFunc(func(context.Context, *Message, Sender) error { return nil })
+
+	// Act
+	b.MessageHandlers([]MessageHandler{h1, h2, h3})
+
+	// Assert
+	if assert.Len(t, b.mux.msgHandlers, 4) {
+		assert.Same(t, h1, b.mux.msgHandlers[1])
+		assert.Same(t, h2, b.mux.msgHandlers[2])
+		assert.Same(t, h3, b.mux.msgHandlers[3])
+	}
+}
+
+func TestServerBuilder_RequestCommandRoutes(t *testing.T) {
+	// Arrange
+	var handled []string
+	handlerFunc := func(name string) RequestCommandHandlerFunc {
+		return func(context.Context, *RequestCommand, Sender) error {
+			handled = append(handled, name)
+			return nil
+		}
+	}
+	b := NewServerBuilder()
+
+	// Act
+	b.RequestCommandRoutes(map[string]RequestCommandHandlerFunc{
+		"get /friends/{nickname}": handlerFunc("get friend"),
+		"get /friends/me":         handlerFunc("get me"),
+		"GET /friends":            handlerFunc("get friends"),
+		"set /friends":            handlerFunc("set friends"),
+	})
+
+	// Assert
+	if !assert.Len(t, b.mux.reqCmdHandlers, 1) {
+		t.FailNow()
+	}
+	router := b.mux.reqCmdHandlers[0].(*commandRouterHandler).router
+	if assert.Len(t, router.routes, 4) {
+		assert.Equal(t, CommandMethodGet, router.routes[0].method)
+		assert.Equal(t, "/friends", router.routes[0].template)
+		assert.Equal(t, CommandMethodGet, router.routes[1].method)
+		assert.Equal(t, "/friends/me", router.routes[1].template)
+		assert.Equal(t, CommandMethodGet, router.routes[2].method)
+		assert.Equal(t, "/friends/{nickname}", router.routes[2].template)
+		assert.Equal(t, CommandMethodSet, router.routes[3].method)
+		assert.Equal(t, "/friends", router.routes[3].template)
+	}
+	for _, uri := range []string{"/friends/me", "/friends/john", "/friends"} {
+		cmd := createGetPingCommand()
+		cmd.SetURIString(uri)
+		err := b.mux.handleRequestCommand(context.Background(), cmd, &senderMock{})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"get me", "get friend", "get friends"}, handled)
+}
+
+func TestServerBuilder_RequestCommandRoutes_InvalidKey(t *testing.T) {
+	// Arrange
+	b := NewServerBuilder()
+	handlerFunc := func(context.Context, *RequestCommand, Sender) error { return nil }
+
+	// Act & Assert
+	assert.Panics(t, func() {
+		b.RequestCommandRoutes(map[string]RequestCommandHandlerFunc{"/friends": handlerFunc})
+	})
+	assert.Panics(t, func() {
+		b.RequestCommandRoutes(map[string]RequestCommandHandlerFunc{"fetch /friends": handlerFunc})
+	})
+}
+
+func TestServer_ListenAndServe_WhenMessageHandlerPanics(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	msgChan := make(chan *Message, 1)
+	var count int32
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			if atomic.AddInt32(&count, 1) == 1 {
+				panic("handler failure")
+			}
+			msgChan <- msg
+			return nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	channel := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(channel)
+	msg1 := createMessage()
+	msg1.ID = NewEnvelopeID()
+	msg2 := createMessage()
+	msg2.ID = NewEnvelopeID()
+
+	// Act
+	err1 := channel.SendMessage(ctx, msg1)
+	err2 := channel.SendMessage(ctx, msg2)
+
+	// Assert
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive message timeout")
+	case actual := <-msgChan:
+		assert.Equal(t, msg2.ID, actual.ID)
+	}
+	assert.True(t, channel.Established())
+}
+
+func TestServer_ListenAndServe_WhenRequestCommandHandlerPanics(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		RequestCommandHandlerFunc(
+			func(cmd *RequestCommand) bool {
+				return true
+			},
+			func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+				panic("handler failure")
+			}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	channel := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(channel)
+	cmd := createGetPingCommand()
+
+	// Act
+	respCmd, err := channel.ProcessCommand(ctx, cmd)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.NotNil(t, respCmd) {
+		assert.Equal(t, cmd.ID, respCmd.ID)
+		assert.Equal(t, CommandStatusFailure, respCmd.Status)
+		if assert.NotNil(t, respCmd.Reason) {
+			assert.Equal(t, ReasonCodeCommandProcessingError, respCmd.Reason.Code)
+		}
+	}
+	assert.True(t, channel.Established())
+}
+
+func TestServerBuilder_DeadLetter_WhenDestinationIsUnknown(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	deadChan := make(chan *Message, 1)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			// No session is registered for the destination
+			return fmt.Errorf("deliver message to '%v': %w", msg.To, ErrRouteNotFound)
+		}).
+		DeadLetter(func(ctx context.Context, msg *Message) error {
+			deadChan <- msg
+			return nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	channel := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(channel)
+	msg := createMessage()
+	msg.To = Node{Identity: Identity{Name: "unknown", Domain: "localhost"}}
+
+	// Act
+	err := channel.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "dead letter timeout")
+	case actual := <-deadChan:
+		assert.Equal(t, msg.ID, actual.ID)
+		assert.Equal(t, msg.To, actual.To)
+	}
+	assert.True(t, channel.Established())
+}
+
+func TestServerBuilder_DeadLetter_WhenNoHandlerMatches(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	deadChan := make(chan *Message, 1)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		MessageHandlerFunc(
+			func(msg *Message) bool {
+				return msg.To.Name == "known"
+			},
+			func(ctx context.Context, msg *Message, s Sender) error {
+				return nil
+			}).
+		DeadLetter(func(ctx context.Context, msg *Message) error {
+			deadChan <- msg
+			return nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	channel := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(channel)
+	msg := createMessage()
+	msg.To = Node{Identity: Identity{Name: "unknown", Domain: "localhost"}}
+
+	// Act
+	err := channel.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "dead letter timeout")
+	case actual := <-deadChan:
+		assert.Equal(t, msg.ID, actual.ID)
+	}
+}
+
+func TestServer_Broadcast(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	var srv *Server
+	srv = NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			return srv.Broadcast(ctx, msg)
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	sender := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(sender)
+	client1 := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(client1)
+	client2 := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(client2)
+	msg := createMessage()
+
+	// Act
+	err := sender.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	for _, c := range []*ClientChannel{client1, client2} {
+		select {
+		case <-ctx.Done():
+			assert.FailNow(t, "receive message timeout")
+		case actual := <-c.MsgChan():
+			assert.Equal(t, msg.ID, actual.ID)
+		}
+	}
+	select {
+	case <-sender.MsgChan():
+		assert.Fail(t, "the sender should not receive the message")
+	case <-time.After(16 * time.Millisecond):
+	}
+}
+
+func TestServer_Send(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client1 := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(client1)
+	client2 := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(client2)
+	msg := createMessage()
+	msg.To = client2.LocalNode()
+
+	// Act
+	err := srv.Send(ctx, client2.LocalNode(), msg)
+	unknownErr := srv.Send(ctx, Node{Identity: Identity{Name: "unknown", Domain: "localhost"}}, msg)
+	unsupportedErr := srv.Send(ctx, client2.LocalNode(), &msg.Envelope)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.ErrorIs(t, unknownErr, ErrRouteNotFound)
+	assert.Error(t, unsupportedErr)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive message timeout")
+	case actual := <-client2.MsgChan():
+		assert.Equal(t, msg.ID, actual.ID)
+	}
+	assert.Len(t, client1.MsgChan(), 0)
+}
+
+func TestServerBuilder_ContinueOnSession_WhenClientSendsSession(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	sesChan := make(chan *Session, 1)
+	msgChan := make(chan *Message, 1)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		ContinueOnSession().
+		SessionHandler(func(ctx context.Context, ses *Session, c *ServerChannel) error {
+			sesChan <- ses
+			return nil
+		}).
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			msgChan <- msg
+			return nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	channel := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(channel)
+	msg := createMessage()
+
+	// Act
+	err := channel.SendSession(ctx, &Session{Envelope: Envelope{ID: channel.ID()}, State: SessionStateFinishing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = channel.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "session handler timeout")
+	case received := <-sesChan:
+		assert.Equal(t, channel.ID(), received.ID)
+		assert.Equal(t, SessionStateFinishing, received.State)
+	}
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "message handler timeout")
+	case received := <-msgChan:
+		assert.Equal(t, msg.ID, received.ID)
+	}
+	assert.True(t, channel.Established())
+}
+
+func TestServerBuilder_ContinueOnSession_WhenClientFinishesWithoutHandler(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		ContinueOnSession().
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	channel := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(channel)
+
+	// Act
+	ses, err := channel.FinishSession(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.NotNil(t, ses) {
+		assert.Equal(t, SessionStateFinished, ses.State)
+	}
+}
+
+func TestServerBuilder_Echo(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Echo().
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	msgChan := make(chan *Message, 1)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			msgChan <- msg
+			return nil
+		}).
+		Build()
+	defer silentClose(client)
+	msg := createMessage()
+
+	// Act
+	err := client.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "echo timeout")
+	case echoed := <-msgChan:
+		assert.NotEqual(t, msg.ID, echoed.ID)
+		assert.NotEmpty(t, echoed.ID)
+		assert.Equal(t, msg.Type, echoed.Type)
+		assert.Equal(t, msg.Content, echoed.Content)
+	}
+	resp, err := client.ProcessCommand(ctx, createGetPingCommand())
+	assert.NoError(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, CommandStatusSuccess, resp.Status)
+	}
+}
+
+func TestServerBuilder_ListenUnix(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "lime.sock")
+	msgChan := make(chan *Message, 1)
+	srv := NewServerBuilder().
+		ListenUnix(path, nil).
+		EnableGuestAuthentication().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			msgChan <- msg
+			return nil
+		}).
+		Build()
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client := NewClientBuilder().
+		UseUnix(path, nil).
+		Encryption(SessionEncryptionNone).
+		Build()
+	msg := createMessage()
+
+	// Act
+	err := client.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "message handler timeout")
+	case received := <-msgChan:
+		assert.Equal(t, msg.ID, received.ID)
+	}
+	assert.NoError(t, client.Close())
+	assert.NoError(t, srv.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestServerBuilder_DefaultCommandResponse(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		DefaultCommandResponse().
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		Build()
+	defer silentClose(client)
+
+	// Act
+	resp, err := client.ProcessCommand(ctx, createGetPingCommand())
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, CommandStatusFailure, resp.Status)
+		if assert.NotNil(t, resp.Reason) {
+			assert.Equal(t, ReasonCodeCommandResourceNotSupported, resp.Reason.Code)
+		}
+	}
+}
+
+func TestServer_ContextServerChannel(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	nodeChan := make(chan Node, 1)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		RequestCommandHandlerFunc(
+			func(cmd *RequestCommand) bool {
+				return true
+			},
+			func(ctx context.Context, cmd *RequestCommand, s Sender) error {
+				c, ok := ContextServerChannel(ctx)
+				if !ok {
+					return errors.New("server channel not found in the context")
+				}
+				nodeChan <- c.RemoteNode()
+				return s.SendResponseCommand(ctx, cmd.SuccessResponse())
+			}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		Build()
+	defer silentClose(client)
+
+	// Act
+	resp, err := client.ProcessCommand(ctx, createGetPingCommand())
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, CommandStatusSuccess, resp.Status)
+	}
+	channel, _ := client.Channel()
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "remote node timeout")
+	case node := <-nodeChan:
+		assert.Equal(t, channel.LocalNode(), node)
+	}
+}
+
+func TestServer_ContextReceivedAt(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	type timestamps struct {
+		receivedAt time.Time
+		ok         bool
+		handledAt  time.Time
+	}
+	tsChan := make(chan timestamps, 1)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			handledAt := time.Now()
+			receivedAt, ok := ContextReceivedAt(ctx)
+			tsChan <- timestamps{receivedAt, ok, handledAt}
+			return nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client := NewClientBuilder().
+		UseInProcess(addr1, 1).
+		Build()
+	defer silentClose(client)
+	err := client.Establish(ctx)
+	assert.NoError(t, err)
+	sentAt := time.Now()
+
+	// Act
+	err = client.SendMessage(ctx, createMessage())
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "handler timeout")
+	case ts := <-tsChan:
+		assert.True(t, ts.ok)
+		assert.False(t, ts.receivedAt.Before(sentAt))
+		assert.False(t, ts.receivedAt.After(ts.handledAt))
+	}
+}
+
+func TestServerBuilder_OnOverload_WhenHandshakesSaturated(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	busy := &Reason{Code: ReasonCodeSessionError, Description: "The server is busy"}
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Backlog(1).
+		MaxConcurrentHandshakes(1).
+		OnOverload(func() *Reason {
+			return busy
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	// The first transport holds the only handshake slot, since it never starts the session
+	stalled, err := DialInProcess(addr1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(stalled)
+	time.Sleep(16 * time.Millisecond)
+	transport, err := DialInProcess(addr1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClientChannel(transport, 1)
+	defer silentClose(c)
+
+	// Act
+	ses, err := c.EstablishSession(ctx, NoneCompressionSelector, NoneEncryptionSelector, Identity{Name: NewEnvelopeID(), Domain: "localhost"}, GuestAuthenticator, "")
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.NotNil(t, ses) {
+		assert.Equal(t, SessionStateFailed, ses.State)
+		assert.Equal(t, busy, ses.Reason)
+	}
+}
+
+func TestServer_ShedTransport_WhenSheddingSaturated(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	srv := NewServerBuilder().
+		ListenInProcess(InProcessAddr("localhost")).
+		EnableGuestAuthentication().
+		OnOverload(func() *Reason {
+			return &Reason{Code: ReasonCodeSessionError, Description: "The server is busy"}
+		}).
+		Build()
+	defer silentClose(srv)
+	for i := 0; i < maxConcurrentSheds; i++ {
+		srv.shedSlots <- struct{}{}
+	}
+	client, server := newInProcessTransportPair("localhost", 1)
+	defer silentClose(client)
+
+	// Act
+	srv.shedTransport(ctx, acceptedTransport{transport: server})
+
+	// Assert
+	assert.False(t, server.Connected())
+	_, err := client.Receive(ctx)
+	assert.Error(t, err)
+	assert.NoError(t, ctx.Err())
+}
+
+func TestServerBuilder_SessionIDValidator_WhenGeneratedIDIsReplayed(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	// The ids are assigned by an external store, which may replay an id already used in the federation
+	used := map[string]bool{"federated-session-1": true}
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		SessionIDGenerator(func() string {
+			return "federated-session-1"
+		}).
+		SessionIDValidator(func(_ context.Context, id string) error {
+			if used[id] {
+				return NewReasonError(ReasonCodeSessionError, "Replayed session id")
+			}
+			return nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	transport, err := DialInProcess(addr1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClientChannel(transport, 1)
+	defer silentClose(c)
+
+	// Act
+	ses, err := c.EstablishSession(ctx, NoneCompressionSelector, NoneEncryptionSelector, Identity{Name: NewEnvelopeID(), Domain: "localhost"}, GuestAuthenticator, "")
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.NotNil(t, ses) {
+		assert.Equal(t, "federated-session-1", ses.ID)
+		assert.Equal(t, SessionStateFailed, ses.State)
+		if assert.NotNil(t, ses.Reason) {
+			assert.Equal(t, "Replayed session id", ses.Reason.Description)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 )
 
 // The Session envelope is used for the negotiation, authentication and establishment of the communication channel
@@ -123,7 +124,7 @@ func (s *Session) populate(raw *rawEnvelope) error {
 			return errors.New("session scheme is required when authentication is present")
 		}
 
-		factory, ok := authFactories[*raw.Scheme]
+		factory, ok := authFactory(*raw.Scheme)
 		if !ok {
 			return fmt.Errorf(`unknown authentication scheme '%v'`, raw.Scheme)
 		}
@@ -300,6 +301,30 @@ var authFactories = map[AuthenticationScheme]func() Authentication{
 	},
 }
 
+var authFactoriesMu sync.RWMutex
+
+// RegisterAuthenticationScheme allow the registration of new authentication schemes, which allow the Authentication
+// types to be discovered for the session deserialization process. Registering an existing scheme replaces its factory.
+// It is safe for concurrent use.
+func RegisterAuthenticationScheme(scheme AuthenticationScheme, factory func() Authentication) {
+	if scheme == "" {
+		panic("empty scheme")
+	}
+	if factory == nil {
+		panic("nil factory")
+	}
+	authFactoriesMu.Lock()
+	defer authFactoriesMu.Unlock()
+	authFactories[scheme] = factory
+}
+
+func authFactory(scheme AuthenticationScheme) (func() Authentication, bool) {
+	authFactoriesMu.RLock()
+	defer authFactoriesMu.RUnlock()
+	factory, ok := authFactories[scheme]
+	return factory, ok
+}
+
 // Authentication defines a session authentications scheme container
 type Authentication interface {
 	GetAuthenticationScheme() AuthenticationScheme
@@ -0,0 +1,84 @@
+package lime
+
+import "sync"
+
+// SessionStore holds the established session channels of a server, allowing the lookup of the channel of a node
+// for routing the envelopes addressed to it.
+// The Server adds the channels to the store when the sessions are established and removes them when finished.
+// The implementations should be safe for concurrent use.
+type SessionStore interface {
+	// Add includes the established session channel in the store.
+	Add(c *ServerChannel)
+	// Remove removes the channel of the specified session id from the store.
+	Remove(sessionID string)
+	// Get returns the channel of the specified node.
+	// If the node has no instance, any channel of the node identity may be returned.
+	Get(n Node) (*ServerChannel, bool)
+	// All returns the channels in the store.
+	All() []*ServerChannel
+}
+
+// MemorySessionStore is an in-memory implementation of the SessionStore interface.
+type MemorySessionStore struct {
+	channels map[string]*ServerChannel // channels holds the session channels by session id
+	nodes    map[Node]string           // nodes holds the session ids by the session remote node
+	mu       sync.RWMutex
+}
+
+// NewMemorySessionStore creates a new instance of the MemorySessionStore type.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		channels: make(map[string]*ServerChannel),
+		nodes:    make(map[Node]string),
+	}
+}
+
+func (s *MemorySessionStore) Add(c *ServerChannel) {
+	if c == nil {
+		panic("nil channel")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channels[c.ID()] = c
+	s.nodes[c.RemoteNode()] = c.ID()
+}
+
+func (s *MemorySessionStore) Remove(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.channels[sessionID]
+	if !ok {
+		return
+	}
+	// The node may be registered by a newer session
+	if id, ok := s.nodes[c.RemoteNode()]; ok && id == sessionID {
+		delete(s.nodes, c.RemoteNode())
+	}
+	delete(s.channels, sessionID)
+}
+
+func (s *MemorySessionStore) Get(n Node) (*ServerChannel, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if id, ok := s.nodes[n]; ok {
+		return s.channels[id], true
+	}
+	if n.Instance == "" {
+		for node, id := range s.nodes {
+			if node.Identity == n.Identity {
+				return s.channels[id], true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (s *MemorySessionStore) All() []*ServerChannel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	channels := make([]*ServerChannel, 0, len(s.channels))
+	for _, c := range s.channels {
+		channels = append(channels, c)
+	}
+	return channels
+}
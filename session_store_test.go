@@ -0,0 +1,108 @@
+package lime
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"golang.org/x/sync/errgroup"
+	"testing"
+	"time"
+)
+
+func createStoredServerChannel(sessionID string, node Node) *ServerChannel {
+	return &ServerChannel{channel: &channel{sessionID: sessionID, remoteNode: node}}
+}
+
+func TestMemorySessionStore_Get(t *testing.T) {
+	// Arrange
+	store := NewMemorySessionStore()
+	node1 := Node{Identity: Identity{Name: "golang", Domain: "limeprotocol.org"}, Instance: "home"}
+	node2 := Node{Identity: Identity{Name: "csharp", Domain: "limeprotocol.org"}, Instance: "work"}
+	c1 := createStoredServerChannel("session1", node1)
+	c2 := createStoredServerChannel("session2", node2)
+	store.Add(c1)
+	store.Add(c2)
+
+	// Act
+	actual1, ok1 := store.Get(node1)
+	actual2, ok2 := store.Get(Node{Identity: node2.Identity})
+	_, ok3 := store.Get(Node{Identity: Identity{Name: "java", Domain: "limeprotocol.org"}})
+
+	// Assert
+	assert.True(t, ok1)
+	assert.Same(t, c1, actual1)
+	assert.True(t, ok2)
+	assert.Same(t, c2, actual2)
+	assert.False(t, ok3)
+	assert.Len(t, store.All(), 2)
+}
+
+func TestMemorySessionStore_Remove(t *testing.T) {
+	// Arrange
+	store := NewMemorySessionStore()
+	node := Node{Identity: Identity{Name: "golang", Domain: "limeprotocol.org"}, Instance: "home"}
+	c1 := createStoredServerChannel("session1", node)
+	c2 := createStoredServerChannel("session2", node)
+	store.Add(c1)
+	store.Add(c2)
+
+	// Act
+	store.Remove("session1")
+
+	// Assert
+	actual, ok := store.Get(node)
+	assert.True(t, ok)
+	assert.Same(t, c2, actual)
+	assert.Equal(t, []*ServerChannel{c2}, store.All())
+}
+
+func TestServer_SessionStore(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	finishedChan := make(chan string, 2)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Finished(func(sessionID string, reason *Reason, err error) {
+			finishedChan <- sessionID
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	client1 := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(client1)
+	client2 := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(client2)
+
+	// Act
+	c1, ok1 := srv.SessionStore().Get(client1.LocalNode())
+	c2, ok2 := srv.SessionStore().Get(client2.LocalNode())
+	_ = client1.Close()
+
+	// Assert
+	if assert.True(t, ok1) {
+		assert.Equal(t, client1.ID(), c1.ID())
+	}
+	if assert.True(t, ok2) {
+		assert.Equal(t, client2.ID(), c2.ID())
+	}
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "finished timeout")
+	case sessionID := <-finishedChan:
+		assert.Equal(t, client1.ID(), sessionID)
+	}
+	_, ok := srv.SessionStore().Get(client1.LocalNode())
+	assert.False(t, ok)
+	assert.Len(t, srv.SessionStore().All(), 1)
+}
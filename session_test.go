@@ -592,3 +592,34 @@ func TestSession_UnmarshalJSON_Failed(t *testing.T) {
 	assert.Equal(t, SessionStateFailed, s.State)
 	assert.Equal(t, Reason{13, "The session authentication failed"}, *s.Reason)
 }
+
+type otpAuthentication struct {
+	Code string `json:"code"`
+}
+
+func (a *otpAuthentication) GetAuthenticationScheme() AuthenticationScheme {
+	return "otp"
+}
+
+func TestRegisterAuthenticationScheme_RoundTrip(t *testing.T) {
+	// Arrange
+	RegisterAuthenticationScheme("otp", func() Authentication {
+		return &otpAuthentication{}
+	})
+	s := Session{State: SessionStateAuthenticating, Scheme: "otp", Authentication: &otpAuthentication{Code: "123456"}}
+	s.ID = "4609d0a3-00eb-4e16-9d44-27d115c6eb31"
+	s.From = Node{Identity{"golang", "limeprotocol.org"}, "default"}
+
+	// Act
+	j, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual Session
+	err = json.Unmarshal(j, &actual)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","from":"golang@limeprotocol.org/default","state":"authenticating","scheme":"otp","authentication":{"code":"123456"}}`, string(j))
+	assert.Equal(t, s, actual)
+}
@@ -0,0 +1,213 @@
+package lime
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+)
+
+// MetadataKeySignature is the metadata key of the envelope signature, in the base64 format.
+const MetadataKeySignature = "#signature"
+
+// ErrInvalidSignature indicates that the signature of a received envelope is missing or doesn't match its content.
+var ErrInvalidSignature = errors.New("lime: invalid envelope signature")
+
+// ErrReplayedEnvelope indicates that a received signed envelope was already received or that its timestamp is out of
+// the replay window.
+var ErrReplayedEnvelope = errors.New("lime: replayed envelope")
+
+// Signer defines a service for signing the outgoing envelopes.
+// The signed data is the canonical JSON representation of the envelope, without the signature metadata.
+type Signer interface {
+	Sign(ctx context.Context, data []byte) ([]byte, error)
+}
+
+// Verifier defines a service for verifying the signature of the received envelopes.
+// The context holds the session values, like the remote node, allowing the selection of the key of the originator.
+type Verifier interface {
+	Verify(ctx context.Context, data []byte, signature []byte) error
+}
+
+// ECDSASigner is a Signer that uses an ECDSA private key with the SHA-256 hash.
+type ECDSASigner struct {
+	key *ecdsa.PrivateKey
+}
+
+// NewECDSASigner creates a new instance of the ECDSASigner type.
+func NewECDSASigner(key *ecdsa.PrivateKey) *ECDSASigner {
+	if key == nil {
+		panic("nil key")
+	}
+	return &ECDSASigner{key: key}
+}
+
+func (s *ECDSASigner) Sign(_ context.Context, data []byte) ([]byte, error) {
+	hash := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, s.key, hash[:])
+}
+
+// ECDSAVerifier is a Verifier that uses an ECDSA public key with the SHA-256 hash.
+type ECDSAVerifier struct {
+	key *ecdsa.PublicKey
+}
+
+// NewECDSAVerifier creates a new instance of the ECDSAVerifier type.
+func NewECDSAVerifier(key *ecdsa.PublicKey) *ECDSAVerifier {
+	if key == nil {
+		panic("nil key")
+	}
+	return &ECDSAVerifier{key: key}
+}
+
+func (v *ECDSAVerifier) Verify(_ context.Context, data []byte, signature []byte) error {
+	hash := sha256.Sum256(data)
+	if !ecdsa.VerifyASN1(v.key, hash[:], signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// CanonicalJSON returns the canonical JSON representation of the envelope, which is the data signed by the Signer.
+// The object keys are sorted in all levels, including in the document contents, and there's no insignificant
+// whitespace, so the output is the same for equivalent envelopes. The signature metadata is not included.
+// The value should be an envelope, like a *Message or a *Notification, otherwise an error is returned.
+func CanonicalJSON(e interface{}) ([]byte, error) {
+	if e == nil {
+		panic("nil envelope")
+	}
+	if _, ok := e.(envelope); !ok {
+		return nil, fmt.Errorf("canonical json: unsupported type %T", e)
+	}
+	if reflect.ValueOf(e).IsNil() {
+		panic("nil envelope")
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decodes to generic values, which have its keys sorted when encoded
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var v map[string]interface{}
+	if err = d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if m, ok := v["metadata"].(map[string]interface{}); ok {
+		delete(m, MetadataKeySignature)
+		if len(m) == 0 {
+			delete(v, "metadata")
+		}
+	}
+	return json.Marshal(v)
+}
+
+// signEnvelope signs the envelope with the channel signer, placing the signature in its metadata.
+// A nonce and the signing timestamp are included in the signed metadata, allowing the detection of replays.
+func (c *channel) signEnvelope(ctx context.Context, e envelope) error {
+	env := envelopeOf(e)
+	if env == nil {
+		return nil
+	}
+	env.SetMetadataKeyValue(MetadataKeyNonce, NewEnvelopeID())
+	env.SetMetadataKeyValue(MetadataKeyTimestamp, time.Now().UTC().Format(time.RFC3339Nano))
+	data, err := CanonicalJSON(e)
+	if err != nil {
+		return fmt.Errorf("sign envelope: %w", err)
+	}
+	sig, err := c.signer.Sign(ctx, data)
+	if err != nil {
+		return fmt.Errorf("sign envelope: %w", err)
+	}
+	env.SetMetadataKeyValue(MetadataKeySignature, base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
+
+// verifyEnvelope checks the signature of the received envelope with the channel verifier.
+func (c *channel) verifyEnvelope(ctx context.Context, e envelope) error {
+	env := envelopeOf(e)
+	if env == nil {
+		return nil
+	}
+	encoded, ok := env.Metadata[MetadataKeySignature]
+	if !ok {
+		return ErrInvalidSignature
+	}
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	data, err := CanonicalJSON(e)
+	if err != nil {
+		return err
+	}
+	if err := c.verifier.Verify(sessionContext(ctx, c), data, sig); err != nil {
+		return err
+	}
+	if c.replays != nil {
+		return c.checkReplay(env)
+	}
+	return nil
+}
+
+// checkReplay checks if the signed nonce of the envelope was already received from the remote node or if its
+// timestamp is out of the replay window.
+func (c *channel) checkReplay(env *Envelope) error {
+	timestamp, err := time.Parse(time.RFC3339Nano, env.Metadata[MetadataKeyTimestamp])
+	if err != nil {
+		return ErrReplayedEnvelope
+	}
+	if !c.replays.add(c.remoteNode, env.Metadata[MetadataKeyNonce], timestamp, time.Now()) {
+		return ErrReplayedEnvelope
+	}
+	return nil
+}
+
+// discardUnverified checks the signature of the received envelope, returning true if it should be discarded.
+// A failed notification is sent for discarded messages and a failure response for discarded request commands.
+func (c *channel) discardUnverified(ctx context.Context, e envelope) bool {
+	err := c.verifyEnvelope(ctx, e)
+	if err == nil {
+		return false
+	}
+
+	reason := &Reason{
+		Code:        ReasonCodeValidationError,
+		Description: "The envelope signature is invalid",
+	}
+	switch {
+	case errors.Is(err, ErrReplayedEnvelope):
+		reason.Description = "The envelope was already received or its timestamp is out of the allowed window"
+	case !errors.Is(err, ErrInvalidSignature):
+		log.Printf("discardUnverified: %v", err)
+	}
+	var reply envelope
+	switch v := e.(type) {
+	case *Message:
+		if v.ID != "" {
+			reply = v.FailedNotification(reason)
+		}
+	case *RequestCommand:
+		if v.ID != "" {
+			reply = v.FailureResponse(reason)
+		}
+	}
+	if reply != nil {
+		c.sendMu.Lock()
+		err := c.transport.Send(ctx, reply)
+		c.sendMu.Unlock()
+		if err != nil {
+			log.Printf("discardUnverified: %v", err)
+		}
+	}
+	return true
+}
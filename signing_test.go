@@ -0,0 +1,273 @@
+package lime
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"golang.org/x/sync/errgroup"
+	"testing"
+	"time"
+)
+
+func createSigningKey(t testing.TB) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func establishSignedChannel(ctx context.Context, t testing.TB, addr InProcessAddr, signer Signer) *ClientChannel {
+	client, err := DialInProcess(addr, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	channel := NewClientChannel(client, 1)
+	channel.signer = signer
+	_, err = channel.EstablishSession(
+		ctx,
+		func([]SessionCompression) SessionCompression {
+			return SessionCompressionNone
+		},
+		func([]SessionEncryption) SessionEncryption {
+			return SessionEncryptionNone
+		},
+		Identity{
+			Name:   NewEnvelopeID(),
+			Domain: "localhost",
+		},
+		func([]AuthenticationScheme, Authentication) Authentication {
+			return &GuestAuthentication{}
+		},
+		"default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return channel
+}
+
+func TestECDSASigner_Sign(t *testing.T) {
+	// Arrange
+	key := createSigningKey(t)
+	signer := NewECDSASigner(key)
+	verifier := NewECDSAVerifier(&key.PublicKey)
+	data := []byte(`{"id":"1","content":"Hello world"}`)
+
+	// Act
+	sig, err := signer.Sign(context.Background(), data)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, verifier.Verify(context.Background(), data, sig))
+	assert.ErrorIs(t, verifier.Verify(context.Background(), []byte(`{"id":"2"}`), sig), ErrInvalidSignature)
+}
+
+func TestServerBuilder_Verifier_WhenSignatureIsValid(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	key := createSigningKey(t)
+	msgChan := make(chan *Message, 1)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Verifier(NewECDSAVerifier(&key.PublicKey)).
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			msgChan <- msg
+			return nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	channel := establishSignedChannel(ctx, t, addr1, NewECDSASigner(key))
+	defer silentClose(channel)
+	msg := createMessage()
+
+	// Act
+	err := channel.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive message timeout")
+	case actual := <-msgChan:
+		assert.Equal(t, msg.ID, actual.ID)
+		assert.NotEmpty(t, actual.Metadata[MetadataKeySignature])
+	}
+}
+
+func TestServerBuilder_Verifier_WhenEnvelopeIsTampered(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	key := createSigningKey(t)
+	msgChan := make(chan *Message, 1)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Verifier(NewECDSAVerifier(&key.PublicKey)).
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			msgChan <- msg
+			return nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	msg := createMessage()
+	if err := (&channel{signer: NewECDSASigner(key)}).signEnvelope(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	// The channel doesn't sign the envelopes, so the signature of the original message is kept
+	channel := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(channel)
+	var tampered TextDocument = "Goodbye world"
+	msg.SetContent(&tampered)
+
+	// Act
+	err := channel.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive notification timeout")
+	case not := <-channel.NotChan():
+		assert.Equal(t, msg.ID, not.ID)
+		assert.Equal(t, NotificationEventFailed, not.Event)
+		if assert.NotNil(t, not.Reason) {
+			assert.Equal(t, ReasonCodeValidationError, not.Reason.Code)
+		}
+	}
+	assert.Len(t, msgChan, 0)
+}
+
+func TestServerBuilder_ReplayWindow_WhenEnvelopeIsReplayed(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr1 := InProcessAddr("localhost")
+	key := createSigningKey(t)
+	msgChan := make(chan *Message, 2)
+	srv := NewServerBuilder().
+		ListenInProcess(addr1).
+		EnableGuestAuthentication().
+		Verifier(NewECDSAVerifier(&key.PublicKey)).
+		ReplayWindow(time.Minute).
+		MessagesHandlerFunc(func(ctx context.Context, msg *Message, s Sender) error {
+			msgChan <- msg
+			return nil
+		}).
+		Build()
+	defer silentClose(srv)
+	done := make(chan bool)
+	eg, _ := errgroup.WithContext(context.Background())
+	eg.Go(func() error {
+		close(done)
+		return srv.ListenAndServe()
+	})
+	<-done
+	time.Sleep(16 * time.Millisecond)
+	msg := createMessage()
+	if err := (&channel{signer: NewECDSASigner(key)}).signEnvelope(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	channel := establishSignedChannel(ctx, t, addr1, nil)
+	defer silentClose(channel)
+	if err := channel.SendMessage(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("receive message timeout")
+	case <-msgChan:
+	}
+
+	// Act
+	err := channel.SendMessage(ctx, msg)
+
+	// Assert
+	assert.NoError(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "receive notification timeout")
+	case not := <-channel.NotChan():
+		assert.Equal(t, msg.ID, not.ID)
+		assert.Equal(t, NotificationEventFailed, not.Event)
+		if assert.NotNil(t, not.Reason) {
+			assert.Equal(t, ReasonCodeValidationError, not.Reason.Code)
+		}
+	}
+	assert.Len(t, msgChan, 0)
+}
+
+func TestCanonicalJSON_WithMetadata(t *testing.T) {
+	// Arrange
+	msg := createMessage()
+	for _, k := range []string{"zulu", "alpha", "mike", "#signature", "bravo", "yankee", "charlie"} {
+		msg.SetMetadataKeyValue(k, k+"-value")
+	}
+	var content JsonDocument = map[string]interface{}{"zeta": 1.5, "beta": map[string]interface{}{"y": true, "x": "<text>"}}
+	msg.SetContent(&content)
+
+	// Act
+	first, err := CanonicalJSON(msg)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"application/json","content":{"beta":{"x":"<text>","y":true},"zeta":1.5},"metadata":{"alpha":"alpha-value","bravo":"bravo-value","charlie":"charlie-value","mike":"mike-value","yankee":"yankee-value","zulu":"zulu-value"}}`, string(first))
+	assert.Regexp(t, `"metadata":\{"alpha":.*"bravo":.*"charlie":.*"mike":.*"yankee":.*"zulu":`, string(first))
+	assert.Equal(t, "#signature-value", msg.Metadata[MetadataKeySignature])
+	for i := 0; i < 100; i++ {
+		actual, err := CanonicalJSON(msg)
+		assert.NoError(t, err)
+		assert.Equal(t, first, actual)
+	}
+}
+
+func TestCanonicalJSON_WhenOnlySignatureMetadata(t *testing.T) {
+	// Arrange
+	msg := createMessage()
+	msg.SetMetadataKeyValue(MetadataKeySignature, "signature")
+
+	// Act
+	actual, err := CanonicalJSON(msg)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, `{"content":"Hello world","id":"4609d0a3-00eb-4e16-9d44-27d115c6eb31","to":"golang@limeprotocol.org/default","type":"text/plain"}`, string(actual))
+}
+
+func TestCanonicalJSON_WhenNotEnvelope(t *testing.T) {
+	// Arrange
+	reason := &Reason{Code: ReasonCodeGeneralError, Description: "Not an envelope"}
+
+	// Act
+	actual, err := CanonicalJSON(reason)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Nil(t, actual)
+}
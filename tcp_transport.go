@@ -11,27 +11,43 @@ import (
 	"net"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const DefaultReadLimit int64 = 8192 * 1024
 
+// TLSNextProtoLime is the LIME protocol identifier for the TLS application-layer protocol negotiation (ALPN).
+// It should be included in the TLSConfig NextProtos value for enabling the negotiation.
+const TLSNextProtoLime = "lime"
+
+// ErrTLSHandshake indicates that the TLS handshake of a transport has failed.
+// The transport is closed after the failure, since its connection may be partially upgraded.
+var ErrTLSHandshake = errors.New("lime: tls handshake failed")
+
+// DefaultKeepAlivePeriod is the default interval between TCP keep-alive probes.
+const DefaultKeepAlivePeriod = 15 * time.Second
+
 type tcpTransport struct {
 	TCPConfig
 	conn          net.Conn
 	ctxConn       *ctxConn
 	encoder       *json.Encoder
-	decoder       *json.Decoder
+	writer        io.Writer
+	decoder       interface{ Decode(v interface{}) error }
 	limitedReader io.LimitedReader
 	encryption    SessionEncryption
 	server        bool
-	eof           bool
+	eof           int32  // eof is set to 1 when the connection is found to be closed, being accessed atomically
+	protocol      string // protocol is the application protocol negotiated during the TLS handshake
+	serverName    string // serverName is the server name indicated by the client during the TLS handshake
 }
 
 // DialTcp opens a TCP  transport connection with the specified URI.
+// The address can also be a Unix domain socket address, with the 'unix' network.
 func DialTcp(ctx context.Context, addr net.Addr, config *TCPConfig) (Transport, error) {
-	if addr.Network() != "tcp" {
-		return nil, errors.New("address network should be tcp")
+	if !isStreamNetwork(addr.Network()) {
+		return nil, errors.New("address network should be tcp or unix")
 	}
 
 	var d net.Dialer
@@ -44,6 +60,11 @@ func DialTcp(ctx context.Context, addr net.Addr, config *TCPConfig) (Transport,
 		config = &defaultTCPConfig
 	}
 
+	if err := setKeepAlive(conn, config.KeepAlivePeriod); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
 	t := tcpTransport{TCPConfig: *config}
 
 	t.setConn(conn)
@@ -51,6 +72,18 @@ func DialTcp(ctx context.Context, addr net.Addr, config *TCPConfig) (Transport,
 	return &t, nil
 }
 
+// DialUnix opens a transport connection with the Unix domain socket in the specified path.
+// The transport has the same features of the TCP transport, but avoids the network stack overhead for co-located
+// processes.
+func DialUnix(ctx context.Context, path string, config *TCPConfig) (Transport, error) {
+	return DialTcp(ctx, &net.UnixAddr{Name: path, Net: "unix"}, config)
+}
+
+// isStreamNetwork indicates if the network is supported by the TCP transport.
+func isStreamNetwork(network string) bool {
+	return network == "tcp" || network == "unix"
+}
+
 func (t *tcpTransport) SupportedCompression() []SessionCompression {
 	return []SessionCompression{SessionCompressionNone}
 }
@@ -88,7 +121,7 @@ func (t *tcpTransport) SetEncryption(ctx context.Context, e SessionEncryption) e
 
 	// https://github.com/FluuxIO/go-xmpp/blob/master/xmpp_transport.go#L80
 	if t.server {
-		tlsConn = tls.Server(t.conn, t.TLSConfig)
+		tlsConn = tls.Server(t.conn, t.serverTLSConfig())
 	} else {
 		tlsConn = tls.Client(t.conn, t.TLSConfig)
 	}
@@ -108,14 +141,79 @@ func (t *tcpTransport) SetEncryption(ctx context.Context, e SessionEncryption) e
 
 	// We convert existing connection to TLS
 	if err := tlsConn.Handshake(); err != nil {
-		return err
+		// The connection state is unknown after a failed handshake, so it cannot be used anymore
+		_ = t.ctxConn.Close()
+		t.setEOF()
+		return fmt.Errorf("tcp transport: %w: %v", ErrTLSHandshake, err)
 	}
 
 	t.setConn(tlsConn)
 	t.encryption = SessionEncryptionTLS
+	state := tlsConn.ConnectionState()
+	t.protocol = state.NegotiatedProtocol
+	t.serverName = state.ServerName
 	return nil
 }
 
+func (t *tcpTransport) serverTLSConfig() *tls.Config {
+	if t.OnClientHello == nil && t.ClientAuth == tls.NoClientCert {
+		return t.TLSConfig
+	}
+
+	config := t.TLSConfig.Clone()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if t.ClientAuth != tls.NoClientCert {
+		config.ClientAuth = t.ClientAuth
+	}
+	if t.OnClientHello == nil {
+		return config
+	}
+
+	getConfigForClient := config.GetConfigForClient
+	onClientHello := t.OnClientHello
+	config.GetConfigForClient = func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+		onClientHello(info)
+		if getConfigForClient != nil {
+			return getConfigForClient(info)
+		}
+		return nil, nil
+	}
+	return config
+}
+
+// ServerName returns the server name indication (SNI) sent by the client during the TLS handshake.
+// It returns an empty string if the transport is not encrypted or if the client has not sent it.
+func (t *tcpTransport) ServerName() string {
+	return t.serverName
+}
+
+// ConnectionState returns the state of the TLS connection, or false if the transport is not encrypted.
+func (t *tcpTransport) ConnectionState() (tls.ConnectionState, bool) {
+	if tlsConn, ok := t.conn.(*tls.Conn); ok {
+		return tlsConn.ConnectionState(), true
+	}
+	return tls.ConnectionState{}, false
+}
+
+// PeerInfo returns the values of the certificate presented by the remote peer during the TLS handshake, or false if
+// the transport is not encrypted or the peer has not presented a certificate.
+func (t *tcpTransport) PeerInfo() (PeerInfo, bool) {
+	state, ok := t.ConnectionState()
+	if !ok {
+		return PeerInfo{}, false
+	}
+	return peerInfoFromTLS(state)
+}
+
+// NegotiatedProtocol returns the application protocol negotiated through ALPN during the TLS handshake.
+// The NextProtos value from the TLSConfig is used in the negotiation, and it returns an empty string if the
+// transport is not encrypted or if no protocol was negotiated.
+func (t *tcpTransport) NegotiatedProtocol() string {
+	return t.protocol
+}
+
 func (t *tcpTransport) Send(ctx context.Context, e envelope) error {
 	if ctx == nil {
 		panic("nil context")
@@ -129,11 +227,38 @@ func (t *tcpTransport) Send(ctx context.Context, e envelope) error {
 		return err
 	}
 
+	if t.WriteLimit > 0 {
+		return t.sendLimited(ctx, e)
+	}
+
 	t.ctxConn.SetWriteContext(ctx)
 
 	if err := t.encoder.Encode(e); err != nil {
 		if errors.Is(err, io.EOF) {
-			t.eof = true
+			t.setEOF()
+		}
+		return fmt.Errorf("tcp transport: send: %w", err)
+	}
+
+	return nil
+}
+
+// sendLimited marshals the envelope before writing it, for checking its size against the write limit.
+func (t *tcpTransport) sendLimited(ctx context.Context, e envelope) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("tcp transport: send: %w", err)
+	}
+	if int64(len(b)) > t.WriteLimit {
+		return fmt.Errorf("tcp transport: send: %w: the envelope has %v bytes", ErrWriteLimitExceeded, len(b))
+	}
+
+	t.ctxConn.SetWriteContext(ctx)
+
+	// The newline is added for consistency with the envelopes written by the encoder
+	if _, err = t.writer.Write(append(b, '\n')); err != nil {
+		if errors.Is(err, io.EOF) {
+			t.setEOF()
 		}
 		return fmt.Errorf("tcp transport: send: %w", err)
 	}
@@ -152,16 +277,27 @@ func (t *tcpTransport) Receive(ctx context.Context) (envelope, error) {
 
 	t.ctxConn.SetReadContext(ctx)
 
-	var raw rawEnvelope
-	if err := t.decoder.Decode(&raw); err != nil {
-		if errors.Is(err, io.EOF) {
-			t.eof = true
+	for {
+		var raw rawEnvelope
+		if err := t.decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				t.setEOF()
+			}
+			return nil, fmt.Errorf("tcp transport: receive: %w", err)
 		}
-		return nil, fmt.Errorf("tcp transport: receive: %w", err)
-	}
 
-	t.limitedReader.N = t.ReadLimit
-	return raw.toEnvelope()
+		t.limitedReader.N = t.ReadLimit
+		env, err := raw.toEnvelope()
+		if err != nil {
+			// The recoverable decoder skips the objects that are not envelopes, as it does with the malformed ones
+			if d, ok := t.decoder.(*recoverableDecoder); ok {
+				d.discard(fmt.Errorf("%w: %v", ErrMalformedFrame, err))
+				continue
+			}
+			return nil, err
+		}
+		return env, nil
+	}
 }
 
 func (t *tcpTransport) Close() error {
@@ -175,7 +311,38 @@ func (t *tcpTransport) Close() error {
 }
 
 func (t *tcpTransport) Connected() bool {
-	return t.conn != nil && !t.eof
+	return t.conn != nil && atomic.LoadInt32(&t.eof) == 0
+}
+
+func (t *tcpTransport) setEOF() {
+	atomic.StoreInt32(&t.eof, 1)
+}
+
+// IsHealthy checks the liveness of the connection by writing zero bytes to it, which sends no data but fails if the
+// socket has a pending error. It detects the connections reset by the remote peer and, if the socket keep-alive is
+// enabled (see the TCPConfig KeepAlivePeriod value), the ones whose peer vanished without resetting them, after the
+// keep-alive probes fail. A vanished peer is not detected before that. If the probe fails, the transport is no longer
+// reported as connected.
+func (t *tcpTransport) IsHealthy(ctx context.Context) bool {
+	if ctx == nil {
+		panic("nil context")
+	}
+
+	if !t.Connected() || ctx.Err() != nil {
+		return false
+	}
+
+	// The probe is written in the underlying connection, since the TLS connection doesn't write empty records
+	conn := t.conn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if _, err := conn.Write(nil); err != nil {
+		t.setEOF()
+		return false
+	}
+
+	return true
 }
 
 func (t *tcpTransport) LocalAddr() net.Addr {
@@ -207,6 +374,7 @@ func (t *tcpTransport) setConn(conn net.Conn) {
 	}
 
 	// Sets the encoder to be used for sending envelopes
+	t.writer = writer
 	t.encoder = json.NewEncoder(writer)
 
 	if t.ReadLimit == 0 {
@@ -220,7 +388,15 @@ func (t *tcpTransport) setConn(conn net.Conn) {
 		R: reader,
 		N: t.ReadLimit,
 	}
-	t.decoder = json.NewDecoder(&t.limitedReader)
+	if t.RecoverableDecoder {
+		t.decoder = newRecoverableDecoder(reader, t.ReadLimit, t.StrictDecoding, t.OnDecodeError)
+		return
+	}
+	decoder := json.NewDecoder(&t.limitedReader)
+	if t.StrictDecoding {
+		decoder.DisallowUnknownFields()
+	}
+	t.decoder = decoder
 }
 
 func (t *tcpTransport) ensureOpen() error {
@@ -239,6 +415,7 @@ type tcpTransportListener struct {
 	done     chan struct{}
 }
 
+// NewTCPTransportListener creates a listener of TCP transports, which also listens on Unix domain socket addresses.
 func NewTCPTransportListener(config *TCPConfig) TransportListener {
 	if config == nil {
 		config = &defaultTCPConfig
@@ -251,13 +428,72 @@ type TCPConfig struct {
 	TraceWriter TraceWriter // TraceWriter sets the trace writer for tracing connection envelopes
 	TLSConfig   *tls.Config
 	ConnBuffer  int
+	// OnClientHello is called in server transports when a TLS ClientHello message is received from the client,
+	// before the TLSConfig GetConfigForClient and GetCertificate functions.
+	OnClientHello func(info *tls.ClientHelloInfo)
+	// ClientAuth defines the policy of server transports for requesting the client certificate during the TLS
+	// handshake, allowing the use of mutual TLS. If defined, it overrides the TLSConfig ClientAuth value.
+	// The certificates presented by the client are available through the ContextTLSConnectionState function, for
+	// use in the transport authentication. Note that the TLSConfig ClientCAs value is required for verifying them.
+	ClientAuth tls.ClientAuthType
+	// KeepAlivePeriod defines the interval between TCP keep-alive probes, which allows the detection of dead peers.
+	// A zero value uses the DefaultKeepAlivePeriod, while a negative value disables the keep-alive probes.
+	KeepAlivePeriod time.Duration
+	// StrictDecoding indicates if the received envelopes with unknown fields should be rejected, allowing the
+	// detection of protocol drifts. The transport fails to receive when an unknown field is found.
+	StrictDecoding bool
+	// WriteLimit defines the maximum size in bytes of the sent envelopes. The envelopes that exceed the limit are not
+	// written to the connection and the send fails with ErrWriteLimitExceeded. If zero, the size is not limited.
+	WriteLimit int64
+	// AcceptFilter is called by the listeners for each accepted connection, before it becomes a transport, allowing
+	// the rejection of connections by its remote address, for instance. If it returns false, the connection is closed
+	// without a session. The function is called by the goroutine that accepts the connections, so it should not block.
+	AcceptFilter func(conn net.Conn) bool
+	// ProxyProtocol indicates if the listeners should read the PROXY protocol header, in the v1 or v2 formats, that is
+	// sent by load balancers in the beginning of the connections. The original client address from the header is
+	// reported as the transport remote address, which is available to the session authentication. The connections
+	// without a valid header fail with ErrProxyProtocol. Note that the AcceptFilter is called before the header is
+	// read, with the load balancer address.
+	ProxyProtocol bool
+	// RecoverableDecoder indicates if the transport should skip the malformed, oversized and non-envelope received JSON
+	// objects, instead of failing the receive operation, which usually leads to the session termination. The received
+	// data is split in JSON objects, so the reading resumes in the next envelope after an invalid one.
+	// Note that a frame with unbalanced braces may cause the next envelope to be skipped as well.
+	RecoverableDecoder bool
+	// OnDecodeError is called when the RecoverableDecoder skips received data, with the error and the number of
+	// skipped bytes. The error wraps ErrMalformedFrame or ErrReadLimitExceeded.
+	// The function is called synchronously by the receiving goroutine, so it should not block.
+	OnDecodeError func(err error, skipped int)
+}
+
+var defaultTCPConfig = TCPConfig{KeepAlivePeriod: DefaultKeepAlivePeriod}
+
+// keepAliveConn is implemented by connections that support TCP keep-alive probes, like *net.TCPConn.
+type keepAliveConn interface {
+	SetKeepAlive(keepalive bool) error
+	SetKeepAlivePeriod(d time.Duration) error
+}
+
+func setKeepAlive(conn net.Conn, period time.Duration) error {
+	kaConn, ok := conn.(keepAliveConn)
+	if !ok {
+		return nil
+	}
+	if period < 0 {
+		return kaConn.SetKeepAlive(false)
+	}
+	if period == 0 {
+		period = DefaultKeepAlivePeriod
+	}
+	if err := kaConn.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return kaConn.SetKeepAlivePeriod(period)
 }
 
-var defaultTCPConfig = TCPConfig{}
-
 func (l *tcpTransportListener) Listen(ctx context.Context, addr net.Addr) error {
-	if addr.Network() != "tcp" {
-		return errors.New("address network should be tcp")
+	if !isStreamNetwork(addr.Network()) {
+		return errors.New("address network should be tcp or unix")
 	}
 
 	l.mu.Lock()
@@ -268,7 +504,7 @@ func (l *tcpTransportListener) Listen(ctx context.Context, addr net.Addr) error
 	}
 
 	var lc net.ListenConfig
-	listener, err := lc.Listen(ctx, "tcp", addr.String())
+	listener, err := lc.Listen(ctx, addr.Network(), addr.String())
 	if err != nil {
 		return err
 	}
@@ -295,6 +531,9 @@ func (l *tcpTransportListener) serve(listener net.Listener) {
 				log.Printf("tcp listener: serve: %v\n", err)
 				return
 			}
+		} else if l.AcceptFilter != nil && !l.AcceptFilter(conn) {
+			// The connection is rejected before becoming a transport
+			_ = conn.Close()
 		} else {
 			select {
 			case <-l.done:
@@ -319,15 +558,62 @@ func (l *tcpTransportListener) Accept(ctx context.Context) (Transport, error) {
 		if !ok {
 			return nil, errors.New("tcp listener not serving")
 		}
-		transport := tcpTransport{
-			TCPConfig:  l.TCPConfig,
-			encryption: SessionEncryptionNone,
+		return l.newTransport(conn), nil
+	}
+}
+
+// AcceptN awaits for a new transport connection and returns it along with the other connections that are already
+// available in the listener, up to the max value.
+func (l *tcpTransportListener) AcceptN(ctx context.Context, max int) ([]Transport, error) {
+	if max <= 0 {
+		panic("max must be positive")
+	}
+
+	t, err := l.Accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	transports := []Transport{t}
+	for len(transports) < max {
+		select {
+		case conn, ok := <-l.connChan:
+			if !ok {
+				return transports, nil
+			}
+			transports = append(transports, l.newTransport(conn))
+		default:
+			return transports, nil
 		}
-		transport.server = true
-		transport.ReadLimit = l.ReadLimit
-		transport.setConn(conn)
-		return &transport, nil
 	}
+	return transports, nil
+}
+
+func (l *tcpTransportListener) newTransport(conn net.Conn) *tcpTransport {
+	if err := setKeepAlive(conn, l.KeepAlivePeriod); err != nil {
+		log.Printf("tcp listener: keep alive: %v\n", err)
+	}
+	if l.ProxyProtocol {
+		conn = newProxyConn(conn)
+	}
+	transport := tcpTransport{
+		TCPConfig:  l.TCPConfig,
+		encryption: SessionEncryptionNone,
+	}
+	transport.server = true
+	transport.ReadLimit = l.ReadLimit
+	transport.setConn(conn)
+	return &transport
+}
+
+func (l *tcpTransportListener) Addr() net.Addr {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.listener == nil {
+		return nil
+	}
+	return l.listener.Addr()
 }
 
 func (l *tcpTransportListener) Close() error {
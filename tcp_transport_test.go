@@ -15,6 +15,7 @@ import (
 	"io"
 	"math/big"
 	"net"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -214,6 +215,39 @@ func TestTCPTransportListener_Accept_WhenClosed(t *testing.T) {
 	assert.Equal(t, "tcp listener closed", err.Error())
 }
 
+func TestTCPTransportListener_AcceptN_ReadyTransports(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	listener := NewTCPTransportListener(&TCPConfig{ConnBuffer: 4})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		client := createClientTCPTransport(t, addr)
+		defer silentClose(client)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// Act
+	first, err1 := AcceptN(ctx, listener, 2)
+	second, err2 := AcceptN(ctx, listener, 5)
+
+	// Assert
+	assert.NoError(t, err1)
+	assert.Len(t, first, 2)
+	assert.NoError(t, err2)
+	assert.Len(t, second, 1)
+	assert.NoError(t, ctx.Err())
+	for _, s := range append(first, second...) {
+		assert.True(t, s.Connected())
+		silentClose(s)
+	}
+}
+
 func TestTCPTransport_Dial_WhenListening(t *testing.T) {
 	// Arrange
 	defer goleak.VerifyNone(t)
@@ -600,3 +634,815 @@ func BenchmarkTCPTransport_Send_MessageTLS(b *testing.B) {
 func silentClose(c io.Closer) {
 	_ = c.Close()
 }
+
+type keepAliveConnMock struct {
+	net.Conn
+	keepAlive       bool
+	keepAlivePeriod time.Duration
+}
+
+func (c *keepAliveConnMock) SetKeepAlive(keepalive bool) error {
+	c.keepAlive = keepalive
+	return nil
+}
+
+func (c *keepAliveConnMock) SetKeepAlivePeriod(d time.Duration) error {
+	c.keepAlivePeriod = d
+	return nil
+}
+
+func TestSetKeepAlive_WithPeriod(t *testing.T) {
+	// Arrange
+	conn := &keepAliveConnMock{}
+
+	// Act
+	err := setKeepAlive(conn, 30*time.Second)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, conn.keepAlive)
+	assert.Equal(t, 30*time.Second, conn.keepAlivePeriod)
+}
+
+func TestSetKeepAlive_WithZeroPeriod(t *testing.T) {
+	// Arrange
+	conn := &keepAliveConnMock{}
+
+	// Act
+	err := setKeepAlive(conn, 0)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, conn.keepAlive)
+	assert.Equal(t, DefaultKeepAlivePeriod, conn.keepAlivePeriod)
+}
+
+func TestSetKeepAlive_WithNegativePeriod(t *testing.T) {
+	// Arrange
+	conn := &keepAliveConnMock{keepAlive: true}
+
+	// Act
+	err := setKeepAlive(conn, -1)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.False(t, conn.keepAlive)
+	assert.Zero(t, conn.keepAlivePeriod)
+}
+
+func TestTCPTransportListener_NewTransport_WithExplicitConfigAndZeroPeriod(t *testing.T) {
+	// Arrange
+	server, client := net.Pipe()
+	defer silentClose(client)
+	conn := &keepAliveConnMock{Conn: server}
+	listener := NewTCPTransportListener(&TCPConfig{ReadLimit: 1024}).(*tcpTransportListener)
+
+	// Act
+	transport := listener.newTransport(conn)
+
+	// Assert
+	defer silentClose(transport)
+	assert.True(t, conn.keepAlive)
+	assert.Equal(t, DefaultKeepAlivePeriod, conn.keepAlivePeriod)
+}
+
+func TestTCPTransport_Dial_WithKeepAlivePeriod(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	addr := createLocalhostTCPAddress()
+	listener := createTCPListener(t, addr, nil)
+	defer silentClose(listener)
+
+	// Act
+	client, err := DialTcp(ctx, addr, &TCPConfig{KeepAlivePeriod: 30 * time.Second})
+
+	// Assert
+	assert.NoError(t, err)
+	defer silentClose(client)
+	_, ok := client.(*tcpTransport).conn.(keepAliveConn)
+	assert.True(t, ok)
+}
+
+func TestTCPTransport_SetEncryption_TLSWithALPN(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	listener := NewTCPTransportListener(&TCPConfig{TLSConfig: &tls.Config{
+		GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return createCertificate("127.0.0.1")
+		},
+		NextProtos: []string{TLSNextProtoLime},
+	}})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	client, err := DialTcp(context.Background(), addr, &TCPConfig{TLSConfig: &tls.Config{
+		ServerName:         "127.0.0.1",
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", TLSNextProtoLime},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := receiveTransport(t, transportChan)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	// Act
+	err = doTLSHandshake(ctx, server, client)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, TLSNextProtoLime, client.(*tcpTransport).NegotiatedProtocol())
+	assert.Equal(t, TLSNextProtoLime, server.(*tcpTransport).NegotiatedProtocol())
+	silentClose(client)
+	silentClose(server)
+}
+
+func TestTCPTransport_SetEncryption_WhenHandshakeFails(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	listener := NewTCPTransportListener(&TCPConfig{TLSConfig: &tls.Config{
+		GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return createCertificate("127.0.0.1")
+		},
+		MinVersion: tls.VersionTLS13,
+	}})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	client, err := DialTcp(context.Background(), addr, &TCPConfig{TLSConfig: &tls.Config{
+		ServerName:         "127.0.0.1",
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := receiveTransport(t, transportChan)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	// Act
+	err = doTLSHandshake(ctx, server, client)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrTLSHandshake)
+	assert.False(t, client.Connected())
+	assert.False(t, server.Connected())
+	assert.Equal(t, SessionEncryptionNone, client.Encryption())
+	assert.Equal(t, SessionEncryptionNone, server.Encryption())
+}
+
+func TestTCPTransport_ServerTLSConfig_WithClientAuthAndNilTLSConfig(t *testing.T) {
+	// Arrange
+	transport := &tcpTransport{TCPConfig: TCPConfig{ClientAuth: tls.RequireAnyClientCert}, server: true}
+
+	// Act
+	config := transport.serverTLSConfig()
+
+	// Assert
+	if assert.NotNil(t, config) {
+		assert.Equal(t, tls.RequireAnyClientCert, config.ClientAuth)
+	}
+}
+
+func TestTCPTransport_ServerTLSConfig_WithOnClientHelloAndNilTLSConfig(t *testing.T) {
+	// Arrange
+	var hello *tls.ClientHelloInfo
+	transport := &tcpTransport{
+		TCPConfig: TCPConfig{OnClientHello: func(info *tls.ClientHelloInfo) {
+			hello = info
+		}},
+		server: true,
+	}
+	info := &tls.ClientHelloInfo{ServerName: "localhost"}
+
+	// Act
+	config := transport.serverTLSConfig()
+
+	// Assert
+	if assert.NotNil(t, config) && assert.NotNil(t, config.GetConfigForClient) {
+		actual, err := config.GetConfigForClient(info)
+		assert.NoError(t, err)
+		assert.Nil(t, actual)
+		assert.Same(t, info, hello)
+	}
+}
+
+func TestTCPTransport_SetEncryption_WithClientCertificate(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	listener := NewTCPTransportListener(&TCPConfig{
+		TLSConfig: &tls.Config{
+			GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return createCertificate("127.0.0.1")
+			},
+		},
+		ClientAuth: tls.RequireAnyClientCert,
+	})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	clientCert, err := createCertificate("client.localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := DialTcp(context.Background(), addr, &TCPConfig{TLSConfig: &tls.Config{
+		ServerName:         "127.0.0.1",
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{*clientCert},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	// Act
+	err = doTLSHandshake(ctx, server, client)
+
+	// Assert
+	assert.NoError(t, err)
+	state, ok := server.(*tcpTransport).ConnectionState()
+	assert.True(t, ok)
+	if assert.Len(t, state.PeerCertificates, 1) {
+		assert.Equal(t, clientCert.Leaf.Raw, state.PeerCertificates[0].Raw)
+		assert.Equal(t, []string{"client.localhost"}, state.PeerCertificates[0].DNSNames)
+	}
+}
+
+func TestTCPTransport_SetEncryption_WhenClientCertificateIsMissing(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	listener := NewTCPTransportListener(&TCPConfig{
+		TLSConfig: &tls.Config{
+			GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return createCertificate("127.0.0.1")
+			},
+		},
+		ClientAuth: tls.RequireAnyClientCert,
+	})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	client := createClientTCPTransportTLS(t, addr)
+	server := receiveTransport(t, transportChan)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.SetEncryption(ctx, SessionEncryptionTLS)
+	}()
+	_ = client.SetEncryption(ctx, SessionEncryptionTLS)
+
+	// Act
+	err := <-errChan
+
+	// Assert
+	assert.ErrorIs(t, err, ErrTLSHandshake)
+	assert.False(t, server.Connected())
+	silentClose(client)
+}
+
+const unknownFieldMessageJSON = `{"id":"1","to":"golang@limeprotocol.org","type":"text/plain","content":"Hello world","unknown":true}`
+
+func TestTCPTransport_Receive_WhenUnknownFieldAndStrictDecoding(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	listener := NewTCPTransportListener(&TCPConfig{StrictDecoding: true})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	client := createClientTCPTransport(t, createLocalhostTCPAddress())
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	if _, err := client.(*tcpTransport).conn.Write([]byte(unknownFieldMessageJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	e, err := server.Receive(ctx)
+
+	// Assert
+	assert.Nil(t, e)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown field")
+	}
+}
+
+func TestTCPTransport_Receive_WhenUnknownField(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	var transportChan = make(chan Transport, 1)
+	listener := createTCPListener(t, addr, transportChan)
+	defer silentClose(listener)
+	client := createClientTCPTransport(t, createLocalhostTCPAddress())
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	if _, err := client.(*tcpTransport).conn.Write([]byte(unknownFieldMessageJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	e, err := server.Receive(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	msg, ok := e.(*Message)
+	if assert.True(t, ok) {
+		assert.Equal(t, "1", msg.ID)
+	}
+}
+
+func TestTCPTransport_IsHealthy_WhenConnected(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	var transportChan = make(chan Transport, 1)
+	listener := createTCPListener(t, addr, transportChan)
+	defer silentClose(listener)
+	client := createClientTCPTransport(t, addr)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	ses := createSession()
+
+	// Act
+	healthy := server.(HealthChecker).IsHealthy(ctx)
+
+	// Assert
+	assert.True(t, healthy)
+	assert.True(t, server.Connected())
+	// The probe doesn't send any data
+	conn := client.(*tcpTransport).conn
+	if err := conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	n, err := conn.Read(make([]byte, 1))
+	assert.Zero(t, n)
+	var netErr net.Error
+	if assert.ErrorAs(t, err, &netErr) {
+		assert.True(t, netErr.Timeout())
+	}
+	if err := server.Send(ctx, ses); err != nil {
+		t.Fatal(err)
+	}
+	e, err := client.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, ses, e)
+}
+
+func TestTCPTransport_IsHealthy_WhenPeerResetsConnection(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	var transportChan = make(chan Transport, 1)
+	listener := createTCPListener(t, addr, transportChan)
+	defer silentClose(listener)
+	client := createClientTCPTransport(t, addr)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	// Resets the client connection without the closing handshake. A peer that vanishes without resetting it is only
+	// detected after the keep-alive probes fail, which is not feasible to simulate here.
+	conn := client.(*tcpTransport).conn.(*net.TCPConn)
+	if err := conn.SetLinger(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act & Assert
+	assert.Eventually(t, func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		return !server.(HealthChecker).IsHealthy(ctx)
+	}, time.Second, 10*time.Millisecond)
+	assert.False(t, server.Connected())
+}
+
+func TestTCPTransport_IsHealthy_WhenReceivingConcurrently(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	var transportChan = make(chan Transport, 1)
+	listener := createTCPListener(t, addr, transportChan)
+	defer silentClose(listener)
+	client := createClientTCPTransport(t, addr)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	m := createMessage()
+	received := make(chan envelope, 1)
+	go func() {
+		e, _ := server.Receive(ctx)
+		received <- e
+	}()
+
+	// Act
+	for i := 0; i < 100; i++ {
+		assert.True(t, server.(HealthChecker).IsHealthy(ctx))
+	}
+
+	// Assert
+	if err := client.Send(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, m, <-received)
+	assert.True(t, server.Connected())
+}
+
+func TestTCPTransport_Send_WhenWriteLimitExceeded(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	var transportChan = make(chan Transport, 1)
+	listener := createTCPListener(t, addr, transportChan)
+	defer silentClose(listener)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	client, err := DialTcp(ctx, addr, &TCPConfig{WriteLimit: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	m := createMessage()
+
+	// Act
+	err = client.Send(ctx, m)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrWriteLimitExceeded)
+	assert.True(t, client.Connected())
+	receiveCtx, receiveCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer receiveCancel()
+	_, err = server.Receive(receiveCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestTCPTransport_Send_WhenWithinWriteLimit(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	var transportChan = make(chan Transport, 1)
+	listener := createTCPListener(t, addr, transportChan)
+	defer silentClose(listener)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	client, err := DialTcp(ctx, addr, &TCPConfig{WriteLimit: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	m := createMessage()
+
+	// Act
+	err = client.Send(ctx, m)
+
+	// Assert
+	assert.NoError(t, err)
+	actual, err := server.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, m, actual)
+}
+
+func TestTCPTransport_PeerInfo_WithClientCertificate(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	listener := NewTCPTransportListener(&TCPConfig{
+		TLSConfig: &tls.Config{
+			GetCertificate: func(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return createCertificate("127.0.0.1")
+			},
+		},
+		ClientAuth: tls.RequireAnyClientCert,
+	})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	clientCert, err := createCertificate("client.localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := DialTcp(context.Background(), addr, &TCPConfig{TLSConfig: &tls.Config{
+		ServerName:         "127.0.0.1",
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{*clientCert},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	if err = doTLSHandshake(ctx, server, client); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	info, ok := server.PeerInfo()
+
+	// Assert
+	assert.True(t, ok)
+	assert.Equal(t, clientCert.Leaf.Subject.String(), info.Subject)
+	assert.Equal(t, []string{"client.localhost"}, info.DNSNames)
+	assert.Empty(t, info.Origin)
+}
+
+func TestTCPTransport_PeerInfo_WhenNotEncrypted(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	var transportChan = make(chan Transport, 1)
+	listener := createTCPListener(t, addr, transportChan)
+	defer silentClose(listener)
+	client := createClientTCPTransport(t, addr)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+
+	// Act
+	info, ok := server.PeerInfo()
+
+	// Assert
+	assert.False(t, ok)
+	assert.Zero(t, info)
+}
+
+func TestTCPTransport_Send_WhenUnixSocket(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := &net.UnixAddr{Name: filepath.Join(t.TempDir(), "lime.sock"), Net: "unix"}
+	var transportChan = make(chan Transport, 1)
+	listener := createTCPListener(t, addr, transportChan)
+	defer silentClose(listener)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	client, err := DialUnix(ctx, addr.Name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	m := createMessage()
+
+	// Act
+	err = client.Send(ctx, m)
+
+	// Assert
+	assert.NoError(t, err)
+	actual, err := server.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, m, actual)
+	assert.Equal(t, "unix", server.LocalAddr().Network())
+}
+
+func TestTCPTransportListener_AcceptFilter_WhenAddressIsNotAllowed(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	filtered := make(chan net.Addr, 1)
+	listener := NewTCPTransportListener(&TCPConfig{
+		AcceptFilter: func(conn net.Conn) bool {
+			filtered <- conn.RemoteAddr()
+			return !conn.RemoteAddr().(*net.TCPAddr).IP.IsLoopback()
+		},
+	})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	client := createClientTCPTransport(t, addr)
+	defer silentClose(client)
+
+	// Act
+	_, err := client.Receive(ctx)
+
+	// Assert
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, client.LocalAddr().String(), (<-filtered).String())
+	acceptCtx, acceptCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer acceptCancel()
+	_, err = listener.Accept(acceptCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestTCPTransportListener_AcceptFilter_WhenAddressIsAllowed(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	listener := NewTCPTransportListener(&TCPConfig{
+		AcceptFilter: func(conn net.Conn) bool {
+			return conn.RemoteAddr().(*net.TCPAddr).IP.IsLoopback()
+		},
+	})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	client := createClientTCPTransport(t, addr)
+	defer silentClose(client)
+
+	// Act
+	server, err := listener.Accept(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.NotNil(t, server) {
+		assert.NoError(t, server.Close())
+	}
+}
+
+func TestTCPTransport_Receive_WhenRecoverableDecoderAndGarbageFrame(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	var decodeErrs []error
+	var skipped int
+	listener := NewTCPTransportListener(&TCPConfig{
+		RecoverableDecoder: true,
+		OnDecodeError: func(err error, n int) {
+			decodeErrs = append(decodeErrs, err)
+			skipped += n
+		},
+	})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	client := createClientTCPTransport(t, createLocalhostTCPAddress())
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	garbage := `not a json {"id":"2","to":,"content":"}{"}`
+	data := `{"id":"1","to":"golang@limeprotocol.org","type":"text/plain","content":"Hello {world}"}` + "\n" +
+		garbage + "\n" +
+		`{"id":"3","to":"golang@limeprotocol.org","type":"text/plain","content":"Hello again"}` + "\n"
+	if _, err := client.(*tcpTransport).conn.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	e1, err1 := server.Receive(ctx)
+	e2, err2 := server.Receive(ctx)
+
+	// Assert
+	assert.NoError(t, err1)
+	assert.NoError(t, err2)
+	if assert.IsType(t, &Message{}, e1) {
+		assert.Equal(t, "1", e1.(*Message).ID)
+		assert.Equal(t, TextDocument("Hello {world}"), *e1.(*Message).Content.(*TextDocument))
+	}
+	if assert.IsType(t, &Message{}, e2) {
+		assert.Equal(t, "3", e2.(*Message).ID)
+	}
+	if assert.Len(t, decodeErrs, 2) {
+		assert.ErrorIs(t, decodeErrs[0], ErrMalformedFrame)
+		assert.ErrorIs(t, decodeErrs[1], ErrMalformedFrame)
+	}
+	assert.Equal(t, len(strings.ReplaceAll(garbage, " ", "")), skipped)
+}
+
+func TestTCPTransport_Receive_WhenRecoverableDecoderAndNonEnvelopeFrame(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	var decodeErrs []error
+	var skipped int
+	listener := NewTCPTransportListener(&TCPConfig{
+		RecoverableDecoder: true,
+		OnDecodeError: func(err error, n int) {
+			decodeErrs = append(decodeErrs, err)
+			skipped += n
+		},
+	})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	client := createClientTCPTransport(t, createLocalhostTCPAddress())
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	nonEnvelope := `{"foo":1}`
+	data := nonEnvelope + "\n" +
+		`{"id":"1","to":"golang@limeprotocol.org","type":"text/plain","content":"Hello world"}` + "\n"
+	if _, err := client.(*tcpTransport).conn.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	e, err := server.Receive(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	if assert.IsType(t, &Message{}, e) {
+		assert.Equal(t, "1", e.(*Message).ID)
+	}
+	if assert.Len(t, decodeErrs, 1) {
+		assert.ErrorIs(t, decodeErrs[0], ErrMalformedFrame)
+	}
+	assert.Equal(t, len(nonEnvelope), skipped)
+}
+
+func TestTCPTransport_Receive_WhenRecoverableDecoderAndOversizedFrame(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	addr := createLocalhostTCPAddress()
+	var decodeErr error
+	listener := NewTCPTransportListener(&TCPConfig{
+		ReadLimit:          128,
+		RecoverableDecoder: true,
+		OnDecodeError: func(err error, n int) {
+			decodeErr = err
+		},
+	})
+	if err := listener.Listen(context.Background(), addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	client := createClientTCPTransport(t, createLocalhostTCPAddress())
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	large := createMessage()
+	content := TextDocument(strings.Repeat("a", 256))
+	large.SetContent(&content)
+	msg := createMessage()
+	msg.ID = "2"
+
+	// Act
+	err := client.Send(ctx, large)
+	assert.NoError(t, err)
+	err = client.Send(ctx, msg)
+	assert.NoError(t, err)
+	e, err := server.Receive(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, msg, e)
+	assert.ErrorIs(t, decodeErr, ErrReadLimitExceeded)
+}
@@ -2,7 +2,9 @@ package lime
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -22,6 +24,52 @@ type Transport interface {
 	Connected() bool                                                // Connected indicates if the transport is connected.
 	LocalAddr() net.Addr                                            // LocalAddr returns the local endpoint address.
 	RemoteAddr() net.Addr                                           // RemoteAddr returns the remote endpoint address.
+	PeerInfo() (PeerInfo, bool)                                     // PeerInfo returns the identity information of the remote peer, if available.
+}
+
+// PeerInfo holds the identity information of the remote peer that is provided by a transport, like the values of
+// the TLS certificate presented by the peer.
+type PeerInfo struct {
+	Subject        string   // Subject is the distinguished name of the peer certificate subject.
+	DNSNames       []string // DNSNames are the DNS names in the peer certificate subject alternative names.
+	EmailAddresses []string // EmailAddresses are the emails in the peer certificate subject alternative names.
+	IPAddresses    []net.IP // IPAddresses are the IP addresses in the peer certificate subject alternative names.
+	URIs           []string // URIs are the URIs in the peer certificate subject alternative names.
+	Origin         string   // Origin is the HTTP origin of the websocket handshake request, in server transports.
+}
+
+// peerInfoFromTLS returns the peer information from the certificate presented by the peer in the TLS handshake.
+func peerInfoFromTLS(state tls.ConnectionState) (PeerInfo, bool) {
+	if len(state.PeerCertificates) == 0 {
+		return PeerInfo{}, false
+	}
+	cert := state.PeerCertificates[0]
+	info := PeerInfo{
+		Subject:        cert.Subject.String(),
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    cert.IPAddresses,
+	}
+	for _, u := range cert.URIs {
+		info.URIs = append(info.URIs, u.String())
+	}
+	return info, true
+}
+
+// ErrWriteLimitExceeded indicates that an envelope is larger than the write limit of the transport, and it was not
+// sent.
+var ErrWriteLimitExceeded = errors.New("lime: write limit exceeded")
+
+// ErrReadLimitExceeded indicates that a received envelope is larger than the read limit of the transport.
+var ErrReadLimitExceeded = errors.New("lime: read limit exceeded")
+
+// ErrMalformedFrame indicates that the received data is not a valid envelope.
+var ErrMalformedFrame = errors.New("lime: malformed frame")
+
+// HealthChecker is implemented by transports that can actively check the liveness of their connection.
+type HealthChecker interface {
+	// IsHealthy returns false if the connection is no longer usable, like when the remote peer is gone.
+	IsHealthy(ctx context.Context) bool
 }
 
 // TransportListener Defines a listener interface for the transports.
@@ -29,6 +77,32 @@ type TransportListener interface {
 	io.Closer
 	Listen(ctx context.Context, addr net.Addr) error // Listen start listening for new transport connections.
 	Accept(ctx context.Context) (Transport, error)   // Accept a new transport connection.
+	Addr() net.Addr                                  // Addr returns the effective listening address or nil if the listener is not started.
+}
+
+// BatchTransportListener defines a listener that supports accepting the available transport connections in batches.
+type BatchTransportListener interface {
+	TransportListener
+	// AcceptN awaits for a new transport connection and returns it along with the other connections that are
+	// already available, up to the max value, without blocking for more.
+	AcceptN(ctx context.Context, max int) ([]Transport, error)
+}
+
+// AcceptN accepts up to max transport connections from the listener, without blocking after the first one.
+// If the listener implements the BatchTransportListener interface, its AcceptN method is used; otherwise, a single
+// transport is accepted through the Accept method.
+func AcceptN(ctx context.Context, l TransportListener, max int) ([]Transport, error) {
+	if max <= 0 {
+		panic("max must be positive")
+	}
+	if bl, ok := l.(BatchTransportListener); ok {
+		return bl.AcceptN(ctx, max)
+	}
+	t, err := l.Accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []Transport{t}, nil
 }
 
 // TraceWriter Enable request tracing for network transports.
@@ -0,0 +1,147 @@
+package lime
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// watchdogMetadataKey identifies the notifications sent by the client watchdog, which are echoed back by the servers
+// with the watchdog echo enabled.
+const watchdogMetadataKey = "#watchdog"
+
+func newWatchdogNotification() *Notification {
+	not := &Notification{Event: NotificationEventReceived}
+	not.SetNewEnvelopeID()
+	not.SetMetadataKeyValue(watchdogMetadataKey, "ping")
+	return not
+}
+
+func isWatchdogNotification(not *Notification) bool {
+	_, ok := not.Metadata[watchdogMetadataKey]
+	return ok
+}
+
+// watchdogEchoTimeout is the maximum time for echoing back a watchdog notification, since it is sent by the receiver
+// goroutine.
+const watchdogEchoTimeout = time.Second
+
+// handlesWatchdog indicates if the channel should handle the received watchdog notifications, which is when the
+// client watchdog is sending them or when the echo is enabled in server channels. Otherwise, they are delivered as
+// regular notifications.
+func (c *channel) handlesWatchdog() bool {
+	if c.client {
+		return atomic.LoadInt32(&c.watchdog) == 1
+	}
+	return c.echoWatchdog
+}
+
+// handleWatchdog handles a watchdog notification received by the channel, echoing it back in server channels or
+// registering the echo in client channels.
+func (c *channel) handleWatchdog(ctx context.Context, not *Notification) {
+	if c.client {
+		atomic.StoreInt64(&c.watchdogEcho, time.Now().UnixNano())
+		return
+	}
+
+	echo := &Notification{
+		Envelope: Envelope{
+			ID:       not.ID,
+			From:     c.localNode,
+			To:       not.From,
+			Metadata: not.Metadata,
+		},
+		Event: not.Event,
+	}
+	ctx, cancel := context.WithTimeout(ctx, watchdogEchoTimeout)
+	defer cancel()
+	if err := c.sendToTransport(ctx, echo, "echo watchdog"); err != nil {
+		log.Printf("handleWatchdog: %v", err)
+	}
+}
+
+// lastWatchdogEcho returns the time of the last watchdog echo received by the channel, in Unix nanoseconds.
+func (c *channel) lastWatchdogEcho() int64 {
+	return atomic.LoadInt64(&c.watchdogEcho)
+}
+
+// EnableWatchdog starts sending watchdog notifications to the server in the specified interval, expecting them to be
+// echoed back. If the echo is not received during the timeout, the channel is closed and the client reconnects.
+// It is a lightweight alternative to ping commands, but requires the server to have the watchdog echo enabled.
+// Calling it again restarts the watchdog with the new values.
+func (c *Client) EnableWatchdog(interval, timeout time.Duration) {
+	if interval <= 0 {
+		panic("interval must be positive")
+	}
+	if timeout <= 0 {
+		panic("timeout must be positive")
+	}
+
+	c.stopWatchdog()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	c.watchdogMu.Lock()
+	c.watchdogCancel = cancel
+	c.watchdogDone = done
+	c.watchdogMu.Unlock()
+
+	go func() {
+		defer close(done)
+		c.watchdog(ctx, interval, timeout)
+	}()
+}
+
+func (c *Client) stopWatchdog() {
+	c.watchdogMu.Lock()
+	cancel, done := c.watchdogCancel, c.watchdogDone
+	c.watchdogCancel, c.watchdogDone = nil, nil
+	c.watchdogMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+func (c *Client) watchdog(ctx context.Context, interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var current *ClientChannel
+	var sentAt time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		channel, ok := c.Channel()
+		if !ok {
+			current = nil
+			continue
+		}
+		if channel != current {
+			current = channel
+			sentAt = time.Time{}
+			atomic.StoreInt32(&channel.watchdog, 1)
+		}
+
+		// Awaiting for the echo of the last notification
+		if !sentAt.IsZero() && channel.lastWatchdogEcho() < sentAt.UnixNano() {
+			if time.Since(sentAt) >= timeout {
+				log.Printf("client: watchdog: no echo received in %v, closing the channel", timeout)
+				_ = channel.Close()
+				current = nil
+			}
+			continue
+		}
+
+		sentAt = time.Now()
+		if err := channel.SendNotification(ctx, newWatchdogNotification()); err != nil {
+			log.Printf("client: watchdog: %v", err)
+		}
+	}
+}
@@ -3,15 +3,18 @@ package lime
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"go.uber.org/multierr"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -42,10 +45,38 @@ func DialWebsocket(ctx context.Context, urlStr string, requestHeader http.Header
 	return t, nil
 }
 
+// websocketCloseWriteTimeout is the maximum time for sending the close frame when closing a websocket transport.
+const websocketCloseWriteTimeout = time.Second
+
 type websocketTransport struct {
-	conn *websocket.Conn
-	c    SessionCompression
-	e    SessionEncryption
+	conn       *websocket.Conn
+	c          SessionCompression
+	e          SessionEncryption
+	closeGrace time.Duration // closeGrace is the time to wait for the close handshake reply of the remote party
+	readMu     sync.Mutex    // readMu is held during the read operations, which can't be concurrent
+	lastPong   int64         // lastPong is the time of the last pong received from the remote party, in Unix nanoseconds
+	pingStop   chan struct{} // pingStop is closed for stopping the ping goroutine, if started
+	pingDone   chan struct{} // pingDone is closed by the ping goroutine on its end
+	strict     bool          // strict indicates if the envelopes with unknown fields should be rejected
+	writeLimit int64         // writeLimit is the maximum size of the sent envelopes, if greater than zero
+	origin     string        // origin is the HTTP origin of the handshake request, in server transports
+	msgType    int           // msgType is the type of the websocket frames used for sending the envelopes
+}
+
+// WebsocketMessageType defines the type of the websocket frames used by the transports for sending the envelopes.
+type WebsocketMessageType int
+
+const (
+	// WebsocketMessageTypeText sends the envelopes in text frames, which is the default for the JSON encoding.
+	WebsocketMessageTypeText = WebsocketMessageType(websocket.TextMessage)
+	// WebsocketMessageTypeBinary sends the envelopes in binary frames.
+	WebsocketMessageTypeBinary = WebsocketMessageType(websocket.BinaryMessage)
+)
+
+// acceptedConn is a websocket connection accepted by a server, with the values of its handshake request.
+type acceptedConn struct {
+	conn   *websocket.Conn
+	origin string
 }
 
 func (t *websocketTransport) Send(ctx context.Context, e envelope) error {
@@ -61,9 +92,25 @@ func (t *websocketTransport) Send(ctx context.Context, e envelope) error {
 		return err
 	}
 
+	write := func() error {
+		return t.writeJSON(e)
+	}
+	if t.writeLimit > 0 {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("ws transport: send: %w", err)
+		}
+		if int64(len(b)) > t.writeLimit {
+			return fmt.Errorf("ws transport: send: %w: the envelope has %v bytes", ErrWriteLimitExceeded, len(b))
+		}
+		write = func() error {
+			return t.conn.WriteMessage(t.messageType(), b)
+		}
+	}
+
 	errChan := make(chan error)
 	go func() {
-		errChan <- t.conn.WriteJSON(e)
+		errChan <- write()
 	}()
 
 	select {
@@ -90,11 +137,15 @@ func (t *websocketTransport) Receive(ctx context.Context) (envelope, error) {
 		return nil, err
 	}
 
+	conn := t.conn
 	rawChan := make(chan rawEnvelope)
 	errChan := make(chan error)
 	go func() {
+		t.readMu.Lock()
+		defer t.readMu.Unlock()
+
 		var raw rawEnvelope
-		if err := t.conn.ReadJSON(&raw); err != nil {
+		if err := t.readJSON(conn, &raw); err != nil {
 			errChan <- err
 		} else {
 			rawChan <- raw
@@ -105,7 +156,7 @@ func (t *websocketTransport) Receive(ctx context.Context) (envelope, error) {
 	case <-ctx.Done():
 		// Effectively fails all pending read operations before returning.
 		// Note that this makes the decoder to be in a permanent error state.
-		_ = t.conn.SetReadDeadline(time.Now())
+		_ = conn.SetReadDeadline(time.Now())
 		// wait for the error of the envelope result (which will be discarded)
 		select {
 		case <-errChan:
@@ -119,14 +170,128 @@ func (t *websocketTransport) Receive(ctx context.Context) (envelope, error) {
 	}
 }
 
+// writeJSON works like the websocket.Conn WriteJSON method, except that the configured message type is used.
+func (t *websocketTransport) writeJSON(v interface{}) error {
+	w, err := t.conn.NextWriter(t.messageType())
+	if err != nil {
+		return err
+	}
+	err1 := json.NewEncoder(w).Encode(v)
+	err2 := w.Close()
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
+
+// messageType returns the configured websocket message type, which is text by default.
+func (t *websocketTransport) messageType() int {
+	if t.msgType == 0 {
+		return websocket.TextMessage
+	}
+	return t.msgType
+}
+
+// readJSON reads the next message of the connection, decoding it in the specified value.
+// It works like the websocket.Conn ReadJSON method, except that the unknown fields are rejected in strict mode.
+func (t *websocketTransport) readJSON(conn *websocket.Conn, v interface{}) error {
+	if !t.strict {
+		return conn.ReadJSON(v)
+	}
+
+	_, r, err := conn.NextReader()
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(v)
+	if err == io.EOF {
+		// One value is expected in the message.
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Close sends a close frame with the normal closure status code to the remote party and closes the connection.
+// If a close grace period is defined, it awaits for the remote party close frame reply during this period before
+// closing the connection.
 func (t *websocketTransport) Close() error {
 	if err := t.ensureOpen(); err != nil {
 		return err
 	}
 
-	err := t.conn.Close()
+	conn := t.conn
 	t.conn = nil
-	return err
+	t.stopPing()
+
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(websocketCloseWriteTimeout))
+	if err == nil && t.closeGrace > 0 {
+		// The deadline also stops any pending read, which receives the reply otherwise
+		_ = conn.SetReadDeadline(time.Now().Add(t.closeGrace))
+		t.readMu.Lock()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				break
+			}
+		}
+		t.readMu.Unlock()
+	}
+
+	return conn.Close()
+}
+
+// startPing starts sending ping frames to the remote party in the specified interval, closing the connection if
+// a pong is not received during the timeout after a ping. Note that the pongs are processed only by the read
+// operations, so the transport is expected to be receiving.
+func (t *websocketTransport) startPing(interval, timeout time.Duration) {
+	conn := t.conn
+	t.pingStop = make(chan struct{})
+	t.pingDone = make(chan struct{})
+	conn.SetPongHandler(func(string) error {
+		atomic.StoreInt64(&t.lastPong, time.Now().UnixNano())
+		return nil
+	})
+
+	go func() {
+		defer close(t.pingDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var pingAt time.Time
+		for {
+			select {
+			case <-t.pingStop:
+				return
+			case <-ticker.C:
+			}
+
+			// Awaiting for the pong of the last ping
+			if timeout > 0 && !pingAt.IsZero() && atomic.LoadInt64(&t.lastPong) < pingAt.UnixNano() {
+				if time.Since(pingAt) >= timeout {
+					log.Printf("ws transport: no pong received in %v, closing the connection", timeout)
+					_ = conn.Close()
+					return
+				}
+				continue
+			}
+
+			pingAt = time.Now()
+			if err := conn.WriteControl(websocket.PingMessage, nil, pingAt.Add(interval)); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+func (t *websocketTransport) stopPing() {
+	if t.pingStop != nil {
+		close(t.pingStop)
+		<-t.pingDone
+		t.pingStop = nil
+	}
 }
 
 func (t *websocketTransport) SupportedCompression() []SessionCompression {
@@ -171,6 +336,32 @@ func (t *websocketTransport) RemoteAddr() net.Addr {
 	return t.conn.RemoteAddr()
 }
 
+// PeerInfo returns the values of the certificate presented by the remote peer during the TLS handshake and, in server
+// transports, the HTTP origin of the handshake request. It returns false if none of them is available.
+func (t *websocketTransport) PeerInfo() (PeerInfo, bool) {
+	var info PeerInfo
+	var ok bool
+	if state, tlsOK := t.ConnectionState(); tlsOK {
+		info, ok = peerInfoFromTLS(state)
+	}
+	if t.origin != "" {
+		info.Origin = t.origin
+		ok = true
+	}
+	return info, ok
+}
+
+// ConnectionState returns the state of the TLS connection, or false if the transport is not encrypted.
+func (t *websocketTransport) ConnectionState() (tls.ConnectionState, bool) {
+	if t.conn == nil {
+		return tls.ConnectionState{}, false
+	}
+	if tlsConn, ok := t.conn.UnderlyingConn().(*tls.Conn); ok {
+		return tlsConn.ConnectionState(), true
+	}
+	return tls.ConnectionState{}, false
+}
+
 func (t *websocketTransport) ensureOpen() error {
 	if t.conn == nil {
 		return errors.New("transport is not open")
@@ -193,6 +384,53 @@ type WebsocketConfig struct {
 	// A CheckOrigin function should carefully validate the request origin to
 	// prevent cross-site request forgery.
 	CheckOrigin func(r *http.Request) bool
+
+	// CloseGracePeriod defines how long the server transports await for the close frame reply of the remote party
+	// when closed, allowing the websocket close handshake to be completed. A zero value means that the connection
+	// is closed right after sending the close frame.
+	CloseGracePeriod time.Duration
+
+	// ReadLimit defines the maximum size in bytes of the messages received by the server transports.
+	// If a message exceeds the limit, the connection is closed. If zero, the DefaultReadLimit value is used.
+	ReadLimit int64
+
+	// PingInterval defines the interval for sending ping frames to the clients by the server transports.
+	// A zero value disables the pings.
+	PingInterval time.Duration
+
+	// PongTimeout defines how long the server transports await for the pong reply of a ping before closing the
+	// connection. A zero value means that the pongs are not verified.
+	PongTimeout time.Duration
+
+	// StrictDecoding indicates if the envelopes with unknown fields received by the server transports should be
+	// rejected, allowing the detection of protocol drifts. The transport fails to receive when an unknown field is
+	// found.
+	StrictDecoding bool
+
+	// WriteLimit defines the maximum size in bytes of the envelopes sent by the server transports. The envelopes that
+	// exceed the limit are not written to the connection and the send fails with ErrWriteLimitExceeded. If zero, the
+	// size is not limited.
+	WriteLimit int64
+
+	// MessageType defines the type of the websocket frames used by the server transports for sending the envelopes.
+	// If zero, the WebsocketMessageTypeText value is used. The received envelopes are accepted in both types.
+	MessageType WebsocketMessageType
+
+	// AcceptFilter is called by the listeners for each connection request, before the websocket upgrade, allowing
+	// the rejection of requests by its remote address or headers, for instance. If it returns false, the request is
+	// replied with the 403 (Forbidden) status, without a session. It is called before the CheckOrigin function.
+	AcceptFilter func(r *http.Request) bool
+
+	// HealthPath defines the HTTP path of a health check endpoint, like '/healthz', that is served by the listener
+	// along with the websocket upgrade handler. The endpoint responds with 200 (OK) while the listener is accepting
+	// connections and 503 (Service Unavailable) while it is draining. If empty, the endpoint is not served.
+	HealthPath string
+
+	// DrainPeriod defines the time that the listener keeps serving HTTP requests after being closed, before stopping
+	// the HTTP server. While draining, the health endpoint responds with 503 (Service Unavailable) and the new
+	// connection requests are refused with the same status, allowing load balancers to notice the shutdown.
+	// The Close method blocks for the period. If zero, the server is stopped right away.
+	DrainPeriod time.Duration
 }
 
 type websocketTransportListener struct {
@@ -200,8 +438,9 @@ type websocketTransportListener struct {
 	listener net.Listener
 	srv      *http.Server
 	upgrader *websocket.Upgrader
-	connChan chan *websocket.Conn
-	done     chan struct{}
+	connChan chan acceptedConn
+	done     chan struct{} // done is closed when the listener starts draining
+	closing  bool          // closing indicates that the listener is being closed
 	mu       sync.RWMutex
 }
 
@@ -216,7 +455,7 @@ func (l *websocketTransportListener) Listen(ctx context.Context, addr net.Addr)
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	if l.srv != nil {
+	if l.srv != nil || l.closing {
 		return errors.New("ws listener already started")
 	}
 
@@ -232,12 +471,8 @@ func (l *websocketTransportListener) Listen(ctx context.Context, addr net.Addr)
 		TLSConfig: l.TLSConfig,
 	}
 	l.srv = srv
-	l.upgrader = &websocket.Upgrader{
-		Subprotocols:      []string{"lime"},
-		EnableCompression: l.EnableCompression,
-		CheckOrigin:       l.CheckOrigin,
-	}
-	l.connChan = make(chan *websocket.Conn, l.ConnBuffer)
+	l.upgrader = newWebsocketUpgrader(&l.WebsocketConfig)
+	l.connChan = make(chan acceptedConn, l.ConnBuffer)
 	l.done = make(chan struct{})
 	go func() {
 		if l.tls() {
@@ -268,37 +503,95 @@ func (l *websocketTransportListener) Accept(ctx context.Context) (Transport, err
 		return nil, fmt.Errorf("ws listener: %w", ctx.Err())
 	case <-l.done:
 		return nil, errors.New("ws listener closed")
-	case conn := <-l.connChan:
-		ws := &websocketTransport{
-			conn: conn,
-			c:    SessionCompressionNone,
-		}
-		if l.tls() {
-			ws.e = SessionEncryptionTLS
-		} else {
-			ws.e = SessionEncryptionNone
-		}
-
+	case c := <-l.connChan:
+		ws := newServerWebsocketTransport(c.conn, l.tls(), &l.WebsocketConfig)
+		ws.origin = c.origin
 		return ws, nil
 	}
 }
 
+func newWebsocketUpgrader(config *WebsocketConfig) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		Subprotocols:      []string{"lime"},
+		EnableCompression: config.EnableCompression,
+		CheckOrigin:       config.CheckOrigin,
+	}
+}
+
+func newServerWebsocketTransport(conn *websocket.Conn, tls bool, config *WebsocketConfig) *websocketTransport {
+	ws := &websocketTransport{
+		conn:       conn,
+		c:          SessionCompressionNone,
+		closeGrace: config.CloseGracePeriod,
+		strict:     config.StrictDecoding,
+		writeLimit: config.WriteLimit,
+		msgType:    int(config.MessageType),
+	}
+	if tls {
+		ws.e = SessionEncryptionTLS
+	} else {
+		ws.e = SessionEncryptionNone
+	}
+
+	readLimit := config.ReadLimit
+	if readLimit == 0 {
+		readLimit = DefaultReadLimit
+	}
+	conn.SetReadLimit(readLimit)
+	if config.PingInterval > 0 {
+		ws.startPing(config.PingInterval, config.PongTimeout)
+	}
+	return ws
+}
+
 func (l *websocketTransportListener) Close() error {
 	l.mu.Lock()
-	defer l.mu.Unlock()
-
-	if l.srv == nil {
+	if l.srv == nil || l.closing {
+		l.mu.Unlock()
 		return errors.New("ws listener: listener is not started")
 	}
-
+	l.closing = true
 	close(l.done)
+	l.mu.Unlock()
+
+	// Keeps serving the requests while draining, so the health checks can notice it
+	if l.DrainPeriod > 0 {
+		time.Sleep(l.DrainPeriod)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	listErr := l.listener.Close()
 	srvErr := l.srv.Close()
 	l.srv = nil
+	l.closing = false
 
 	return multierr.Combine(listErr, srvErr)
 }
 
+func (l *websocketTransportListener) Addr() net.Addr {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.srv == nil {
+		return nil
+	}
+	return l.listener.Addr()
+}
+
+func (l *websocketTransportListener) serveHealth(writer http.ResponseWriter) {
+	status := http.StatusOK
+	select {
+	case <-l.done:
+		status = http.StatusServiceUnavailable
+	default:
+	}
+
+	writer.WriteHeader(status)
+	_, _ = writer.Write([]byte(http.StatusText(status)))
+}
+
 func (l *websocketTransportListener) ensureStarted() error {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
@@ -310,6 +603,22 @@ func (l *websocketTransportListener) ensureStarted() error {
 }
 
 func (l *websocketTransportListener) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if l.HealthPath != "" && request.URL.Path == l.HealthPath {
+		l.serveHealth(writer)
+		return
+	}
+
+	select {
+	case <-l.done:
+		http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	if !acceptRequest(&l.WebsocketConfig, writer, request) {
+		return
+	}
+
 	conn, err := l.upgrader.Upgrade(writer, request, nil)
 	if err != nil {
 		log.Printf("ws listener: serveHTTP: %v\n", err)
@@ -318,6 +627,110 @@ func (l *websocketTransportListener) ServeHTTP(writer http.ResponseWriter, reque
 
 	select {
 	case <-l.done:
-	case l.connChan <- conn:
+		_ = conn.Close()
+	case l.connChan <- acceptedConn{conn: conn, origin: request.Header.Get("Origin")}:
+	}
+}
+
+// acceptRequest checks the connection request with the AcceptFilter function, replying it with the 403 (Forbidden)
+// status if rejected.
+func acceptRequest(config *WebsocketConfig, writer http.ResponseWriter, request *http.Request) bool {
+	if config.AcceptFilter == nil || config.AcceptFilter(request) {
+		return true
 	}
+	http.Error(writer, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	return false
+}
+
+// WebsocketHandler is a http.Handler that upgrades the received requests to websocket transport connections,
+// allowing the LIME websocket transport to be mounted in an existing HTTP server, like in a http.ServeMux path.
+// It also implements the TransportListener interface, so it can be used as a Server listener through the
+// NewBoundListener function. In this case, the address is used only for identification, since the handler do not
+// own the network listener.
+//
+// The HTTP server lifetime is not managed by the handler. Closing it stops the acceptance of new connections, which
+// are refused with the 503 (Service Unavailable) status, but the already accepted transports are not affected and
+// should be closed by its owners.
+type WebsocketHandler struct {
+	upgrader  *websocket.Upgrader
+	config    WebsocketConfig
+	connChan  chan acceptedConn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewWebsocketHandler creates a new WebsocketHandler with the specified configuration.
+// The TLSConfig and HealthPath values are not used by the handler, since the HTTP server is owned by the caller.
+func NewWebsocketHandler(config *WebsocketConfig) *WebsocketHandler {
+	if config == nil {
+		config = &WebsocketConfig{}
+	}
+	return &WebsocketHandler{
+		upgrader: newWebsocketUpgrader(config),
+		config:   *config,
+		connChan: make(chan acceptedConn, config.ConnBuffer),
+		done:     make(chan struct{}),
+	}
+}
+
+func (h *WebsocketHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	select {
+	case <-h.done:
+		http.Error(writer, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	if !acceptRequest(&h.config, writer, request) {
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		log.Printf("ws handler: serveHTTP: %v\n", err)
+		return
+	}
+
+	select {
+	case <-h.done:
+		_ = conn.Close()
+	case h.connChan <- acceptedConn{conn: conn, origin: request.Header.Get("Origin")}:
+	}
+}
+
+// Listen does nothing, since the handler connections are served by the caller HTTP server.
+func (h *WebsocketHandler) Listen(context.Context, net.Addr) error {
+	return nil
+}
+
+// Accept awaits for a new websocket transport connection.
+func (h *WebsocketHandler) Accept(ctx context.Context) (Transport, error) {
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("ws handler: %w", ctx.Err())
+	case <-h.done:
+		return nil, errors.New("ws handler closed")
+	case c := <-h.connChan:
+		ws := newServerWebsocketTransport(c.conn, isTLSConn(c.conn.UnderlyingConn()), &h.config)
+		ws.origin = c.origin
+		return ws, nil
+	}
+}
+
+// Addr returns nil, since the handler do not own the network listener.
+func (h *WebsocketHandler) Addr() net.Addr {
+	return nil
+}
+
+// Close stops the acceptance of new connections.
+func (h *WebsocketHandler) Close() error {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+	return nil
+}
+
+func isTLSConn(conn net.Conn) bool {
+	_, ok := conn.(*tls.Conn)
+	return ok
 }
@@ -3,10 +3,16 @@ package lime
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/goleak"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -215,6 +221,43 @@ func TestWebsocketTransport_Close_WhenAlreadyClosed(t *testing.T) {
 	assert.Equal(t, "transport is not open", err.Error())
 }
 
+func TestWebsocketTransport_Close_SendsCloseFrame(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr := createLocalhostWSAddr()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{CloseGracePeriod: time.Second})
+	if err := listener.Listen(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	url := fmt.Sprintf("ws://%s", addr)
+	client := createClientWebsocketTransport(ctx, t, url)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := client.Receive(ctx)
+		errChan <- err
+	}()
+	start := time.Now()
+
+	// Act
+	err := server.Close()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	rcvErr := <-errChan
+	assert.True(t, websocket.IsCloseError(errors.Unwrap(rcvErr), websocket.CloseNormalClosure))
+	err = server.Close()
+	assert.Error(t, err)
+	assert.Equal(t, "transport is not open", err.Error())
+}
+
 func TestWebsocketTransport_SetEncryption_None(t *testing.T) {
 	// Arrange
 	defer goleak.VerifyNone(t)
@@ -340,6 +383,113 @@ func TestWebsocketTransport_Receive_Session(t *testing.T) {
 	assert.Equal(t, s, received)
 }
 
+func TestWebsocketTransport_Receive_WhenReadLimitExceeded(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr := createLocalhostWSAddr()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{ReadLimit: 512})
+	if err := listener.Listen(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	url := fmt.Sprintf("ws://%s", addr)
+	client := createClientWebsocketTransport(ctx, t, url)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	msg := createMessage()
+	msg.SetContent(TextDocument(strings.Repeat("a", 1024)))
+	if err := client.Send(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	e, err := server.Receive(ctx)
+
+	// Assert
+	assert.Nil(t, e)
+	assert.ErrorIs(t, err, websocket.ErrReadLimit)
+}
+
+func TestWebsocketTransport_Receive_WhenPongTimeout(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr := createLocalhostWSAddr()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{
+		PingInterval: 10 * time.Millisecond,
+		PongTimeout:  20 * time.Millisecond,
+	})
+	if err := listener.Listen(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	url := fmt.Sprintf("ws://%s", addr)
+	// The client doesn't reply the pings, since it is not receiving
+	client := createClientWebsocketTransport(ctx, t, url)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+
+	// Act
+	e, err := server.Receive(ctx)
+
+	// Assert
+	assert.Nil(t, e)
+	assert.Error(t, err)
+	assert.NoError(t, ctx.Err())
+}
+
+func TestWebsocketTransport_Receive_WhenPongReceived(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	addr := createLocalhostWSAddr()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{
+		PingInterval: 10 * time.Millisecond,
+		PongTimeout:  20 * time.Millisecond,
+	})
+	if err := listener.Listen(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	url := fmt.Sprintf("ws://%s", addr)
+	client := createClientWebsocketTransport(ctx, t, url)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	rcvCtx, rcvCancel := context.WithCancel(ctx)
+	rcvDone := make(chan struct{})
+	go func() {
+		defer close(rcvDone)
+		// Receiving allows the client to reply the pings
+		_, _ = client.Receive(rcvCtx)
+	}()
+	msg := createMessage()
+	time.AfterFunc(100*time.Millisecond, func() {
+		_ = client.Send(ctx, msg)
+	})
+
+	// Act
+	e, err := server.Receive(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, msg, e)
+	rcvCancel()
+	<-rcvDone
+}
+
 func TestWebsocketTransport_Receive_SessionTLS(t *testing.T) {
 	// Arrange
 	defer goleak.VerifyNone(t)
@@ -477,3 +627,383 @@ func BenchmarkWebsocketTransport_Send_MessageTLS(b *testing.B) {
 		break
 	}
 }
+
+func TestWebsocketTransportListener_HealthPath(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{HealthPath: "/healthz"})
+	err := listener.Listen(ctx, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	url := fmt.Sprintf("http://%s/healthz", listener.Addr())
+
+	// Act
+	resp, err := client.Get(url)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_ = resp.Body.Close()
+	assert.NoError(t, listener.Close())
+	_, err = client.Get(url)
+	assert.Error(t, err)
+}
+
+func TestWebsocketTransportListener_HealthPath_WhenDraining(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{
+		HealthPath:  "/healthz",
+		DrainPeriod: 200 * time.Millisecond,
+	})
+	err := listener.Listen(ctx, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	url := fmt.Sprintf("http://%s/healthz", listener.Addr())
+	wsURL := fmt.Sprintf("ws://%s", listener.Addr())
+	closeErr := make(chan error, 1)
+
+	// Act
+	go func() {
+		closeErr <- listener.Close()
+	}()
+
+	// Assert
+	assert.Eventually(t, func() bool {
+		resp, err := client.Get(url)
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode == http.StatusServiceUnavailable
+	}, 150*time.Millisecond, 10*time.Millisecond)
+	_, err = DialWebsocket(ctx, wsURL, nil, nil)
+	assert.Error(t, err)
+	select {
+	case <-ctx.Done():
+		assert.FailNow(t, "close timeout")
+	case err = <-closeErr:
+		assert.NoError(t, err)
+	}
+	_, err = client.Get(url)
+	assert.Error(t, err)
+}
+
+func TestWebsocketHandler_EstablishSession(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	handler := NewWebsocketHandler(nil)
+	mux := http.NewServeMux()
+	mux.Handle("/lime", handler)
+	httpSrv := httptest.NewServer(mux)
+	defer httpSrv.Close()
+	config := NewServerConfig()
+	config.SchemeOpts = []AuthenticationScheme{AuthenticationSchemeGuest}
+	srv := NewServer(config, &EnvelopeMux{}, NewBoundListener(handler, httpSrv.Listener.Addr()))
+	defer silentClose(srv)
+	go func() {
+		_ = srv.ListenAndServe()
+	}()
+	transport, err := DialWebsocket(ctx, fmt.Sprintf("ws://%s/lime", httpSrv.Listener.Addr()), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(transport)
+	channel := NewClientChannel(transport, 1)
+	defer silentClose(channel)
+
+	// Act
+	ses, err := channel.EstablishSession(
+		ctx,
+		func([]SessionCompression) SessionCompression {
+			return SessionCompressionNone
+		},
+		func([]SessionEncryption) SessionEncryption {
+			return SessionEncryptionNone
+		},
+		Identity{
+			Name:   NewEnvelopeID(),
+			Domain: "localhost",
+		},
+		func([]AuthenticationScheme, Authentication) Authentication {
+			return &GuestAuthentication{}
+		},
+		"default")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, SessionStateEstablished, ses.State)
+}
+
+func TestWebsocketHandler_ServeHTTP_WhenClosed(t *testing.T) {
+	// Arrange
+	handler := NewWebsocketHandler(nil)
+	_ = handler.Close()
+	recorder := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/lime", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
+
+func TestWebsocketTransport_Receive_WhenUnknownFieldAndStrictDecoding(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr := createLocalhostWSAddr()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{StrictDecoding: true})
+	if err := listener.Listen(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	url := fmt.Sprintf("ws://%s", addr)
+	client := createClientWebsocketTransport(ctx, t, url)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	if err := client.(*websocketTransport).conn.WriteMessage(websocket.TextMessage, []byte(unknownFieldMessageJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	e, err := server.Receive(ctx)
+
+	// Assert
+	assert.Nil(t, e)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown field")
+	}
+}
+
+func TestWebsocketTransport_Receive_WhenUnknownField(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr := createLocalhostWSAddr()
+	var transportChan = make(chan Transport, 1)
+	listener := createWebsocketListener(ctx, t, addr, transportChan)
+	defer silentClose(listener)
+	url := fmt.Sprintf("ws://%s", addr)
+	client := createClientWebsocketTransport(ctx, t, url)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	if err := client.(*websocketTransport).conn.WriteMessage(websocket.TextMessage, []byte(unknownFieldMessageJSON)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	e, err := server.Receive(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	msg, ok := e.(*Message)
+	if assert.True(t, ok) {
+		assert.Equal(t, "1", msg.ID)
+	}
+}
+
+func TestWebsocketTransport_Send_WhenWriteLimitExceeded(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr := createLocalhostWSAddr()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{WriteLimit: 64})
+	if err := listener.Listen(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	url := fmt.Sprintf("ws://%s", addr)
+	client := createClientWebsocketTransport(ctx, t, url)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+
+	// Act
+	err := server.Send(ctx, createMessage())
+
+	// Assert
+	assert.ErrorIs(t, err, ErrWriteLimitExceeded)
+	assert.True(t, server.Connected())
+}
+
+func TestWebsocketTransport_Send_WhenWithinWriteLimit(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr := createLocalhostWSAddr()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{WriteLimit: 1024})
+	if err := listener.Listen(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	url := fmt.Sprintf("ws://%s", addr)
+	client := createClientWebsocketTransport(ctx, t, url)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	m := createMessage()
+
+	// Act
+	err := server.Send(ctx, m)
+
+	// Assert
+	assert.NoError(t, err)
+	actual, err := client.Receive(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, m, actual)
+}
+
+func TestWebsocketTransport_PeerInfo_WithOrigin(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr := createLocalhostWSAddr()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	})
+	if err := listener.Listen(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	client, err := DialWebsocket(ctx, fmt.Sprintf("ws://%s", addr), http.Header{"Origin": {"https://app.limeprotocol.org"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+
+	// Act
+	info, ok := server.PeerInfo()
+
+	// Assert
+	assert.True(t, ok)
+	assert.Equal(t, "https://app.limeprotocol.org", info.Origin)
+	assert.Empty(t, info.Subject)
+	_, ok = client.PeerInfo()
+	assert.False(t, ok)
+}
+
+func TestWebsocketTransport_Send_WhenBinaryMessageType(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr := createLocalhostWSAddr()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{MessageType: WebsocketMessageTypeBinary})
+	if err := listener.Listen(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	url := fmt.Sprintf("ws://%s", addr)
+	client := createClientWebsocketTransport(ctx, t, url)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	m := createMessage()
+
+	// Act
+	err := server.Send(ctx, m)
+
+	// Assert
+	assert.NoError(t, err)
+	msgType, b, err := client.(*websocketTransport).conn.ReadMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.BinaryMessage, msgType)
+	var raw rawEnvelope
+	if assert.NoError(t, json.Unmarshal(b, &raw)) {
+		actual, err := raw.toEnvelope()
+		assert.NoError(t, err)
+		assert.Equal(t, m, actual)
+	}
+}
+
+func TestWebsocketTransport_Receive_WhenBinaryMessageType(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr := createLocalhostWSAddr()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{MessageType: WebsocketMessageTypeBinary})
+	if err := listener.Listen(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	var transportChan = make(chan Transport, 1)
+	listenTransports(transportChan, listener)
+	url := fmt.Sprintf("ws://%s", addr)
+	client := createClientWebsocketTransport(ctx, t, url)
+	defer silentClose(client)
+	server := receiveTransport(t, transportChan)
+	defer silentClose(server)
+	m := createMessage()
+	if err := server.Send(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+
+	// Act
+	actual, err := client.Receive(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, m, actual)
+}
+
+func TestWebsocketTransportListener_AcceptFilter_WhenAddressIsNotAllowed(t *testing.T) {
+	// Arrange
+	defer goleak.VerifyNone(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	addr := createLocalhostWSAddr()
+	listener := NewWebsocketTransportListener(&WebsocketConfig{
+		AcceptFilter: func(r *http.Request) bool {
+			host, _, _ := net.SplitHostPort(r.RemoteAddr)
+			return !net.ParseIP(host).IsLoopback()
+		},
+	})
+	if err := listener.Listen(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	defer silentClose(listener)
+	url := fmt.Sprintf("ws://%s", addr)
+
+	// Act
+	client, err := DialWebsocket(ctx, url, nil, nil)
+
+	// Assert
+	assert.ErrorIs(t, err, websocket.ErrBadHandshake)
+	assert.Nil(t, client)
+	acceptCtx, acceptCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer acceptCancel()
+	_, err = listener.Accept(acceptCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}